@@ -0,0 +1,264 @@
+// Package audit implements an append-only log of the changes made to zebra
+// resources and of the authentication events, recording who did what, when
+// and how they authenticated.
+package audit
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/jsonlog"
+)
+
+// Audited actions.
+const (
+	ActionCreate   = "create"
+	ActionUpdate   = "update"
+	ActionDelete   = "delete"
+	ActionLease    = "lease"
+	ActionRelease  = "release"
+	ActionExtend   = "extend"
+	ActionExpire   = "expire"
+	ActionActivate = "activate"
+	ActionLogin    = "login"
+	ActionRegister = "register"
+	ActionAuth     = "auth"
+)
+
+// Authentication methods.
+const (
+	MethodRSA      = "rsa"
+	MethodJWT      = "jwt"
+	MethodPassword = "password"
+)
+
+// Redacted replaces the values of secret fields in the changes.
+const Redacted = "<redacted>"
+
+// Entry is a single audited event. Changes hold the fields of the resource
+// that changed, the fields of the created or deleted resource for creates and
+// deletes. Resources hold the ids of the resources leased or released.
+type Entry struct {
+	Time      time.Time `json:"time"`
+	User      string    `json:"user"`
+	Method    string    `json:"method,omitempty"`
+	Action    string    `json:"action"`
+	ID        string    `json:"id,omitempty"`
+	Type      string    `json:"type,omitempty"`
+	Resources []string  `json:"resources,omitempty"`
+	Changes   []Change  `json:"changes,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Change is the value of a resource field before and after an event. Nested
+// fields are named by their json path, e.g. "labels.color".
+type Change struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// Filter selects audit entries. Empty fields match all entries, an entry
+// matches the id if it is the entry id or one of the entry resources.
+type Filter struct {
+	User   string
+	Action string
+	ID     string
+	Type   string
+	Since  time.Time
+	Until  time.Time
+}
+
+// Log is an append-only audit log stored as json lines in a file.
+type Log struct {
+	log *jsonlog.Log
+}
+
+// NewLog returns an audit log stored in the given file.
+func NewLog(file string) *Log {
+	return &Log{log: jsonlog.NewLog(file)}
+}
+
+// Initialize creates the directory of the log file if it does not exist.
+func (a *Log) Initialize() error {
+	return a.log.Initialize()
+}
+
+// Record appends the entry to the log, the entry time is set to now if it is
+// not set.
+func (a *Log) Record(e *Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	return a.log.Append(e)
+}
+
+// Query returns the entries matching the filter in the order they were
+// recorded.
+func (a *Log) Query(filter Filter) ([]*Entry, error) {
+	entries := []*Entry{}
+
+	err := a.log.Scan(func(line []byte) error {
+		e := new(Entry)
+		if err := json.Unmarshal(line, e); err != nil {
+			return err
+		}
+
+		if filter.Match(e) {
+			entries = append(entries, e)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Match returns true if the entry matches all the filter fields.
+func (f Filter) Match(e *Entry) bool {
+	switch {
+	case f.User != "" && f.User != e.User,
+		f.Action != "" && f.Action != e.Action,
+		f.Type != "" && f.Type != e.Type,
+		!f.Since.IsZero() && e.Time.Before(f.Since),
+		!f.Until.IsZero() && e.Time.After(f.Until):
+		return false
+	case f.ID == "" || f.ID == e.ID:
+		return true
+	}
+
+	for _, id := range e.Resources {
+		if id == f.ID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Snapshot returns the json of the resource, which can be diffed later on.
+// Stored resources may be changed in place, so the state before a change must
+// be taken before the change is made. The snapshot of nil is nil.
+func Snapshot(res zebra.Resource) []byte {
+	if res == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		return nil
+	}
+
+	return data
+}
+
+// Diff returns the changed fields between two resource snapshots, sorted by
+// field. A nil snapshot has no fields. The values of secret fields are
+// redacted.
+func Diff(before []byte, after []byte) []Change {
+	beforeFields := flatten(before)
+	afterFields := flatten(after)
+	changes := []Change{}
+
+	for field, val := range beforeFields {
+		if afterVal, ok := afterFields[field]; !ok || !equal(val, afterVal) {
+			changes = append(changes, Change{Field: field, Before: val, After: afterFields[field]})
+		}
+	}
+
+	for field, val := range afterFields {
+		if _, ok := beforeFields[field]; !ok {
+			changes = append(changes, Change{Field: field, Before: nil, After: val})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+
+	for i, c := range changes {
+		if isSecret(c.Field) {
+			changes[i] = redact(c)
+		}
+	}
+
+	return changes
+}
+
+// flatten returns the json object fields by their json path, arrays are kept
+// as values.
+func flatten(data []byte) map[string]interface{} {
+	fields := map[string]interface{}{}
+
+	if len(data) == 0 {
+		return fields
+	}
+
+	obj := map[string]interface{}{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return fields
+	}
+
+	var walk func(prefix string, obj map[string]interface{})
+
+	walk = func(prefix string, obj map[string]interface{}) {
+		for key, val := range obj {
+			if nested, ok := val.(map[string]interface{}); ok && len(nested) != 0 {
+				walk(prefix+key+".", nested)
+
+				continue
+			}
+
+			fields[prefix+key] = val
+		}
+	}
+
+	walk("", obj)
+
+	return fields
+}
+
+func equal(a interface{}, b interface{}) bool {
+	aData, _ := json.Marshal(a)
+	bData, _ := json.Marshal(b)
+
+	return string(aData) == string(bData)
+}
+
+// secrets are the field names, in lower case, whose values are redacted
+// wherever they are in the json path.
+var secrets = map[string]struct{}{ //nolint:gochecknoglobals
+	"password":     {},
+	"passwordhash": {},
+	"key":          {},
+	"keys":         {},
+}
+
+// isSecret returns true for passwords, password hashes, keys and credential
+// keys, at any depth and whatever their case.
+func isSecret(field string) bool {
+	for _, segment := range strings.Split(field, ".") {
+		if _, ok := secrets[strings.ToLower(segment)]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func redact(c Change) Change {
+	if c.Before != nil {
+		c.Before = Redacted
+	}
+
+	if c.After != nil {
+		c.After = Redacted
+	}
+
+	return c
+}
@@ -0,0 +1,135 @@
+package audit_test
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/audit"
+	"github.com/project-safari/zebra/compute"
+	"github.com/project-safari/zebra/jsonlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLog(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testauditlog"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	assert.Equal(jsonlog.ErrLogPath, audit.NewLog("").Initialize())
+
+	log := audit.NewLog(filepath.Join(root, "audit", "audit.log"))
+	assert.Nil(log.Initialize())
+
+	// No entries yet
+	entries, err := log.Query(audit.Filter{})
+	assert.Nil(err)
+	assert.Empty(entries)
+
+	start := time.Now()
+
+	assert.Nil(log.Record(&audit.Entry{User: "thor@asgard.io", Method: audit.MethodJWT, Action: audit.ActionCreate,
+		ID: "0100000001", Type: "Switch"}))
+	assert.Nil(log.Record(&audit.Entry{User: "loki@asgard.io", Method: audit.MethodRSA, Action: audit.ActionRelease,
+		ID: "0100000002", Type: "Lease", Resources: []string{"0100000001"}}))
+	assert.Nil(log.Record(&audit.Entry{User: "loki@asgard.io", Method: audit.MethodPassword, Action: audit.ActionLogin,
+		Error: "bad password"}))
+
+	entries, err = log.Query(audit.Filter{})
+	assert.Nil(err)
+	assert.Len(entries, 3)
+	assert.Equal(audit.ActionCreate, entries[0].Action)
+	assert.False(entries[0].Time.Before(start))
+
+	entries, err = log.Query(audit.Filter{User: "loki@asgard.io"})
+	assert.Nil(err)
+	assert.Len(entries, 2)
+
+	// The released switch is found by its id
+	entries, err = log.Query(audit.Filter{ID: "0100000001", Action: audit.ActionRelease})
+	assert.Nil(err)
+	assert.Len(entries, 1)
+	assert.Equal("loki@asgard.io", entries[0].User)
+
+	entries, err = log.Query(audit.Filter{Type: "Switch"})
+	assert.Nil(err)
+	assert.Len(entries, 1)
+
+	entries, err = log.Query(audit.Filter{Since: time.Now().Add(time.Hour)})
+	assert.Nil(err)
+	assert.Empty(entries)
+
+	entries, err = log.Query(audit.Filter{Since: start, Until: time.Now()})
+	assert.Nil(err)
+	assert.Len(entries, 3)
+
+	entries, err = log.Query(audit.Filter{Until: start.Add(-time.Hour)})
+	assert.Nil(err)
+	assert.Empty(entries)
+}
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	res := zebra.NewBaseResource("Switch", zebra.Labels{"system.group": "eng", "color": "red"})
+	before := audit.Snapshot(res)
+
+	res.Labels["color"] = "blue"
+	res.Labels["owner"] = "thor"
+	delete(res.Labels, "system.group")
+	after := audit.Snapshot(res)
+
+	assert.Equal([]audit.Change{
+		{Field: "labels.color", Before: "red", After: "blue"},
+		{Field: "labels.owner", Before: nil, After: "thor"},
+		{Field: "labels.system.group", Before: "eng", After: nil},
+	}, audit.Diff(before, after))
+
+	assert.Empty(audit.Diff(after, after))
+	assert.Nil(audit.Snapshot(nil))
+
+	// Creates and deletes have all the fields
+	changes := audit.Diff(nil, after)
+	assert.NotEmpty(changes)
+
+	for _, c := range changes {
+		assert.Nil(c.Before)
+	}
+
+	assert.Len(audit.Diff(after, nil), len(changes))
+
+	// Secrets are redacted
+	assert.Equal([]audit.Change{
+		{Field: "keys.password", Before: audit.Redacted, After: audit.Redacted},
+		{Field: "passwordHash", Before: nil, After: audit.Redacted},
+	}, audit.Diff([]byte(`{"keys":{"password":"a"}}`), []byte(`{"keys":{"password":"b"},"passwordHash":"x"}`)))
+}
+
+func TestDiffCredentials(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	server := compute.NewServer([]string{"serial", "model", "server"}, net.ParseIP("10.0.0.1"), nil)
+	before := audit.Snapshot(server)
+
+	server.Credentials.Keys["password"] = "Secret@zebra123"
+
+	changes := audit.Diff(before, audit.Snapshot(server))
+	assert.NotEmpty(changes)
+
+	for _, c := range changes {
+		assert.NotContains(fmt.Sprint(c.Before, c.After), "Secret@zebra123", c.Field)
+	}
+
+	assert.Contains(changes, audit.Change{
+		Field: "credentials.Keys.password", Before: nil, After: audit.Redacted,
+	})
+}
@@ -49,6 +49,11 @@ func (claims *Claims) Update(resource string) bool {
 	return claims.Role.Update(resource)
 }
 
+// Covers returns true if the claims have all the privileges of the role.
+func (claims *Claims) Covers(role *Role) bool {
+	return claims.Role.CoversRole(role)
+}
+
 func (claims *Claims) JWT(key string) string {
 	tkn := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	jwtStr, _ := tkn.SignedString([]byte(key))
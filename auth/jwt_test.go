@@ -16,7 +16,7 @@ func TestClaims(t *testing.T) {
 	assert.NotNil(crud)
 	assert.Nil(err)
 
-	role := &auth.Role{"boy", []*auth.Priv{crud}}
+	role := &auth.Role{"boy", []*auth.Priv{crud}, 0}
 	claims := auth.NewClaims("zebra", "adam", role, "email@domain")
 
 	assert.True(claims.Create("anything"))
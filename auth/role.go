@@ -2,9 +2,12 @@ package auth
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"regexp"
 	"strings"
+
+	"github.com/project-safari/zebra"
 )
 
 var (
@@ -133,8 +136,20 @@ type ResourceKey struct {
 	re  *regexp.Regexp
 }
 
+// NewKey returns the resource key for the regular expression. The expression
+// must match the whole resource key, so that "Server/eng" does not match
+// "Server/engineering". The empty key matches all resource keys.
 func NewKey(key string) (*ResourceKey, error) {
-	re, err := regexp.Compile(key)
+	if _, err := regexp.Compile(key); err != nil {
+		return nil, err
+	}
+
+	pattern := ""
+	if key != "" {
+		pattern = "^(?:" + key + ")$"
+	}
+
+	re, err := regexp.Compile(pattern)
 	if err != nil {
 		return nil, err
 	}
@@ -149,9 +164,32 @@ func (r *ResourceKey) Match(key string) bool {
 	return r.re.MatchString(key)
 }
 
+// MatchesAll returns true if the key is one of the patterns matching every
+// resource key, e.g. "" or ".*".
+func (r *ResourceKey) MatchesAll() bool {
+	switch r.key {
+	case "", ".*", "^.*", ".*$", "^.*$":
+		return true
+	default:
+		return false
+	}
+}
+
+// KeyOf returns the key the privileges on the resource are checked against,
+// the resource type and its system.group label, e.g. "Server/eng".
+func KeyOf(res zebra.Resource) string {
+	return GroupKey(res.GetType(), res.GetLabels()["system.group"])
+}
+
+// GroupKey returns the key of the resources of the type in the group.
+func GroupKey(resType string, group string) string {
+	return resType + "/" + group
+}
+
 type Role struct {
 	Name       string  `json:"name"`
 	Privileges []*Priv `json:"privileges"`
+	Priority   int     `json:"priority,omitempty"`
 }
 
 func (r *Role) Read(key string) bool {
@@ -203,3 +241,90 @@ func (r *Role) Delete(key string) bool {
 
 	return false
 }
+
+// Covers returns true if the role has all the given privileges, each of the
+// privileges allowed on the key of the given privilege must be allowed by a
+// privilege on the same key or on all keys. Keys are not compared as patterns,
+// so that a role covers a privilege only if it surely allows it.
+func (r *Role) Covers(priv *Priv) bool {
+	allowed := func(has func(*Priv) bool) bool {
+		for _, p := range r.Privileges {
+			if has(p) && (p.k.key == priv.k.key || p.k.MatchesAll()) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return (!priv.c || allowed(func(p *Priv) bool { return p.c })) &&
+		(!priv.r || allowed(func(p *Priv) bool { return p.r })) &&
+		(!priv.u || allowed(func(p *Priv) bool { return p.u })) &&
+		(!priv.d || allowed(func(p *Priv) bool { return p.d }))
+}
+
+// CoversRole returns true if the role covers all the privileges of the other
+// role and the other role does not have a higher priority.
+func (r *Role) CoversRole(other *Role) bool {
+	if other.Priority > r.Priority {
+		return false
+	}
+
+	for _, p := range other.Privileges {
+		if !r.Covers(p) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func RoleType() zebra.Type {
+	return zebra.Type{
+		Name:        "Role",
+		Description: "zebra user role",
+		Constructor: func() zebra.Resource { return new(RoleResource) },
+	}
+}
+
+// RoleResource is a role stored as a resource. Users are bound to a stored
+// role by name, each user keeps a copy of the role it is bound to.
+type RoleResource struct {
+	zebra.BaseResource
+	Role
+}
+
+func NewRoleResource(role *Role, labels zebra.Labels) *RoleResource {
+	return &RoleResource{
+		BaseResource: *zebra.NewBaseResource("Role", labels),
+		Role:         *role.Copy(),
+	}
+}
+
+// Validate returns an error if the given RoleResource object has incorrect
+// values. Else, it returns nil.
+func (r *RoleResource) Validate(ctx context.Context) error {
+	if r.Name == "" {
+		return zebra.ErrNameEmpty
+	}
+
+	for _, p := range r.Privileges {
+		if p == nil || p.k == nil {
+			return ErrInvalidPrivileges
+		}
+	}
+
+	if r.Type != "Role" {
+		return zebra.ErrWrongType
+	}
+
+	return r.BaseResource.Validate(ctx)
+}
+
+// Copy returns a copy of the role that does not share the privileges list.
+func (r *Role) Copy() *Role {
+	privs := make([]*Priv, len(r.Privileges))
+	copy(privs, r.Privileges)
+
+	return &Role{Name: r.Name, Privileges: privs, Priority: r.Priority}
+}
@@ -1,8 +1,11 @@
 package auth_test
 
 import (
+	"context"
+	"encoding/json"
 	"testing"
 
+	"github.com/project-safari/zebra"
 	"github.com/project-safari/zebra/auth"
 	"github.com/stretchr/testify/assert"
 )
@@ -15,9 +18,37 @@ func TestKey(t *testing.T) {
 	assert.Nil(e)
 	assert.NotNil(k)
 	assert.True(k.Match("a/b/c"))
-	assert.True(k.Match("a/b/c/d"))
+	assert.False(k.Match("a/b/c/d"))
 	assert.False(k.Match("/b/c/d"))
 
+	// Keys match the whole resource key, not a group which has the key group
+	// as prefix
+	k, e = auth.NewKey("Server/eng")
+	assert.Nil(e)
+	assert.True(k.Match("Server/eng"))
+	assert.False(k.Match("Server/engineering"))
+	assert.False(k.Match("BigServer/eng"))
+
+	k, e = auth.NewKey("Server/eng|Server/ops")
+	assert.Nil(e)
+	assert.True(k.Match("Server/ops"))
+	assert.False(k.Match("Server/opsx"))
+
+	k, e = auth.NewKey("Server/.*")
+	assert.Nil(e)
+	assert.True(k.Match("Server/engineering"))
+	assert.False(k.Match("Switch/eng"))
+
+	// Empty key matches everything
+	k, e = auth.NewKey("")
+	assert.Nil(e)
+	assert.True(k.Match("Server/eng"))
+	assert.True(k.MatchesAll())
+
+	k, e = auth.NewKey("a)(b")
+	assert.NotNil(e)
+	assert.Nil(k)
+
 	k, e = auth.NewKey("*")
 	assert.NotNil(e)
 	assert.Nil(k)
@@ -98,3 +129,103 @@ func TestPriv(t *testing.T) {
 	assert.False(p.Delete("e/f/g"))
 	assert.False(p.Write("e/f/g"))
 }
+
+func TestKeyOf(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+	res := zebra.NewBaseResource("Server", zebra.Labels{"system.group": "eng"})
+	assert.Equal("Server/eng", auth.KeyOf(res))
+	assert.Equal(auth.GroupKey("Server", "eng"), auth.KeyOf(res))
+
+	res.Labels = nil
+	assert.Equal("Server/", auth.KeyOf(res))
+
+	k, e := auth.NewKey("^Server/eng$")
+	assert.Nil(e)
+	assert.False(k.Match(auth.KeyOf(res)))
+}
+
+func TestRoleCovers(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	priv := func(text string) *auth.Priv {
+		p := new(auth.Priv)
+		assert.Nil(p.UnmarshalText([]byte(text)))
+
+		return p
+	}
+
+	admin := &auth.Role{Name: "admin", Privileges: []*auth.Priv{priv(".*:c,r,u,d")}, Priority: 0}
+	eng := &auth.Role{Name: "eng", Privileges: []*auth.Priv{priv("Server/eng:r,u"), priv(":r")}, Priority: 0}
+
+	assert.True(admin.Covers(priv("Server/eng:c,r,u,d")))
+	assert.True(admin.CoversRole(eng))
+
+	assert.True(eng.Covers(priv("Server/eng:u")))
+	assert.True(eng.Covers(priv("Server/ops:r")))
+	assert.False(eng.Covers(priv("Server/ops:u")))
+	assert.False(eng.Covers(priv("Server/eng:c,u")))
+
+	// Keys are not compared as patterns
+	assert.False(eng.Covers(priv("^Server/eng$:u")))
+	assert.False(eng.CoversRole(admin))
+	assert.True(eng.CoversRole(&auth.Role{Name: "none", Privileges: nil, Priority: 0}))
+
+	// Roles with a higher priority are not covered
+	assert.False(admin.CoversRole(&auth.Role{Name: "urgent", Privileges: nil, Priority: 1}))
+
+	admin.Priority = 1
+	assert.True(admin.CoversRole(&auth.Role{Name: "urgent", Privileges: nil, Priority: 1}))
+}
+
+func TestRoleResource(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	read, e := auth.NewPriv("Server", false, true, false, false)
+	assert.Nil(e)
+
+	role := &auth.Role{Name: "reader", Privileges: []*auth.Priv{read}, Priority: 1}
+	res := auth.NewRoleResource(role, zebra.Labels{"system.group": "system"})
+	assert.Nil(res.Validate(ctx))
+	assert.Equal("Role", res.GetType())
+	assert.Equal("Role/system", auth.KeyOf(res))
+
+	// The resource does not share the privileges of the role
+	role.Privileges[0] = nil
+	assert.Nil(res.Validate(ctx))
+
+	res.Privileges = append(res.Privileges, nil)
+	assert.Equal(auth.ErrInvalidPrivileges, res.Validate(ctx))
+
+	res.Privileges = []*auth.Priv{read}
+	res.Type = "User"
+	assert.Equal(zebra.ErrWrongType, res.Validate(ctx))
+
+	res.Type = "Role"
+	res.Name = ""
+	assert.Equal(zebra.ErrNameEmpty, res.Validate(ctx))
+
+	res.Name = "reader"
+	res.Labels = zebra.Labels{}
+	assert.NotNil(res.Validate(ctx))
+
+	data, e := json.Marshal(auth.NewRoleResource(&auth.Role{
+		Name:       "reader",
+		Privileges: []*auth.Priv{read},
+		Priority:   1,
+	}, zebra.Labels{"system.group": "system"}))
+	assert.Nil(e)
+
+	roleType := auth.RoleType()
+	res, ok := roleType.New().(*auth.RoleResource)
+	assert.True(ok)
+	assert.Nil(json.Unmarshal(data, res))
+	assert.Nil(res.Validate(ctx))
+	assert.True(res.Read("Server"))
+	assert.False(res.Update("Server"))
+}
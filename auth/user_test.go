@@ -20,7 +20,7 @@ func TestUser(t *testing.T) {
 	all, e := auth.NewPriv("", true, true, true, true)
 	assert.Nil(e)
 	assert.NotNil(all)
-	admin := &auth.Role{"admin", []*auth.Priv{all}}
+	admin := &auth.Role{"admin", []*auth.Priv{all}, 0}
 
 	writeAll, e := auth.NewPriv("", true, false, true, true)
 	assert.Nil(e)
@@ -34,7 +34,7 @@ func TestUser(t *testing.T) {
 	assert.Nil(e)
 	assert.NotNil(rwOne)
 
-	user := &auth.Role{"user", []*auth.Priv{readAll, rwOne}}
+	user := &auth.Role{"user", []*auth.Priv{readAll, rwOne}, 0}
 
 	godKey, err := auth.Generate()
 	assert.Nil(err)
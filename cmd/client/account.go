@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/project-safari/zebra/auth"
+	"github.com/spf13/cobra"
+)
+
+var ErrNoPassword = errors.New("password is not specified")
+
+func NewRegister() *cobra.Command {
+	registerCmd := &cobra.Command{ //nolint:exhaustivestruct,exhaustruct
+		Use:          "register",
+		Short:        "register the configured user and public key with zebra",
+		RunE:         register,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+	}
+	registerCmd.Flags().StringP("password", "p", "", "user password (default: read from stdin)")
+
+	return registerCmd
+}
+
+func NewLogin() *cobra.Command {
+	loginCmd := &cobra.Command{ //nolint:exhaustivestruct,exhaustruct
+		Use:          "login",
+		Short:        "login to zebra and cache the session token",
+		RunE:         login,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+	}
+	loginCmd.Flags().StringP("password", "p", "", "user password (default: read from stdin)")
+
+	return loginCmd
+}
+
+func NewWhoami() *cobra.Command {
+	return &cobra.Command{ //nolint:exhaustivestruct,exhaustruct
+		Use:          "whoami",
+		Short:        "show the current user role and privileges",
+		RunE:         whoami,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+	}
+}
+
+func register(cmd *cobra.Command, args []string) error {
+	c, cfg, e := newClientFromCmd(cmd)
+	if e != nil {
+		return e
+	}
+
+	password, e := readPassword(cmd)
+	if e != nil {
+		return e
+	}
+
+	registryData := &struct {
+		Name     string            `json:"name"`
+		Password string            `json:"password"`
+		Email    string            `json:"email"`
+		Key      *auth.RsaIdentity `json:"key"`
+	}{
+		Name:     cfg.User,
+		Password: password,
+		Email:    cfg.Email,
+		Key:      cfg.Key.Public(),
+	}
+
+	user := new(auth.User)
+	if _, e := c.Post("register", registryData, user); e != nil {
+		return e
+	}
+
+	t := newTable("NAME", "EMAIL", "ROLE")
+	t.add(user.Name, user.Email, roleName(user.Role))
+
+	return printOutput(cmd, user, t)
+}
+
+func login(cmd *cobra.Command, args []string) error {
+	c, cfg, e := newClientFromCmd(cmd)
+	if e != nil {
+		return e
+	}
+
+	password, e := readPassword(cmd)
+	if e != nil {
+		return e
+	}
+
+	userData := &struct {
+		Password string `json:"password"`
+		Email    string `json:"email"`
+	}{Password: password, Email: cfg.Email}
+
+	resData := &struct {
+		JWT string `json:"jwt"`
+	}{}
+
+	if _, e := c.Post("login", userData, resData); e != nil {
+		return e
+	}
+
+	claims, e := parseJWT(resData.JWT)
+	if e != nil {
+		return e
+	}
+
+	if e := c.setJWT(resData.JWT); e != nil {
+		return e
+	}
+
+	return printClaims(cmd, claims)
+}
+
+func whoami(cmd *cobra.Command, args []string) error {
+	c, _, e := newClientFromCmd(cmd)
+	if e != nil {
+		return e
+	}
+
+	claims, e := c.Refresh()
+	if e != nil {
+		return e
+	}
+
+	return printClaims(cmd, claims)
+}
+
+// readPassword returns the password flag value, or reads the password from
+// the first line of stdin if the flag is not set.
+func readPassword(cmd *cobra.Command) (string, error) {
+	password, e := cmd.Flags().GetString("password")
+	if e != nil || password != "" {
+		return password, e
+	}
+
+	fmt.Fprint(cmd.ErrOrStderr(), "Password: ")
+
+	line, e := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+	password = strings.TrimSpace(line)
+
+	if password == "" {
+		return "", ErrNoPassword
+	}
+
+	return password, nil
+}
+
+func printClaims(cmd *cobra.Command, claims *auth.Claims) error {
+	t := newTable("USER", "EMAIL", "ROLE", "PRIVILEGES", "EXPIRES")
+	privileges := []string{}
+
+	if claims.Role != nil {
+		for _, p := range claims.Role.Privileges {
+			privileges = append(privileges, p.String())
+		}
+	}
+
+	expires := time.Unix(claims.ExpiresAt, 0).Format(time.RFC3339)
+	t.add(claims.Subject, claims.Email, roleName(claims.Role), strings.Join(privileges, " "), expires)
+
+	return printOutput(cmd, claims, t)
+}
+
+func roleName(role *auth.Role) string {
+	if role == nil {
+		return "-"
+	}
+
+	return role.Name
+}
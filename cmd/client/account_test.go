@@ -0,0 +1,197 @@
+package main //nolint:testpackage
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+const testAuthKey = "testauthkey"
+
+func makeAccountServer(assert *assert.Assertions, refreshed *int32) *httptest.Server {
+	role := &auth.Role{Name: "user", Privileges: nil, Priority: 0}
+	priv, err := auth.NewPriv("", false, true, false, false)
+	assert.Nil(err)
+
+	role.Privileges = append(role.Privileges, priv)
+
+	writeJWT := func(rw http.ResponseWriter) {
+		claims := auth.NewClaims("zebra", "loki", role, "loki@asgard.io")
+		b, e := json.Marshal(map[string]string{"jwt": claims.JWT(testAuthKey)})
+		assert.Nil(e)
+
+		_, e = rw.Write(b)
+		assert.Nil(e)
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/register":
+			registryData := &struct {
+				Name     string            `json:"name"`
+				Password string            `json:"password"`
+				Email    string            `json:"email"`
+				Key      *auth.RsaIdentity `json:"key"`
+			}{}
+			assert.Nil(json.NewDecoder(req.Body).Decode(registryData))
+			assert.Equal("loki", registryData.Name)
+			assert.Equal("secret", registryData.Password)
+			assert.NotNil(registryData.Key)
+
+			user := auth.NewUser(registryData.Name, registryData.Email, registryData.Password,
+				registryData.Key, nil)
+			b, e := json.Marshal(user)
+			assert.Nil(e)
+
+			rw.WriteHeader(http.StatusCreated)
+			_, e = rw.Write(b)
+			assert.Nil(e)
+		case "/login":
+			userData := &struct {
+				Password string `json:"password"`
+				Email    string `json:"email"`
+			}{}
+			assert.Nil(json.NewDecoder(req.Body).Decode(userData))
+
+			if userData.Password != "secret" {
+				rw.WriteHeader(http.StatusUnauthorized)
+
+				return
+			}
+
+			writeJWT(rw)
+		case "/refresh":
+			atomic.AddInt32(refreshed, 1)
+			writeJWT(rw)
+		case "/test":
+			if cookie, e := req.Cookie("jwt"); e == nil {
+				_, e = auth.FromJWT(cookie.Value, testAuthKey)
+				assert.Nil(e)
+			}
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func runAccountCmd(cfgFile string, stdin string, args ...string) (string, error) {
+	out := new(bytes.Buffer)
+	rootCmd := New()
+	rootCmd.SetOut(out)
+	rootCmd.SetErr(new(bytes.Buffer))
+	rootCmd.SetIn(strings.NewReader(stdin))
+	rootCmd.SetArgs(append([]string{"-c", cfgFile}, args...))
+
+	err := rootCmd.Execute()
+
+	return out.String(), err
+}
+
+func TestAccount(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	cfgFile := "./test_account_config.yaml"
+
+	t.Cleanup(func() { os.Remove(cfgFile) })
+
+	var refreshed int32
+
+	server := makeAccountServer(assert, &refreshed)
+
+	defer server.Close()
+
+	makeLeaseConfig(assert, cfgFile, server.URL)
+
+	out, err := runAccountCmd(cfgFile, "secret\n", "register")
+	assert.Nil(err)
+	assert.Contains(out, "loki@asgard.io")
+
+	_, err = runAccountCmd(cfgFile, "", "register")
+	assert.Equal(ErrNoPassword, err)
+
+	_, err = runAccountCmd(cfgFile, "", "login", "-p", "wrong")
+	assert.NotNil(err)
+
+	out, err = runAccountCmd(cfgFile, "", "login", "-p", "secret")
+	assert.Nil(err)
+	assert.Contains(out, "loki@asgard.io")
+
+	// Token is cached in the config file
+	cfg, err := Load(cfgFile)
+	assert.Nil(err)
+	assert.NotEmpty(cfg.JWT)
+
+	out, err = runAccountCmd(cfgFile, "", "whoami", "-o", "json")
+	assert.Nil(err)
+
+	claims := new(auth.Claims)
+	assert.Nil(json.Unmarshal([]byte(out), claims))
+	assert.Equal("user", claims.Role.Name)
+	assert.True(claims.Read("VLANPool"))
+	assert.False(claims.Delete("VLANPool"))
+	assert.Equal(int32(1), atomic.LoadInt32(&refreshed))
+}
+
+func TestRefreshJWT(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	cfgFile := "./test_refresh_config.yaml"
+
+	t.Cleanup(func() { os.Remove(cfgFile) })
+
+	var refreshed int32
+
+	server := makeAccountServer(assert, &refreshed)
+
+	defer server.Close()
+
+	makeLeaseConfig(assert, cfgFile, server.URL)
+
+	cfg, err := Load(cfgFile)
+	assert.Nil(err)
+
+	client, err := NewClient(cfg)
+	assert.Nil(err)
+
+	// Fresh token is not refreshed
+	claims := auth.NewClaims("zebra", "loki", nil, "loki@asgard.io")
+	cfg.JWT = claims.JWT(testAuthKey)
+
+	_, err = client.Get("test", nil, nil)
+	assert.Nil(err)
+	assert.Equal(int32(0), atomic.LoadInt32(&refreshed))
+
+	// Token about to expire is refreshed and saved
+	claims.ExpiresAt = time.Now().Add(time.Minute).Unix()
+	cfg.JWT = claims.JWT(testAuthKey)
+	old := cfg.JWT
+
+	_, err = client.Get("test", nil, nil)
+	assert.Nil(err)
+	assert.Equal(int32(1), atomic.LoadInt32(&refreshed))
+	assert.NotEqual(old, cfg.JWT)
+
+	saved, err := Load(cfgFile)
+	assert.Nil(err)
+	assert.Equal(cfg.JWT, saved.JWT)
+
+	// Expired token is dropped
+	claims.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+	cfg.JWT = claims.JWT(testAuthKey)
+
+	_, err = client.Get("test", nil, nil)
+	assert.Nil(err)
+	assert.Empty(cfg.JWT)
+	assert.Equal(int32(1), atomic.LoadInt32(&refreshed))
+}
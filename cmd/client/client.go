@@ -12,8 +12,15 @@ import (
 	"io/ioutil"
 	"net/http"
 	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/project-safari/zebra/auth"
 )
 
+// RefreshWindow is the time before the cached jwt expires when it is
+// refreshed.
+const RefreshWindow = auth.TokenDuration / 2
+
 var (
 	ErrNoCACert     = errors.New("zebra CA certificate file is not conifugred")
 	ErrNoConfig     = errors.New("zebra config file is not specified")
@@ -78,7 +85,77 @@ func (c *Client) Post(path string, in, out interface{}) (int, error) {
 	return c.do(context.Background(), "POST", path, in, out)
 }
 
+func (c *Client) Put(path string, in, out interface{}) (int, error) {
+	return c.do(context.Background(), "PUT", path, in, out)
+}
+
+// Refresh gets a fresh jwt from the server and caches it in the config.
+func (c *Client) Refresh() (*auth.Claims, error) {
+	resData := &struct {
+		JWT string `json:"jwt"`
+	}{}
+
+	if _, e := c.do(context.Background(), "POST", "refresh", nil, resData); e != nil {
+		return nil, e
+	}
+
+	claims, e := parseJWT(resData.JWT)
+	if e != nil {
+		return nil, e
+	}
+
+	return claims, c.setJWT(resData.JWT)
+}
+
+// refreshJWT refreshes the cached jwt before it expires, an expired jwt is
+// dropped. Errors are ignored since requests are also authenticated with the
+// user key.
+func (c *Client) refreshJWT() {
+	if c.cfg.JWT == "" {
+		return
+	}
+
+	claims, e := parseJWT(c.cfg.JWT)
+	if e != nil || claims.ExpiresAt < time.Now().Unix() {
+		_ = c.setJWT("")
+
+		return
+	}
+
+	if time.Until(time.Unix(claims.ExpiresAt, 0)) < RefreshWindow {
+		_, _ = c.Refresh()
+	}
+}
+
+// setJWT caches the jwt in the config and saves the config file it was
+// loaded from.
+func (c *Client) setJWT(token string) error {
+	c.cfg.JWT = token
+
+	if c.cfg.file == "" {
+		return nil
+	}
+
+	return c.cfg.Save(c.cfg.file)
+}
+
+// parseJWT returns the claims of the jwt. The client does not have the server
+// key, so the signature is not verified.
+func parseJWT(token string) (*auth.Claims, error) {
+	claims := new(auth.Claims)
+
+	if _, _, e := jwt.NewParser().ParseUnverified(token, claims); e != nil {
+		return nil, e
+	}
+
+	return claims, nil
+}
+
 func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) (int, error) {
+	if path != "refresh" {
+		c.refreshJWT()
+	}
+
 	url := fmt.Sprintf("%s/%s", c.cfg.ServerAddress, path)
 	buf := bytes.NewBuffer([]byte{})
 
@@ -96,14 +173,18 @@ func (c *Client) do(ctx context.Context, method, path string, in, out interface{
 		return 0, err
 	}
 
-	r.Header = c.h
+	r.Header = c.h.Clone()
+
+	if c.cfg.JWT != "" {
+		r.AddCookie(&http.Cookie{Name: "jwt", Value: c.cfg.JWT}) //nolint:exhaustivestruct,exhaustruct
+	}
 
 	resp, err := c.c.Do(r)
 	if err != nil {
 		return 0, err
 	}
 
-	if resp.StatusCode != http.StatusOK {
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
 		return resp.StatusCode, fmt.Errorf("%s: %s", url, resp.Status) //nolint:goerr113
 	}
 
@@ -98,6 +98,8 @@ type Config struct {
 	Key           *auth.RsaIdentity `yaml:"key"`
 	CACert        string            `yaml:"caCert"`
 	Defaults      ConfigDefaults    `yaml:"defaults,omitempty"`
+	JWT           string            `yaml:"jwt,omitempty"`
+	file          string
 }
 
 func NewConfig() *Config {
@@ -110,6 +112,8 @@ func NewConfig() *Config {
 		Defaults: ConfigDefaults{
 			Duration: zebra.DefaultMaxDuration,
 		},
+		JWT:  "",
+		file: "",
 	}
 }
 
@@ -120,6 +124,7 @@ func Load(cfgFile string) (*Config, error) {
 	}
 
 	c := NewConfig()
+	c.file = cfgFile
 	e = yaml.Unmarshal(data, c)
 
 	return c, e
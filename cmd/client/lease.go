@@ -0,0 +1,356 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/lease"
+	"github.com/project-safari/zebra/store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ErrLeaseNotFound = errors.New("lease not found")
+	ErrFilter        = errors.New(`filter must be of the form "label=<query>"`)
+)
+
+type leaseRequest struct {
+	Duration time.Duration        `json:"duration"`
+	Request  []*lease.ResourceReq `json:"request"`
+}
+
+func NewLease() *cobra.Command {
+	leaseCmd := &cobra.Command{ //nolint:exhaustivestruct,exhaustruct
+		Use:          "lease",
+		Short:        "manage zebra resource leases",
+		RunE:         listLeases,
+		SilenceUsage: true,
+	}
+	leaseCmd.Flags().BoolP("all", "a", false, "list leases of all users")
+
+	requestCmd := &cobra.Command{ //nolint:exhaustivestruct,exhaustruct
+		Use:          "request",
+		Short:        "request a lease for resources",
+		RunE:         requestLease,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+	}
+	requestCmd.Flags().String("type", "", "resource type")
+	requestCmd.Flags().String("group", "", "resource group (system.group label)")
+	requestCmd.Flags().String("name", "", "request name")
+	requestCmd.Flags().Int("count", 1, "number of resources")
+	requestCmd.Flags().StringArray("filter", []string{}, `resource filter, e.g. "label=color==red"`)
+	requestCmd.Flags().IntP("duration", "t", 0, "duration in hours (default: configured duration)")
+	_ = requestCmd.MarkFlagRequired("type")
+	leaseCmd.AddCommand(requestCmd)
+
+	listCmd := &cobra.Command{ //nolint:exhaustivestruct,exhaustruct
+		Use:          "list",
+		Short:        "list leases",
+		RunE:         listLeases,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+	}
+	listCmd.Flags().BoolP("all", "a", false, "list leases of all users")
+	leaseCmd.AddCommand(listCmd)
+
+	leaseCmd.AddCommand(&cobra.Command{ //nolint:exhaustivestruct,exhaustruct
+		Use:          "show",
+		Short:        "show lease details",
+		RunE:         showLease,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+	})
+
+	leaseCmd.AddCommand(&cobra.Command{ //nolint:exhaustivestruct,exhaustruct
+		Use:          "release",
+		Short:        "release a lease",
+		RunE:         releaseLease,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+	})
+
+	extendCmd := &cobra.Command{ //nolint:exhaustivestruct,exhaustruct
+		Use:          "extend",
+		Short:        "extend a lease",
+		RunE:         extendLease,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+	}
+	extendCmd.Flags().IntP("duration", "t", 1, "duration in hours")
+	leaseCmd.AddCommand(extendCmd)
+
+	return leaseCmd
+}
+
+func newClientFromCmd(cmd *cobra.Command) (*Client, *Config, error) {
+	cfgFile := cmd.Flag("config").Value.String()
+
+	cfg, e := Load(cfgFile)
+	if e != nil {
+		return nil, nil, e
+	}
+
+	c, e := NewClient(cfg)
+	if e != nil {
+		return nil, nil, e
+	}
+
+	return c, cfg, nil
+}
+
+func requestLease(cmd *cobra.Command, args []string) error {
+	c, cfg, e := newClientFromCmd(cmd)
+	if e != nil {
+		return e
+	}
+
+	req, e := resourceReq(cmd)
+	if e != nil {
+		return e
+	}
+
+	duration, e := cmd.Flags().GetInt("duration")
+	if e != nil {
+		return e
+	}
+
+	if duration == 0 {
+		duration = cfg.Defaults.Duration
+	}
+
+	if duration > zebra.DefaultMaxDuration {
+		return ErrLeaseDuration
+	}
+
+	lr := &leaseRequest{
+		Duration: time.Duration(duration) * time.Hour,
+		Request:  []*lease.ResourceReq{req},
+	}
+
+	l := newLease()
+	if _, e := c.Post("api/v1/leases", lr, l); e != nil {
+		return e
+	}
+
+	return printLeases(cmd, []*lease.Lease{l})
+}
+
+func resourceReq(cmd *cobra.Command) (*lease.ResourceReq, error) {
+	flags := cmd.Flags()
+	req := new(lease.ResourceReq)
+
+	req.Type, _ = flags.GetString("type")
+	req.Group, _ = flags.GetString("group")
+	req.Name, _ = flags.GetString("name")
+	req.Count, _ = flags.GetInt("count")
+
+	filters, e := flags.GetStringArray("filter")
+	if e != nil {
+		return nil, e
+	}
+
+	for _, f := range filters {
+		if !strings.HasPrefix(f, "label=") {
+			return nil, ErrFilter
+		}
+
+		q, e := parseQuery(strings.TrimPrefix(f, "label="))
+		if e != nil {
+			return nil, e
+		}
+
+		req.Filters = append(req.Filters, q)
+	}
+
+	return req, nil
+}
+
+func listLeases(cmd *cobra.Command, args []string) error {
+	all, e := cmd.Flags().GetBool("all")
+	if e != nil {
+		return e
+	}
+
+	leases, e := getLeases(cmd, all)
+	if e != nil {
+		return e
+	}
+
+	return printLeases(cmd, leases)
+}
+
+func showLease(cmd *cobra.Command, args []string) error {
+	leases, e := getLeases(cmd, true)
+	if e != nil {
+		return e
+	}
+
+	for _, l := range leases {
+		if l.ID == args[0] {
+			return printLease(cmd, l)
+		}
+	}
+
+	return ErrLeaseNotFound
+}
+
+func releaseLease(cmd *cobra.Command, args []string) error {
+	c, _, e := newClientFromCmd(cmd)
+	if e != nil {
+		return e
+	}
+
+	l := newLease()
+	if _, e := c.Post(fmt.Sprintf("api/v1/leases/%s/release", args[0]), nil, l); e != nil {
+		return e
+	}
+
+	return printLeases(cmd, []*lease.Lease{l})
+}
+
+func extendLease(cmd *cobra.Command, args []string) error {
+	c, _, e := newClientFromCmd(cmd)
+	if e != nil {
+		return e
+	}
+
+	duration, e := cmd.Flags().GetInt("duration")
+	if e != nil {
+		return e
+	}
+
+	if duration > zebra.DefaultMaxDuration {
+		return ErrLeaseDuration
+	}
+
+	extendReq := &struct {
+		Duration time.Duration `json:"duration"`
+	}{Duration: time.Duration(duration) * time.Hour}
+
+	l := newLease()
+	if _, e := c.Post(fmt.Sprintf("api/v1/leases/%s/extend", args[0]), extendReq, l); e != nil {
+		return e
+	}
+
+	return printLeases(cmd, []*lease.Lease{l})
+}
+
+func getLeases(cmd *cobra.Command, all bool) ([]*lease.Lease, error) {
+	c, _, e := newClientFromCmd(cmd)
+	if e != nil {
+		return nil, e
+	}
+
+	path := "api/v1/leases"
+	if all {
+		path += "?all=true"
+	}
+
+	leaseRes := &struct {
+		Leases []json.RawMessage `json:"leases"`
+	}{}
+
+	if _, e := c.Get(path, nil, leaseRes); e != nil {
+		return nil, e
+	}
+
+	leases := make([]*lease.Lease, 0, len(leaseRes.Leases))
+
+	for _, data := range leaseRes.Leases {
+		l := newLease()
+		if e := json.Unmarshal(data, l); e != nil {
+			return nil, e
+		}
+
+		leases = append(leases, l)
+	}
+
+	return leases, nil
+}
+
+// newLease returns an empty lease which can unpack the leased resources.
+func newLease() *lease.Lease {
+	leaseType := lease.LeaseType(store.DefaultFactory())
+	l, _ := leaseType.New().(*lease.Lease)
+
+	return l
+}
+
+func leaseState(l *lease.Lease) string {
+	switch {
+	case l.IsQueued():
+		return "queued"
+	case l.IsValid():
+		return "active"
+	case l.GetStatus().State == zebra.Active:
+		return "expired"
+	default:
+		return "released"
+	}
+}
+
+func leaseExpiry(l *lease.Lease) string {
+	if l.ActivationTime.IsZero() {
+		return "-"
+	}
+
+	return l.ActivationTime.Add(l.Duration).Format(time.RFC3339)
+}
+
+func leaseCount(l *lease.Lease) string {
+	assigned, count := 0, 0
+
+	for _, r := range l.RequestList() {
+		assigned += len(r.Resources)
+		count += r.Count
+	}
+
+	return strconv.Itoa(assigned) + "/" + strconv.Itoa(count)
+}
+
+func printLeases(cmd *cobra.Command, leases []*lease.Lease) error {
+	t := newTable("ID", "OWNER", "STATE", "DURATION", "EXPIRES", "RESOURCES")
+
+	for _, l := range leases {
+		t.add(l.ID, l.Owner(), leaseState(l), l.Duration.String(), leaseExpiry(l), leaseCount(l))
+	}
+
+	return printOutput(cmd, leases, t)
+}
+
+func printLease(cmd *cobra.Command, l *lease.Lease) error {
+	t := newTable("NAME", "TYPE", "GROUP", "COUNT", "FILTERS", "RESOURCES")
+
+	for _, r := range l.RequestList() {
+		filters := make([]string, 0, len(r.Filters))
+
+		for _, f := range r.Filters {
+			op, _ := f.Op.MarshalText()
+			filters = append(filters, f.Key+" "+string(op)+" "+strings.Join(f.Values, ","))
+		}
+
+		ids := make([]string, 0, len(r.Resources))
+
+		for _, res := range r.Resources {
+			ids = append(ids, res.GetID())
+		}
+
+		t.add(r.Name, r.Type, r.Group, strconv.Itoa(r.Count), strings.Join(filters, ";"), strings.Join(ids, ","))
+	}
+
+	if cmd.Flag("output").Value.String() == "table" {
+		if e := printLeases(cmd, []*lease.Lease{l}); e != nil {
+			return e
+		}
+
+		fmt.Fprintln(cmd.OutOrStdout())
+	}
+
+	return printOutput(cmd, l, t)
+}
@@ -0,0 +1,236 @@
+package main //nolint:testpackage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/lease"
+	"github.com/project-safari/zebra/network"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeLeaseServer(assert *assert.Assertions, l *lease.Lease) *httptest.Server {
+	mux := http.NewServeMux()
+
+	writeLease := func(rw http.ResponseWriter, status int, data interface{}) {
+		b, e := json.Marshal(data)
+		assert.Nil(e)
+
+		rw.WriteHeader(status)
+		_, e = rw.Write(b)
+		assert.Nil(e)
+	}
+
+	mux.HandleFunc("/api/v1/leases", func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodPost {
+			lr := new(leaseRequest)
+			assert.Nil(json.NewDecoder(req.Body).Decode(lr))
+			assert.Equal(2*time.Hour, lr.Duration)
+			assert.Len(lr.Request, 1)
+			assert.Equal("VLANPool", lr.Request[0].Type)
+			assert.Equal(zebra.MatchEqual, lr.Request[0].Filters[0].Op)
+			writeLease(rw, http.StatusAccepted, l)
+
+			return
+		}
+
+		writeLease(rw, http.StatusOK, map[string][]*lease.Lease{"leases": {l}})
+	})
+
+	mux.HandleFunc(fmt.Sprintf("/api/v1/leases/%s/release", l.ID), func(rw http.ResponseWriter, req *http.Request) {
+		writeLease(rw, http.StatusOK, l)
+	})
+
+	mux.HandleFunc(fmt.Sprintf("/api/v1/leases/%s/extend", l.ID), func(rw http.ResponseWriter, req *http.Request) {
+		extendReq := &struct {
+			Duration time.Duration `json:"duration"`
+		}{}
+		assert.Nil(json.NewDecoder(req.Body).Decode(extendReq))
+		assert.Equal(time.Hour, extendReq.Duration)
+		writeLease(rw, http.StatusOK, l)
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func makeLease() *lease.Lease {
+	owner := auth.NewUser("loki", "loki@asgard.io", "", nil, nil)
+	vlan := &network.VLANPool{
+		BaseResource: *zebra.NewBaseResource("VLANPool", zebra.Labels{"system.group": "eng"}),
+		RangeStart:   0,
+		RangeEnd:     10,
+	}
+
+	l := lease.NewLease(*owner, time.Hour, []*lease.ResourceReq{{
+		Type:      "VLANPool",
+		Group:     "eng",
+		Name:      "vlans",
+		Count:     1,
+		Filters:   []zebra.Query{{Key: "color", Op: zebra.MatchEqual, Values: []string{"red"}}},
+		Resources: []zebra.Resource{vlan},
+	}})
+	_ = l.Activate()
+
+	return l
+}
+
+func makeLeaseConfig(assert *assert.Assertions, cfgFile string, server string) {
+	key, err := auth.Load(testUserKeyFile)
+	assert.Nil(err)
+
+	cfg := &Config{
+		ServerAddress: server,
+		Key:           key,
+		User:          "loki",
+		Email:         "loki@asgard.io",
+		CACert:        testCACertFile,
+		Defaults:      ConfigDefaults{Duration: 2},
+	}
+	assert.Nil(cfg.Save(cfgFile))
+}
+
+func runLeaseCmd(cfgFile string, args ...string) (string, error) {
+	out := new(bytes.Buffer)
+	rootCmd := New()
+	rootCmd.SetOut(out)
+	rootCmd.SetArgs(append([]string{"-c", cfgFile, "lease"}, args...))
+
+	err := rootCmd.Execute()
+
+	return out.String(), err
+}
+
+func TestLease(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	cfgFile := "./test_lease_config.yaml"
+
+	t.Cleanup(func() { os.Remove(cfgFile) })
+
+	l := makeLease()
+	server := makeLeaseServer(assert, l)
+
+	defer server.Close()
+
+	makeLeaseConfig(assert, cfgFile, server.URL)
+
+	out, err := runLeaseCmd(cfgFile)
+	assert.Nil(err)
+	assert.Contains(out, l.ID)
+	assert.Contains(out, "active")
+	assert.Contains(out, "1/1")
+
+	out, err = runLeaseCmd(cfgFile, "list", "--all", "-o", "json")
+	assert.Nil(err)
+
+	leases := []map[string]interface{}{}
+	assert.Nil(json.Unmarshal([]byte(out), &leases))
+	assert.Len(leases, 1)
+	assert.Equal(l.ID, leases[0]["id"])
+
+	out, err = runLeaseCmd(cfgFile, "list", "-o", "xml")
+	assert.Equal(ErrOutputFormat, err)
+	assert.Empty(out)
+
+	out, err = runLeaseCmd(cfgFile, "show", l.ID)
+	assert.Nil(err)
+	assert.Contains(out, "vlans")
+	assert.Contains(out, "color == red")
+	assert.Contains(out, l.Request[0].Resources[0].GetID())
+
+	_, err = runLeaseCmd(cfgFile, "show", "unknown")
+	assert.Equal(ErrLeaseNotFound, err)
+
+	out, err = runLeaseCmd(cfgFile, "request", "--type", "VLANPool", "--group", "eng",
+		"--filter", "label=color==red")
+	assert.Nil(err)
+	assert.Contains(out, l.ID)
+
+	_, err = runLeaseCmd(cfgFile, "request", "--type", "VLANPool", "--filter", "color==red")
+	assert.Equal(ErrFilter, err)
+
+	_, err = runLeaseCmd(cfgFile, "request", "--type", "VLANPool", "--filter", "label=color")
+	assert.Equal(ErrQuery, err)
+
+	_, err = runLeaseCmd(cfgFile, "request", "--type", "VLANPool", "-t", "5")
+	assert.Equal(ErrLeaseDuration, err)
+
+	out, err = runLeaseCmd(cfgFile, "extend", l.ID)
+	assert.Nil(err)
+	assert.Contains(out, l.ID)
+
+	_, err = runLeaseCmd(cfgFile, "extend", l.ID, "-t", "5")
+	assert.Equal(ErrLeaseDuration, err)
+
+	out, err = runLeaseCmd(cfgFile, "release", l.ID)
+	assert.Nil(err)
+	assert.Contains(out, l.ID)
+
+	_, err = runLeaseCmd(cfgFile, "release", "unknown")
+	assert.NotNil(err)
+}
+
+func TestParseQuery(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	q, err := parseQuery("color==red")
+	assert.Nil(err)
+	assert.Equal(zebra.Query{Key: "color", Op: zebra.MatchEqual, Values: []string{"red"}}, q)
+
+	q, err = parseQuery("color != red")
+	assert.Nil(err)
+	assert.Equal(zebra.Query{Key: "color", Op: zebra.MatchNotEqual, Values: []string{"red"}}, q)
+
+	q, err = parseQuery("color in red, blue")
+	assert.Nil(err)
+	assert.Equal(zebra.Query{Key: "color", Op: zebra.MatchIn, Values: []string{"red", "blue"}}, q)
+
+	q, err = parseQuery("color notin red,blue")
+	assert.Nil(err)
+	assert.Equal(zebra.Query{Key: "color", Op: zebra.MatchNotIn, Values: []string{"red", "blue"}}, q)
+
+	q, err = parseQuery("model =~ ^a{1,2}")
+	assert.Nil(err)
+	assert.Equal(zebra.Query{Key: "model", Op: zebra.MatchRegex, Values: []string{"^a{1,2}"}}, q)
+
+	q, err = parseQuery("model prefix modelA")
+	assert.Nil(err)
+	assert.Equal(zebra.Query{Key: "model", Op: zebra.MatchPrefix, Values: []string{"modelA"}}, q)
+
+	q, err = parseQuery("rangeStart<10")
+	assert.Nil(err)
+	assert.Equal(zebra.Query{Key: "rangeStart", Op: zebra.MatchLess, Values: []string{"10"}}, q)
+
+	q, err = parseQuery("rangeEnd > 10")
+	assert.Nil(err)
+	assert.Equal(zebra.Query{Key: "rangeEnd", Op: zebra.MatchGreater, Values: []string{"10"}}, q)
+
+	q, err = parseQuery("color exists")
+	assert.Nil(err)
+	assert.Equal(zebra.Query{Key: "color", Op: zebra.MatchExists, Values: nil}, q)
+
+	_, err = parseQuery(" exists")
+	assert.Equal(ErrQuery, err)
+
+	_, err = parseQuery("model =~ (")
+	assert.Equal(ErrQuery, err)
+
+	_, err = parseQuery("color")
+	assert.Equal(ErrQuery, err)
+
+	_, err = parseQuery("==red")
+	assert.Equal(ErrQuery, err)
+
+	_, err = parseQuery("color==red,blue")
+	assert.Equal(ErrQuery, err)
+}
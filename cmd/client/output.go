@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var ErrOutputFormat = errors.New("output format must be one of table, json or yaml")
+
+// table holds the rows of a tabular output.
+type table struct {
+	header []string
+	rows   [][]string
+}
+
+func newTable(header ...string) *table {
+	return &table{
+		header: header,
+		rows:   [][]string{},
+	}
+}
+
+func (t *table) add(row ...string) {
+	t.rows = append(t.rows, row)
+}
+
+func (t *table) write(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0) //nolint:gomnd
+
+	fmt.Fprintln(w, strings.Join(t.header, "\t"))
+
+	for _, row := range t.rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+
+	return w.Flush()
+}
+
+// printOutput prints data in the output format selected by the output flag,
+// either as indented json, as yaml or as the given table.
+func printOutput(cmd *cobra.Command, data interface{}, t *table) error {
+	out := cmd.OutOrStdout()
+
+	switch cmd.Flag("output").Value.String() {
+	case "json":
+		b, e := json.MarshalIndent(data, "", "  ")
+		if e != nil {
+			return e
+		}
+
+		fmt.Fprintln(out, string(b))
+
+		return nil
+	case "yaml":
+		b, e := toYAML(data)
+		if e != nil {
+			return e
+		}
+
+		fmt.Fprint(out, string(b))
+
+		return nil
+	case "table":
+		return t.write(out)
+	default:
+		return ErrOutputFormat
+	}
+}
+
+// toYAML converts data to yaml by way of json, so that the yaml keys are the
+// same as the json keys and the custom json marshalers are honoured.
+func toYAML(data interface{}) ([]byte, error) {
+	b, e := json.Marshal(data)
+	if e != nil {
+		return nil, e
+	}
+
+	var value interface{}
+	if e := json.Unmarshal(b, &value); e != nil {
+		return nil, e
+	}
+
+	return yaml.Marshal(value)
+}
+
+// fromYAML converts yaml data to json, so that it can be unpacked with the
+// custom json unmarshalers.
+func fromYAML(data []byte) ([]byte, error) {
+	var value interface{}
+	if e := yaml.Unmarshal(data, &value); e != nil {
+		return nil, e
+	}
+
+	return json.Marshal(value)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/project-safari/zebra"
+)
+
+var ErrQuery = errors.New(`query must be of the form "key==val", "key!=val", "key in a,b", ` +
+	`"key notin a,b", "key =~ regex", "key prefix val", "key<val", "key>val" or "key exists"`)
+
+// parseQuery parses a query string of the form "key==val", "key!=val",
+// "key in val1,val2", "key notin val1,val2", "key =~ regex",
+// "key prefix val", "key<val", "key>val" or "key exists" into a zebra.Query.
+func parseQuery(q string) (zebra.Query, error) {
+	query := zebra.Query{Key: "", Op: zebra.MatchEqual, Values: nil}
+
+	switch {
+	case strings.HasSuffix(q, " exists"):
+		query.Op = zebra.MatchExists
+		query.Key = strings.TrimSpace(strings.TrimSuffix(q, " exists"))
+
+		if query.Key == "" {
+			return query, ErrQuery
+		}
+
+		return query, nil
+	case strings.Contains(q, "=="):
+		query.Op = zebra.MatchEqual
+		query.Key, q = split(q, "==")
+	case strings.Contains(q, "!="):
+		query.Op = zebra.MatchNotEqual
+		query.Key, q = split(q, "!=")
+	case strings.Contains(q, "=~"):
+		// The regex is taken as is, it may contain commas
+		query.Op = zebra.MatchRegex
+		query.Key, q = split(q, "=~")
+		query.Values = []string{strings.TrimSpace(q)}
+	case strings.Contains(q, " notin "):
+		query.Op = zebra.MatchNotIn
+		query.Key, q = split(q, " notin ")
+	case strings.Contains(q, " in "):
+		query.Op = zebra.MatchIn
+		query.Key, q = split(q, " in ")
+	case strings.Contains(q, " prefix "):
+		query.Op = zebra.MatchPrefix
+		query.Key, q = split(q, " prefix ")
+	case strings.Contains(q, "<"):
+		query.Op = zebra.MatchLess
+		query.Key, q = split(q, "<")
+	case strings.Contains(q, ">"):
+		query.Op = zebra.MatchGreater
+		query.Key, q = split(q, ">")
+	default:
+		return query, ErrQuery
+	}
+
+	if query.Op != zebra.MatchRegex {
+		for _, v := range strings.Split(q, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				query.Values = append(query.Values, v)
+			}
+		}
+	}
+
+	if query.Key == "" || len(query.Values) == 0 || query.Values[0] == "" || query.Validate() != nil {
+		return query, ErrQuery
+	}
+
+	return query, nil
+}
+
+func split(q string, sep string) (string, string) {
+	parts := strings.SplitN(q, sep, 2) //nolint:gomnd
+
+	return strings.TrimSpace(parts[0]), parts[1]
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/project-safari/zebra/usage"
+	"github.com/spf13/cobra"
+)
+
+func NewReport() *cobra.Command {
+	reportCmd := &cobra.Command{ //nolint:exhaustivestruct,exhaustruct
+		Use:          "report",
+		Short:        "show resource utilization by user, group or type",
+		RunE:         showReport,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+	}
+	reportCmd.Flags().String("from", "", "report start in RFC 3339 format (default: 30 days ago)")
+	reportCmd.Flags().String("to", "", "report end in RFC 3339 format (default: now)")
+	reportCmd.Flags().StringP("group-by", "g", usage.GroupByType, "group usage by user, group or type")
+
+	return reportCmd
+}
+
+func showReport(cmd *cobra.Command, args []string) error {
+	c, _, e := newClientFromCmd(cmd)
+	if e != nil {
+		return e
+	}
+
+	values := url.Values{}
+
+	for flag, param := range map[string]string{"from": "from", "to": "to", "group-by": "groupBy"} {
+		if val, _ := cmd.Flags().GetString(flag); val != "" {
+			values.Set(param, val)
+		}
+	}
+
+	report := new(usage.Report)
+	if _, e := c.Get("api/v1/reports/utilization?"+values.Encode(), nil, report); e != nil {
+		return e
+	}
+
+	t := newTable(strings.ToUpper(report.GroupBy), "HOURS", "UTILIZATION", "LEASES", "RESOURCES")
+	for _, r := range report.Rows {
+		t.add(r.Key, hours(r.Hours), utilization(r.Utilization), strconv.Itoa(r.Leases), strconv.Itoa(r.Resources))
+	}
+
+	t.add("TOTAL", hours(report.Hours), utilization(report.Utilization), "", strconv.Itoa(report.Resources))
+
+	if cmd.Flag("output").Value.String() == "table" {
+		out := cmd.OutOrStdout()
+		fmt.Fprintf(out, "%s - %s\n\n", report.From.Format("2006-01-02 15:04"), report.To.Format("2006-01-02 15:04"))
+
+		if e := t.write(out); e != nil {
+			return e
+		}
+
+		fmt.Fprintln(out)
+
+		t = newTable("TOP CONSUMER", "HOURS")
+		for _, c := range report.TopConsumers {
+			t.add(c.User, hours(c.Hours))
+		}
+	}
+
+	return printOutput(cmd, report, t)
+}
+
+func hours(h float64) string {
+	return strconv.FormatFloat(h, 'f', 1, 64)
+}
+
+func utilization(u float64) string {
+	return strconv.FormatFloat(u, 'f', 1, 64) + "%"
+}
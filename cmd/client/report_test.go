@@ -0,0 +1,83 @@
+package main //nolint:testpackage
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra/usage"
+	"github.com/stretchr/testify/assert"
+)
+
+func runReportCmd(cfgFile string, args ...string) (string, error) {
+	out := new(bytes.Buffer)
+	rootCmd := New()
+	rootCmd.SetOut(out)
+	rootCmd.SetArgs(append([]string{"-c", cfgFile, "report"}, args...))
+
+	err := rootCmd.Execute()
+
+	return out.String(), err
+}
+
+func TestReport(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	cfgFile := "./test_report_config.yaml"
+
+	t.Cleanup(func() { os.Remove(cfgFile) })
+
+	now := time.Now()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/reports/utilization", func(rw http.ResponseWriter, req *http.Request) {
+		groupBy := req.URL.Query().Get("groupBy")
+		if groupBy == "color" {
+			rw.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		assert.Equal("2022-06-01T00:00:00Z", req.URL.Query().Get("from"))
+
+		b, e := json.Marshal(&usage.Report{
+			From: now.Add(-time.Hour), To: now, GroupBy: groupBy, Hours: 1.5, Utilization: 37.5, Resources: 4,
+			Rows: []*usage.Row{
+				{Key: "eng", Hours: 1.5, Utilization: 75, Leases: 1, Resources: 2},
+				{Key: "ops", Hours: 0, Utilization: 0, Leases: 0, Resources: 2},
+			},
+			TopConsumers: []usage.Consumer{{User: "thor@asgard.io", Hours: 1.5}},
+		})
+		assert.Nil(e)
+
+		_, e = rw.Write(b)
+		assert.Nil(e)
+	})
+
+	server := httptest.NewServer(mux)
+
+	defer server.Close()
+
+	makeLeaseConfig(assert, cfgFile, server.URL)
+
+	out, err := runReportCmd(cfgFile, "--from", "2022-06-01T00:00:00Z", "-g", "group")
+	assert.Nil(err)
+	assert.Contains(out, "GROUP")
+	assert.Contains(out, "75.0%")
+	assert.Contains(out, "TOTAL")
+	assert.Contains(out, "thor@asgard.io")
+
+	out, err = runReportCmd(cfgFile, "--from", "2022-06-01T00:00:00Z", "-o", "json")
+	assert.Nil(err)
+
+	report := new(usage.Report)
+	assert.Nil(json.Unmarshal([]byte(out), report))
+	assert.Len(report.Rows, 2)
+
+	_, err = runReportCmd(cfgFile, "-g", "color")
+	assert.NotNil(err)
+}
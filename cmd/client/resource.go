@@ -0,0 +1,348 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/query"
+	"github.com/project-safari/zebra/store"
+	"github.com/spf13/cobra"
+)
+
+var ErrNoResourceFile = errors.New("resource file is not specified")
+
+// queryRequest is the body of a resource query, it must match the server
+// QueryRequest.
+type queryRequest struct {
+	IDs        []string      `json:"ids,omitempty"`
+	Types      []string      `json:"types,omitempty"`
+	Labels     []zebra.Query `json:"labels,omitempty"`
+	Properties []zebra.Query `json:"properties,omitempty"`
+	Query      string        `json:"query,omitempty"`
+	Fields     []string      `json:"fields,omitempty"`
+	zebra.PageRequest
+}
+
+// resourcePage is the response to a paged query, it must match the server
+// QueryPage.
+type resourcePage struct {
+	Resources json.RawMessage `json:"resources"`
+	Continue  string          `json:"continue,omitempty"`
+}
+
+func NewResource() *cobra.Command {
+	resourceCmd := &cobra.Command{ //nolint:exhaustivestruct,exhaustruct
+		Use:          "resource",
+		Short:        "query and manage zebra resources",
+		SilenceUsage: true,
+	}
+
+	getCmd := &cobra.Command{ //nolint:exhaustivestruct,exhaustruct
+		Use:          "get",
+		Short:        "query resources",
+		RunE:         getResources,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+	}
+	getCmd.Flags().StringSlice("id", []string{}, "resource ids")
+	getCmd.Flags().StringSlice("type", []string{}, "resource types")
+	getCmd.Flags().StringArray("label", []string{}, `label query, e.g. "system.group==eng"`)
+	getCmd.Flags().StringArray("property", []string{}, `property query, e.g. "name in a,b"`)
+	getCmd.Flags().StringP("query", "q", "", `query expression, e.g. "type == Server and label.color == red"`)
+	getCmd.Flags().Int("limit", 0, "maximum number of resources to return, 0 returns all")
+	getCmd.Flags().String("continue", "", "continue token of the previous page")
+	getCmd.Flags().String("sort", "", `property or label to sort by, e.g. "name" or "label.color"`)
+	getCmd.Flags().Bool("desc", false, "sort in descending order")
+	getCmd.Flags().StringSlice("fields", []string{}, "properties or labels to return")
+	resourceCmd.AddCommand(getCmd)
+
+	applyCmd := &cobra.Command{ //nolint:exhaustivestruct,exhaustruct
+		Use:          "apply",
+		Short:        "create or update resources from a json or yaml file",
+		RunE:         applyResources,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+	}
+	applyCmd.Flags().StringP("file", "f", "", "resource file")
+	resourceCmd.AddCommand(applyCmd)
+
+	deleteCmd := &cobra.Command{ //nolint:exhaustivestruct,exhaustruct
+		Use:          "delete",
+		Short:        "delete resources from a json or yaml file",
+		RunE:         deleteResources,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+	}
+	deleteCmd.Flags().StringP("file", "f", "", "resource file")
+	resourceCmd.AddCommand(deleteCmd)
+
+	return resourceCmd
+}
+
+func getResources(cmd *cobra.Command, args []string) error {
+	c, _, e := newClientFromCmd(cmd)
+	if e != nil {
+		return e
+	}
+
+	qr, e := resourceQuery(cmd)
+	if e != nil {
+		return e
+	}
+
+	if qr.Limit != 0 || qr.Continue != "" || qr.SortBy != "" || qr.Desc || len(qr.Fields) != 0 {
+		return getResourcePage(cmd, c, qr)
+	}
+
+	resMap := zebra.NewResourceMap(store.DefaultFactory())
+	if _, e := c.Get("api/v1/resources", qr, resMap); e != nil {
+		return e
+	}
+
+	return printResources(cmd, resMap)
+}
+
+// getResourcePage gets and prints a page of resources in the server order,
+// the continue token of the next page is printed to stderr in a table.
+func getResourcePage(cmd *cobra.Command, c *Client, qr *queryRequest) error {
+	page := new(resourcePage)
+	if _, e := c.Get("api/v1/resources", qr, page); e != nil {
+		return e
+	}
+
+	var (
+		data interface{}
+		t    *table
+	)
+
+	if len(qr.Fields) != 0 {
+		values := []map[string]interface{}{}
+		if e := json.Unmarshal(page.Resources, &values); e != nil {
+			return e
+		}
+
+		t = newTable(upperAll(qr.Fields)...)
+
+		for _, v := range values {
+			row := make([]string, 0, len(qr.Fields))
+			for _, f := range qr.Fields {
+				row = append(row, fieldString(v[f]))
+			}
+
+			t.add(row...)
+		}
+
+		data = struct {
+			Resources []map[string]interface{} `json:"resources"`
+			Continue  string                   `json:"continue,omitempty"`
+		}{values, page.Continue}
+	} else {
+		resList := zebra.NewResourceList(store.DefaultFactory())
+		if e := json.Unmarshal(page.Resources, resList); e != nil {
+			return e
+		}
+
+		t = newTable("TYPE", "ID", "LABELS", "STATE", "USED BY")
+
+		for _, res := range resList.Resources {
+			status := res.GetStatus()
+			t.add(res.GetType(), res.GetID(), labelString(res.GetLabels()), status.State.String(), status.UsedBy)
+		}
+
+		data = struct {
+			Resources []zebra.Resource `json:"resources"`
+			Continue  string           `json:"continue,omitempty"`
+		}{resList.Resources, page.Continue}
+	}
+
+	if e := printOutput(cmd, data, t); e != nil {
+		return e
+	}
+
+	if page.Continue != "" && cmd.Flag("output").Value.String() == "table" {
+		fmt.Fprintln(cmd.ErrOrStderr(), "continue:", page.Continue)
+	}
+
+	return nil
+}
+
+func resourceQuery(cmd *cobra.Command) (*queryRequest, error) {
+	flags := cmd.Flags()
+	qr := new(queryRequest)
+
+	qr.IDs, _ = flags.GetStringSlice("id")
+	qr.Types, _ = flags.GetStringSlice("type")
+	qr.Query, _ = flags.GetString("query")
+	qr.Limit, _ = flags.GetInt("limit")
+	qr.Continue, _ = flags.GetString("continue")
+	qr.SortBy, _ = flags.GetString("sort")
+	qr.Desc, _ = flags.GetBool("desc")
+	qr.Fields, _ = flags.GetStringSlice("fields")
+
+	// Check the query expression before sending it
+	if qr.Query != "" {
+		if _, e := query.Parse(qr.Query); e != nil {
+			return nil, e
+		}
+	}
+
+	labels, _ := flags.GetStringArray("label")
+	properties, _ := flags.GetStringArray("property")
+
+	for _, l := range labels {
+		q, e := parseQuery(l)
+		if e != nil {
+			return nil, e
+		}
+
+		qr.Labels = append(qr.Labels, q)
+	}
+
+	for _, p := range properties {
+		q, e := parseQuery(p)
+		if e != nil {
+			return nil, e
+		}
+
+		qr.Properties = append(qr.Properties, q)
+	}
+
+	return qr, nil
+}
+
+// applyResources creates or updates the resources, and prints them with the
+// resource versions they have been given by the server.
+func applyResources(cmd *cobra.Command, args []string) error {
+	return sendResources(cmd, func(c *Client, resMap *zebra.ResourceMap) (*zebra.ResourceMap, error) {
+		stored := zebra.NewResourceMap(store.DefaultFactory())
+		_, e := c.Post("api/v1/resources", resMap, stored)
+
+		return stored, e
+	})
+}
+
+func deleteResources(cmd *cobra.Command, args []string) error {
+	return sendResources(cmd, func(c *Client, resMap *zebra.ResourceMap) (*zebra.ResourceMap, error) {
+		_, e := c.Delete("api/v1/resources", resMap, nil)
+
+		return resMap, e
+	})
+}
+
+// sendResources reads the resources from the resource file, sends them to
+// the server and prints the resources returned by send on success.
+func sendResources(cmd *cobra.Command,
+	send func(*Client, *zebra.ResourceMap) (*zebra.ResourceMap, error),
+) error {
+	c, _, e := newClientFromCmd(cmd)
+	if e != nil {
+		return e
+	}
+
+	file, e := cmd.Flags().GetString("file")
+	if e != nil {
+		return e
+	}
+
+	resMap, e := readResources(file)
+	if e != nil {
+		return e
+	}
+
+	resMap, e = send(c, resMap)
+	if e != nil {
+		return e
+	}
+
+	return printResources(cmd, resMap)
+}
+
+// readResources reads a resource map from a json or a yaml file, files with a
+// .yaml or .yml extension are read as yaml.
+func readResources(file string) (*zebra.ResourceMap, error) {
+	if file == "" {
+		return nil, ErrNoResourceFile
+	}
+
+	data, e := ioutil.ReadFile(file)
+	if e != nil {
+		return nil, e
+	}
+
+	if ext := strings.ToLower(filepath.Ext(file)); ext == ".yaml" || ext == ".yml" {
+		if data, e = fromYAML(data); e != nil {
+			return nil, e
+		}
+	}
+
+	resMap := zebra.NewResourceMap(store.DefaultFactory())
+	if e := json.Unmarshal(data, resMap); e != nil {
+		return nil, e
+	}
+
+	return resMap, nil
+}
+
+func printResources(cmd *cobra.Command, resMap *zebra.ResourceMap) error {
+	t := newTable("TYPE", "ID", "LABELS", "STATE", "USED BY")
+
+	types := make([]string, 0, len(resMap.Resources))
+	for resType := range resMap.Resources {
+		types = append(types, resType)
+	}
+
+	sort.Strings(types)
+
+	for _, resType := range types {
+		for _, res := range resMap.Resources[resType].Resources {
+			status := res.GetStatus()
+			t.add(resType, res.GetID(), labelString(res.GetLabels()), status.State.String(), status.UsedBy)
+		}
+	}
+
+	return printOutput(cmd, resMap, t)
+}
+
+func upperAll(values []string) []string {
+	ret := make([]string, 0, len(values))
+	for _, v := range values {
+		ret = append(ret, strings.ToUpper(v))
+	}
+
+	return ret
+}
+
+// fieldString formats a projected field for a table, structured values are
+// written as json.
+func fieldString(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(v)
+
+		return string(b)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func labelString(labels zebra.Labels) string {
+	pairs := make([]string, 0, len(labels))
+
+	for key, val := range labels {
+		pairs = append(pairs, key+"="+val)
+	}
+
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,211 @@
+package main //nolint:testpackage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/network"
+	"github.com/project-safari/zebra/query"
+	"github.com/project-safari/zebra/store"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func makeResourceServer(assert *assert.Assertions, resMap *zebra.ResourceMap) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/v1/resources" {
+			rw.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		switch req.Method {
+		case http.MethodGet:
+			qr := new(queryRequest)
+			assert.Nil(json.NewDecoder(req.Body).Decode(qr))
+
+			if qr.Query != "" {
+				_, e := query.Parse(qr.Query)
+				assert.Nil(e)
+			}
+
+			if len(qr.IDs) != 0 && qr.IDs[0] == "unknown" {
+				rw.WriteHeader(http.StatusBadRequest)
+
+				return
+			}
+
+			var data interface{} = resMap
+
+			if qr.Limit != 0 {
+				data = map[string]interface{}{
+					"resources": resMap.Resources["VLANPool"].Resources,
+					"continue":  "next",
+				}
+			}
+
+			if len(qr.Fields) != 0 {
+				data = map[string]interface{}{
+					"resources": []map[string]interface{}{{"id": "vlan1", "rangeEnd": 10}},
+				}
+			}
+
+			b, e := json.Marshal(data)
+			assert.Nil(e)
+
+			_, e = rw.Write(b)
+			assert.Nil(e)
+		case http.MethodPost, http.MethodDelete:
+			posted := zebra.NewResourceMap(store.DefaultFactory())
+			assert.Nil(json.NewDecoder(req.Body).Decode(posted))
+			assert.Len(posted.Resources["VLANPool"].Resources, 1)
+
+			if req.Method == http.MethodDelete {
+				rw.WriteHeader(http.StatusOK)
+
+				return
+			}
+
+			// Return the resources with a bumped resource version
+			res := posted.Resources["VLANPool"].Resources[0]
+			if res.GetResourceVersion() != 0 {
+				rw.WriteHeader(http.StatusConflict)
+
+				return
+			}
+
+			res.SetResourceVersion(1)
+
+			b, e := json.Marshal(posted)
+			assert.Nil(e)
+
+			_, e = rw.Write(b)
+			assert.Nil(e)
+		}
+	}))
+}
+
+func runResourceCmd(cfgFile string, args ...string) (string, error) {
+	out := new(bytes.Buffer)
+	rootCmd := New()
+	rootCmd.SetOut(out)
+	rootCmd.SetArgs(append([]string{"-c", cfgFile, "resource"}, args...))
+
+	err := rootCmd.Execute()
+
+	return out.String(), err
+}
+
+func TestResource(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	cfgFile := "./test_resource_config.yaml"
+	jsonFile := "./test_resources.json"
+	yamlFile := "./test_resources.yaml"
+
+	t.Cleanup(func() {
+		os.Remove(cfgFile)
+		os.Remove(jsonFile)
+		os.Remove(yamlFile)
+	})
+
+	vlan := &network.VLANPool{
+		BaseResource: *zebra.NewBaseResource("VLANPool", zebra.Labels{"system.group": "eng"}),
+		RangeStart:   0,
+		RangeEnd:     10,
+	}
+	resMap := zebra.NewResourceMap(store.DefaultFactory())
+	resMap.Add(vlan, "VLANPool")
+
+	server := makeResourceServer(assert, resMap)
+
+	defer server.Close()
+
+	makeLeaseConfig(assert, cfgFile, server.URL)
+
+	out, err := runResourceCmd(cfgFile, "get", "--type", "VLANPool", "--label", "system.group==eng")
+	assert.Nil(err)
+	assert.Contains(out, vlan.ID)
+	assert.Contains(out, "system.group=eng")
+
+	out, err = runResourceCmd(cfgFile, "get", "--property", "rangeStart in 0,1", "-o", "yaml")
+	assert.Nil(err)
+	assert.Contains(out, "id: "+vlan.ID)
+
+	out, err = runResourceCmd(cfgFile, "get", "-q", `type == VLANPool and label.system.group exists`)
+	assert.Nil(err)
+	assert.Contains(out, vlan.ID)
+
+	_, err = runResourceCmd(cfgFile, "get", "-q", `type ==`)
+	assert.True(errors.Is(err, query.ErrSyntax))
+
+	out, err = runResourceCmd(cfgFile, "get", "--limit", "1", "--sort", "label.system.group", "--desc")
+	assert.Nil(err)
+	assert.Contains(out, vlan.ID)
+
+	out, err = runResourceCmd(cfgFile, "get", "--limit", "1", "-o", "json")
+	assert.Nil(err)
+	assert.Contains(out, `"continue": "next"`)
+
+	out, err = runResourceCmd(cfgFile, "get", "--fields", "id,rangeEnd")
+	assert.Nil(err)
+	assert.Contains(out, "RANGEEND")
+	assert.Contains(out, "vlan1")
+
+	_, err = runResourceCmd(cfgFile, "get", "--label", "system.group")
+	assert.Equal(ErrQuery, err)
+
+	_, err = runResourceCmd(cfgFile, "get", "--property", "name")
+	assert.Equal(ErrQuery, err)
+
+	_, err = runResourceCmd(cfgFile, "get", "--id", "unknown")
+	assert.NotNil(err)
+
+	data, err := json.Marshal(resMap)
+	assert.Nil(err)
+	assert.Nil(ioutil.WriteFile(jsonFile, data, ReadOnly))
+
+	yamlData, err := toYAML(resMap)
+	assert.Nil(err)
+	assert.Nil(ioutil.WriteFile(yamlFile, yamlData, ReadOnly))
+
+	out, err = runResourceCmd(cfgFile, "apply", "-f", jsonFile, "-o", "json")
+	assert.Nil(err)
+	assert.Contains(out, vlan.ID)
+	assert.Contains(out, `"resourceVersion": 1`)
+
+	vlan.ResourceVersion = 5
+	data, err = json.Marshal(resMap)
+	assert.Nil(err)
+	assert.Nil(ioutil.WriteFile(jsonFile, data, ReadOnly))
+
+	_, err = runResourceCmd(cfgFile, "apply", "-f", jsonFile)
+	assert.NotNil(err)
+
+	out, err = runResourceCmd(cfgFile, "delete", "-f", yamlFile, "-o", "json")
+	assert.Nil(err)
+	assert.Contains(out, vlan.ID)
+
+	_, err = runResourceCmd(cfgFile, "apply")
+	assert.Equal(ErrNoResourceFile, err)
+
+	_, err = runResourceCmd(cfgFile, "delete", "-f", "./no_such_file.json")
+	assert.NotNil(err)
+
+	assert.Nil(ioutil.WriteFile(yamlFile, []byte("VLANPool: ["), ReadOnly))
+
+	_, err = runResourceCmd(cfgFile, "apply", "-f", yamlFile)
+	assert.NotNil(err)
+
+	value := map[string]interface{}{}
+	assert.Nil(yaml.Unmarshal(yamlData, &value))
+	assert.Contains(value, "VLANPool")
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/spf13/cobra"
+)
+
+type roleRequest struct {
+	auth.Role
+	Labels zebra.Labels `json:"labels,omitempty"`
+}
+
+func NewRole() *cobra.Command {
+	roleCmd := &cobra.Command{ //nolint:exhaustivestruct,exhaustruct
+		Use:          "role",
+		Short:        "manage zebra user roles",
+		RunE:         listRoles,
+		SilenceUsage: true,
+	}
+
+	roleCmd.AddCommand(&cobra.Command{ //nolint:exhaustivestruct,exhaustruct
+		Use:          "list",
+		Short:        "list roles",
+		RunE:         listRoles,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+	})
+
+	roleCmd.AddCommand(&cobra.Command{ //nolint:exhaustivestruct,exhaustruct
+		Use:          "show",
+		Short:        "show a role and its users",
+		RunE:         showRole,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+	})
+
+	createCmd := &cobra.Command{ //nolint:exhaustivestruct,exhaustruct
+		Use:          "create",
+		Short:        "create a role",
+		RunE:         createRole,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+	}
+	roleFlags(createCmd)
+	roleCmd.AddCommand(createCmd)
+
+	updateCmd := &cobra.Command{ //nolint:exhaustivestruct,exhaustruct
+		Use:          "update",
+		Short:        "replace the privileges of a role",
+		RunE:         updateRole,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+	}
+	roleFlags(updateCmd)
+	roleCmd.AddCommand(updateCmd)
+
+	roleCmd.AddCommand(&cobra.Command{ //nolint:exhaustivestruct,exhaustruct
+		Use:          "delete",
+		Short:        "delete a role, its users are bound to the default role",
+		RunE:         deleteRole,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+	})
+
+	roleCmd.AddCommand(&cobra.Command{ //nolint:exhaustivestruct,exhaustruct
+		Use:          "bind",
+		Short:        "bind a user to a role",
+		RunE:         bindRole,
+		Args:         cobra.ExactArgs(2), //nolint:gomnd
+		SilenceUsage: true,
+	})
+
+	roleCmd.AddCommand(&cobra.Command{ //nolint:exhaustivestruct,exhaustruct
+		Use:          "unbind",
+		Short:        "bind a user of a role to the default role",
+		RunE:         unbindRole,
+		Args:         cobra.ExactArgs(2), //nolint:gomnd
+		SilenceUsage: true,
+	})
+
+	return roleCmd
+}
+
+func roleFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArray("priv", []string{}, `privilege, e.g. "Server/eng:c,r,u,d"`)
+	cmd.Flags().Int("priority", 0, "role priority")
+	cmd.Flags().String("group", "", "role group (system.group label)")
+	_ = cmd.MarkFlagRequired("priv")
+}
+
+func roleReq(cmd *cobra.Command, name string) (*roleRequest, error) {
+	flags := cmd.Flags()
+	rr := &roleRequest{
+		Role:   auth.Role{Name: name, Privileges: []*auth.Priv{}, Priority: 0},
+		Labels: zebra.Labels{},
+	}
+
+	rr.Priority, _ = flags.GetInt("priority")
+
+	if group, _ := flags.GetString("group"); group != "" {
+		rr.Labels.Add("system.group", group)
+	}
+
+	privs, e := flags.GetStringArray("priv")
+	if e != nil {
+		return nil, e
+	}
+
+	for _, p := range privs {
+		priv := new(auth.Priv)
+		if e := priv.UnmarshalText([]byte(p)); e != nil {
+			return nil, e
+		}
+
+		rr.Privileges = append(rr.Privileges, priv)
+	}
+
+	return rr, nil
+}
+
+func listRoles(cmd *cobra.Command, args []string) error {
+	c, _, e := newClientFromCmd(cmd)
+	if e != nil {
+		return e
+	}
+
+	roleRes := &struct {
+		Roles []*auth.RoleResource `json:"roles"`
+	}{}
+
+	if _, e := c.Get("api/v1/roles", nil, roleRes); e != nil {
+		return e
+	}
+
+	return printRoles(cmd, roleRes.Roles)
+}
+
+func showRole(cmd *cobra.Command, args []string) error {
+	c, _, e := newClientFromCmd(cmd)
+	if e != nil {
+		return e
+	}
+
+	role := new(auth.RoleResource)
+	if _, e := c.Get(rolePath(args[0]), nil, role); e != nil {
+		return e
+	}
+
+	usersRes := &struct {
+		Users []string `json:"users"`
+	}{}
+
+	if _, e := c.Get(rolePath(args[0])+"/users", nil, usersRes); e != nil {
+		return e
+	}
+
+	t := newTable("USER")
+	for _, u := range usersRes.Users {
+		t.add(u)
+	}
+
+	if cmd.Flag("output").Value.String() == "table" {
+		if e := printRoles(cmd, []*auth.RoleResource{role}); e != nil {
+			return e
+		}
+
+		fmt.Fprintln(cmd.OutOrStdout())
+	}
+
+	return printOutput(cmd, &struct {
+		*auth.RoleResource
+		Users []string `json:"users"`
+	}{RoleResource: role, Users: usersRes.Users}, t)
+}
+
+func createRole(cmd *cobra.Command, args []string) error {
+	return sendRole(cmd, args[0], func(c *Client, rr *roleRequest, role *auth.RoleResource) error {
+		_, e := c.Post("api/v1/roles", rr, role)
+
+		return e
+	})
+}
+
+func updateRole(cmd *cobra.Command, args []string) error {
+	return sendRole(cmd, args[0], func(c *Client, rr *roleRequest, role *auth.RoleResource) error {
+		_, e := c.Put(rolePath(rr.Name), rr, role)
+
+		return e
+	})
+}
+
+func sendRole(cmd *cobra.Command, name string,
+	send func(*Client, *roleRequest, *auth.RoleResource) error,
+) error {
+	c, _, e := newClientFromCmd(cmd)
+	if e != nil {
+		return e
+	}
+
+	rr, e := roleReq(cmd, name)
+	if e != nil {
+		return e
+	}
+
+	role := new(auth.RoleResource)
+	if e := send(c, rr, role); e != nil {
+		return e
+	}
+
+	return printRoles(cmd, []*auth.RoleResource{role})
+}
+
+func deleteRole(cmd *cobra.Command, args []string) error {
+	c, _, e := newClientFromCmd(cmd)
+	if e != nil {
+		return e
+	}
+
+	_, e = c.Delete(rolePath(args[0]), nil, nil)
+
+	return e
+}
+
+func bindRole(cmd *cobra.Command, args []string) error {
+	c, _, e := newClientFromCmd(cmd)
+	if e != nil {
+		return e
+	}
+
+	bindReq := &struct {
+		Email string `json:"email"`
+	}{Email: args[1]}
+
+	_, e = c.Post(rolePath(args[0])+"/users", bindReq, nil)
+
+	return e
+}
+
+func unbindRole(cmd *cobra.Command, args []string) error {
+	c, _, e := newClientFromCmd(cmd)
+	if e != nil {
+		return e
+	}
+
+	_, e = c.Delete(rolePath(args[0])+"/users/"+url.PathEscape(args[1]), nil, nil)
+
+	return e
+}
+
+func rolePath(name string) string {
+	return "api/v1/roles/" + url.PathEscape(name)
+}
+
+func printRoles(cmd *cobra.Command, roles []*auth.RoleResource) error {
+	t := newTable("NAME", "GROUP", "PRIORITY", "PRIVILEGES")
+
+	for _, r := range roles {
+		privs := make([]string, 0, len(r.Privileges))
+
+		for _, p := range r.Privileges {
+			privs = append(privs, p.String())
+		}
+
+		t.add(r.Name, r.Labels["system.group"], strconv.Itoa(r.Priority), strings.Join(privs, " "))
+	}
+
+	return printOutput(cmd, roles, t)
+}
@@ -0,0 +1,148 @@
+package main //nolint:testpackage
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeRoleServer(assert *assert.Assertions, role *auth.RoleResource) *httptest.Server {
+	mux := http.NewServeMux()
+
+	writeRole := func(rw http.ResponseWriter, status int, data interface{}) {
+		b, e := json.Marshal(data)
+		assert.Nil(e)
+
+		rw.WriteHeader(status)
+		_, e = rw.Write(b)
+		assert.Nil(e)
+	}
+
+	mux.HandleFunc("/api/v1/roles", func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodPost {
+			rr := new(roleRequest)
+			assert.Nil(json.NewDecoder(req.Body).Decode(rr))
+			assert.Equal(role.Name, rr.Name)
+			assert.Equal("eng", rr.Labels["system.group"])
+			assert.True(rr.Read("Server/eng"))
+			writeRole(rw, http.StatusCreated, role)
+
+			return
+		}
+
+		writeRole(rw, http.StatusOK, map[string][]*auth.RoleResource{"roles": {role}})
+	})
+
+	mux.HandleFunc("/api/v1/roles/eng", func(rw http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodPut:
+			rr := new(roleRequest)
+			assert.Nil(json.NewDecoder(req.Body).Decode(rr))
+			assert.Equal(2, rr.Priority)
+			writeRole(rw, http.StatusOK, role)
+		case http.MethodDelete:
+			rw.WriteHeader(http.StatusOK)
+		default:
+			writeRole(rw, http.StatusOK, role)
+		}
+	})
+
+	mux.HandleFunc("/api/v1/roles/eng/users", func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodPost {
+			bindReq := &struct {
+				Email string `json:"email"`
+			}{}
+			assert.Nil(json.NewDecoder(req.Body).Decode(bindReq))
+			assert.Equal("loki@asgard.io", bindReq.Email)
+			rw.WriteHeader(http.StatusOK)
+
+			return
+		}
+
+		writeRole(rw, http.StatusOK, map[string][]string{"users": {"loki@asgard.io"}})
+	})
+
+	mux.HandleFunc("/api/v1/roles/eng/users/loki@asgard.io", func(rw http.ResponseWriter, req *http.Request) {
+		assert.Equal(http.MethodDelete, req.Method)
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func runRoleCmd(cfgFile string, args ...string) (string, error) {
+	out := new(bytes.Buffer)
+	rootCmd := New()
+	rootCmd.SetOut(out)
+	rootCmd.SetArgs(append([]string{"-c", cfgFile, "role"}, args...))
+
+	err := rootCmd.Execute()
+
+	return out.String(), err
+}
+
+func TestRole(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	cfgFile := "./test_role_config.yaml"
+
+	t.Cleanup(func() { os.Remove(cfgFile) })
+
+	read, e := auth.NewPriv("Server/eng", false, true, false, false)
+	assert.Nil(e)
+
+	role := auth.NewRoleResource(&auth.Role{Name: "eng", Privileges: []*auth.Priv{read}, Priority: 1},
+		zebra.Labels{"system.group": "eng"})
+	server := makeRoleServer(assert, role)
+
+	defer server.Close()
+
+	makeLeaseConfig(assert, cfgFile, server.URL)
+
+	out, err := runRoleCmd(cfgFile)
+	assert.Nil(err)
+	assert.Contains(out, "Server/eng:r")
+
+	out, err = runRoleCmd(cfgFile, "list", "-o", "json")
+	assert.Nil(err)
+
+	roles := []map[string]interface{}{}
+	assert.Nil(json.Unmarshal([]byte(out), &roles))
+	assert.Len(roles, 1)
+	assert.Equal("eng", roles[0]["name"])
+
+	out, err = runRoleCmd(cfgFile, "show", "eng")
+	assert.Nil(err)
+	assert.Contains(out, "Server/eng:r")
+	assert.Contains(out, "loki@asgard.io")
+
+	out, err = runRoleCmd(cfgFile, "create", "eng", "--priv", "Server/eng:r", "--group", "eng")
+	assert.Nil(err)
+	assert.Contains(out, "eng")
+
+	_, err = runRoleCmd(cfgFile, "create", "eng", "--priv", "Server/eng")
+	assert.Equal(auth.ErrResourceKeyEmpty, err)
+
+	_, err = runRoleCmd(cfgFile, "update", "eng", "--priv", "Server/eng:r,u", "--priority", "2")
+	assert.Nil(err)
+
+	_, err = runRoleCmd(cfgFile, "bind", "eng", "loki@asgard.io")
+	assert.Nil(err)
+
+	_, err = runRoleCmd(cfgFile, "unbind", "eng", "loki@asgard.io")
+	assert.Nil(err)
+
+	_, err = runRoleCmd(cfgFile, "delete", "eng")
+	assert.Nil(err)
+
+	_, err = runRoleCmd(cfgFile, "delete", "ops")
+	assert.NotNil(err)
+}
@@ -24,8 +24,16 @@ func New() *cobra.Command {
 		"config file",
 	)
 	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "verbose output")
+	rootCmd.PersistentFlags().StringP("output", "o", "table", "output format: table, json or yaml")
 
 	rootCmd.AddCommand(NewConfigure())
+	rootCmd.AddCommand(NewLease())
+	rootCmd.AddCommand(NewResource())
+	rootCmd.AddCommand(NewRole())
+	rootCmd.AddCommand(NewReport())
+	rootCmd.AddCommand(NewRegister())
+	rootCmd.AddCommand(NewLogin())
+	rootCmd.AddCommand(NewWhoami())
 
 	return rootCmd
 }
@@ -2,18 +2,31 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"net/http"
+	"path/filepath"
+	"strings"
 
 	"github.com/go-logr/logr"
 	"github.com/julienschmidt/httprouter"
 	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/audit"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/lease"
+	"github.com/project-safari/zebra/query"
 	"github.com/project-safari/zebra/store"
+	"github.com/project-safari/zebra/usage"
 )
 
 type ResourceAPI struct {
-	factory zebra.ResourceFactory
-	Store   zebra.Store
+	factory   zebra.ResourceFactory
+	Backend   string
+	Store     zebra.Store
+	Allocator *lease.Allocator
+	Audit     *audit.Log
+	Usage     *usage.Log
+	Metrics   *Metrics
 }
 
 type QueryRequest struct {
@@ -21,40 +34,195 @@ type QueryRequest struct {
 	Types      []string      `json:"types,omitempty"`
 	Labels     []zebra.Query `json:"labels,omitempty"`
 	Properties []zebra.Query `json:"properties,omitempty"`
+	Query      string        `json:"query,omitempty"`
+	Fields     []string      `json:"fields,omitempty"`
+	zebra.PageRequest
+	expr query.Expr
+}
+
+// QueryPage is the response to a query request that asks for a page, a sort
+// order or a fields projection.
+type QueryPage struct {
+	Resources []interface{} `json:"resources"`
+	Continue  string        `json:"continue,omitempty"`
 }
 
 var ErrQueryRequest = errors.New("invalid GET query request body")
 
 func (qr *QueryRequest) Validate(ctx context.Context) error {
-	id := len(qr.IDs) != 0
-	t := len(qr.Types) != 0
-	l := len(qr.Labels) != 0
-	p := len(qr.Properties) != 0
+	// Make sure ids and types are not both present, labels, properties and
+	// the query expression can filter either of them.
+	if len(qr.IDs) != 0 && len(qr.Types) != 0 {
+		return ErrQueryRequest
+	}
 
-	// Make sure only id (and labels), types (and labels), or labels are present
-	if (id && (t || p)) || (p && (t || l)) {
+	if qr.Limit < 0 {
 		return ErrQueryRequest
 	}
 
+	for _, f := range qr.Fields {
+		if f == "" {
+			return ErrQueryRequest
+		}
+	}
+
 	// Check Labels queries are valid
 	if err := validateQueries(qr.Labels); err != nil {
 		return err
 	}
 
 	// Check Properties queries are valid
-	return validateQueries(qr.Properties)
+	if err := validateQueries(qr.Properties); err != nil {
+		return err
+	}
+
+	// Parse the query expression, if any
+	if qr.Query != "" {
+		expr, err := query.Parse(qr.Query)
+		if err != nil {
+			return err
+		}
+
+		qr.expr = expr
+	}
+
+	return nil
+}
+
+// paged returns true if the query request asks for a page, a sort order or a
+// fields projection rather than the whole resource map.
+func (qr *QueryRequest) paged() bool {
+	return qr.Limit != 0 || qr.Continue != "" || qr.SortBy != "" || qr.Desc || len(qr.Fields) != 0
+}
+
+// match returns the function matching the resources selected by the query
+// request, the first label query must find the label unless ids or types are
+// given, the same as a label store query.
+func (qr *QueryRequest) match() func(zebra.Resource) bool {
+	return func(res zebra.Resource) bool {
+		if len(qr.IDs) != 0 && !zebra.IsIn(res.GetID(), qr.IDs) {
+			return false
+		}
+
+		if len(qr.Types) != 0 && !zebra.IsIn(res.GetType(), qr.Types) {
+			return false
+		}
+
+		for i, q := range qr.Labels {
+			val, ok := res.GetLabels()[q.Key]
+			if i == 0 && !ok && len(qr.IDs) == 0 && len(qr.Types) == 0 {
+				return false
+			}
+
+			if !q.Match(val, ok) {
+				return false
+			}
+		}
+
+		for _, q := range qr.Properties {
+			if !store.MatchProperty(q, res) {
+				return false
+			}
+		}
+
+		return qr.expr == nil || qr.expr.Match(res)
+	}
+}
+
+// project returns the given fields of the resource, nested fields are
+// separated by dots and labels are prefixed with "label.".
+func project(res zebra.Resource, fields []string) (map[string]interface{}, error) {
+	b, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+
+	all := map[string]interface{}{}
+	if err := json.Unmarshal(b, &all); err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string]interface{}, len(fields))
+
+	for _, f := range fields {
+		path := strings.Split(f, ".")
+		if strings.HasPrefix(strings.ToLower(f), store.LabelPrefix) {
+			path = []string{"labels", f[len(store.LabelPrefix):]}
+		}
+
+		if val, ok := lookupField(all, path); ok {
+			ret[f] = val
+		}
+	}
+
+	return ret, nil
+}
+
+// lookupField returns the value at the path, keys are matched ignoring case.
+func lookupField(val interface{}, path []string) (interface{}, bool) {
+	for _, key := range path {
+		m, ok := val.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		if val, ok = m[key]; ok {
+			continue
+		}
+
+		for k, v := range m {
+			if strings.EqualFold(k, key) {
+				val, ok = v, true
+
+				break
+			}
+		}
+
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return val, true
 }
 
 func NewResourceAPI(factory zebra.ResourceFactory) *ResourceAPI {
 	return &ResourceAPI{
-		factory: factory,
-		Store:   nil,
+		factory:   factory,
+		Backend:   store.FileBackend,
+		Store:     nil,
+		Allocator: nil,
+		Audit:     nil,
+		Usage:     nil,
+		Metrics:   nil,
 	}
 }
 
-// Set up store and query store given storage root.
+// Set up store of the API backend, query store, audit log, usage log and
+// metrics given storage root.
 func (api *ResourceAPI) Initialize(storageRoot string) error {
-	api.Store = store.NewResourceStore(storageRoot, api.factory)
+	resStore, err := store.NewBackend(api.Backend, storageRoot, api.factory)
+	if err != nil {
+		return err
+	}
+
+	api.Metrics = NewMetrics()
+	resStore.RecordLatency(api.Metrics.storeLatency)
+	api.Store = resStore
+	api.Allocator = lease.NewAllocator(api.Store)
+	api.Audit = audit.NewLog(filepath.Join(storageRoot, "audit", "audit.log"))
+
+	api.Usage = usage.NewLog(filepath.Join(storageRoot, "usage", "usage.log"))
+
+	if err := api.Audit.Initialize(); err != nil {
+		return err
+	}
+
+	if err := api.Usage.Initialize(); err != nil {
+		return err
+	}
+
+	api.Allocator.RecordUsage(api.Usage)
 
 	return api.Store.Initialize()
 }
@@ -84,11 +252,16 @@ func validateQueries(queries []zebra.Query) error {
 	return nil
 }
 
-// Validate all resources in a resource map.
+// Validate all resources in a resource map, roles and users are not valid
+// resources api resources.
 func validateResources(ctx context.Context, resMap *zebra.ResourceMap) error {
 	// Check all resources to make sure they are valid
 	for _, l := range resMap.Resources {
 		for _, r := range l.Resources {
+			if managedType(r) {
+				return ErrManagedType
+			}
+
 			if err := r.Validate(ctx); err != nil {
 				return err
 			}
@@ -102,7 +275,7 @@ func handleQuery() httprouter.Handle {
 	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 		ctx := req.Context()
 		log := logr.FromContextOrDiscard(ctx)
-		api, ok := ctx.Value(ResourcesCtxKey).(*ResourceAPI)
+		api, claims, ok := apiContext(ctx)
 
 		if !ok {
 			res.WriteHeader(http.StatusInternalServerError)
@@ -128,9 +301,15 @@ func handleQuery() httprouter.Handle {
 			return
 		}
 
+		if qr.paged() {
+			handleQueryPage(ctx, res, api, claims, qr)
+
+			return
+		}
+
 		var resources *zebra.ResourceMap
 
-		// Get resources based on primary key (ID, Type, or Label)
+		// Get resources based on primary key (ID, Type, Label or Property)
 		switch {
 		case len(qr.IDs) != 0:
 			resources = api.Store.QueryUUID(qr.IDs)
@@ -141,6 +320,18 @@ func handleQuery() httprouter.Handle {
 			qr.Labels = qr.Labels[1:]
 			// Can safely ignore error because we have already validated the query
 			resources, _ = api.Store.QueryLabel(q)
+		case len(qr.Properties) != 0:
+			q := qr.Properties[0]
+			qr.Properties = qr.Properties[1:]
+
+			var err error
+
+			if resources, err = api.Store.QueryProperty(q); err != nil {
+				res.WriteHeader(http.StatusInternalServerError)
+				log.Error(err, "internal server error while querying resources")
+
+				return
+			}
 		default:
 			resources = api.Store.Query()
 		}
@@ -151,6 +342,20 @@ func handleQuery() httprouter.Handle {
 			resources, _ = store.FilterLabel(q, resources)
 		}
 
+		// Filter further based on property queries
+		for _, q := range qr.Properties {
+			// Can safely ignore error because we have already validated the query
+			resources, _ = store.FilterProperty(q, resources)
+		}
+
+		// Filter further based on the query expression
+		if qr.expr != nil {
+			resources = query.Filter(qr.expr, resources)
+		}
+
+		// Return only the resources the caller can read
+		resources = filterReadable(claims, resources)
+
 		log.Info("successfully queried resources")
 
 		// Write response body
@@ -158,11 +363,59 @@ func handleQuery() httprouter.Handle {
 	}
 }
 
+// handleQueryPage writes a page of the resources matching the query request.
+func handleQueryPage(ctx context.Context, res http.ResponseWriter, api *ResourceAPI,
+	claims *auth.Claims, qr *QueryRequest,
+) {
+	log := logr.FromContextOrDiscard(ctx)
+	match := qr.match()
+
+	// Only the resources the caller can read are paged
+	page, err := api.Store.QueryPage(func(r zebra.Resource) bool {
+		return match(r) && canRead(claims, r)
+	}, qr.PageRequest)
+	if errors.Is(err, zebra.ErrInvalidPage) {
+		res.WriteHeader(http.StatusBadRequest)
+		log.Info("resources could not be queried, invalid page request")
+
+		return
+	} else if err != nil {
+		res.WriteHeader(http.StatusInternalServerError)
+		log.Error(err, "internal server error while querying resources")
+
+		return
+	}
+
+	resp := &QueryPage{Resources: make([]interface{}, 0, len(page.Resources)), Continue: page.Continue}
+
+	for _, r := range page.Resources {
+		if len(qr.Fields) == 0 {
+			resp.Resources = append(resp.Resources, r)
+
+			continue
+		}
+
+		fields, err := project(r, qr.Fields)
+		if err != nil {
+			res.WriteHeader(http.StatusInternalServerError)
+			log.Error(err, "internal server error while projecting resources")
+
+			return
+		}
+
+		resp.Resources = append(resp.Resources, fields)
+	}
+
+	log.Info("successfully queried resources")
+
+	writeJSON(ctx, res, resp)
+}
+
 func handlePost() httprouter.Handle {
 	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 		ctx := req.Context()
 		log := logr.FromContextOrDiscard(ctx)
-		api, ok := ctx.Value(ResourcesCtxKey).(*ResourceAPI)
+		api, claims, ok := apiContext(ctx)
 
 		if !ok {
 			res.WriteHeader(http.StatusInternalServerError)
@@ -187,8 +440,23 @@ func handlePost() httprouter.Handle {
 			return
 		}
 
-		// Add all resources to store
-		if applyFunc(resMap, api.Store.Create) != nil {
+		// The caller must be allowed to create or update all resources
+		if ids := forbiddenIDs(resMap, func(r zebra.Resource) bool {
+			return canWrite(api, claims, r)
+		}); len(ids) != 0 {
+			writeForbidden(ctx, res, claims, ids)
+
+			return
+		}
+
+		// Add all resources to store, either all of them or none
+		txn := beginAudited(ctx, api)
+		if err := commitAll(txn, resMap, txn.Create); errors.Is(err, zebra.ErrConflict) {
+			res.WriteHeader(http.StatusConflict)
+			log.Info("resources could not be created, stale resource version")
+
+			return
+		} else if err != nil {
 			res.WriteHeader(http.StatusInternalServerError)
 			log.Info("internal server error while creating resources")
 
@@ -197,7 +465,8 @@ func handlePost() httprouter.Handle {
 
 		log.Info("successfully created resources")
 
-		res.WriteHeader(http.StatusOK)
+		// Return the resources with their new resource versions
+		writeJSON(ctx, res, resMap)
 	}
 }
 
@@ -205,7 +474,7 @@ func handleDelete() httprouter.Handle {
 	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 		ctx := req.Context()
 		log := logr.FromContextOrDiscard(ctx)
-		api, ok := ctx.Value(ResourcesCtxKey).(*ResourceAPI)
+		api, claims, ok := apiContext(ctx)
 
 		if !ok {
 			res.WriteHeader(http.StatusInternalServerError)
@@ -230,8 +499,23 @@ func handleDelete() httprouter.Handle {
 			return
 		}
 
-		// Delete all resources from store
-		if applyFunc(resMap, api.Store.Delete) != nil {
+		// The caller must be allowed to delete all resources
+		if ids := forbiddenIDs(resMap, func(r zebra.Resource) bool {
+			return canDelete(api, claims, r)
+		}); len(ids) != 0 {
+			writeForbidden(ctx, res, claims, ids)
+
+			return
+		}
+
+		// Delete all resources from store, either all of them or none
+		txn := beginAudited(ctx, api)
+		if err := commitAll(txn, resMap, txn.Delete); errors.Is(err, zebra.ErrConflict) {
+			res.WriteHeader(http.StatusConflict)
+			log.Info("resources could not be deleted, stale resource version")
+
+			return
+		} else if err != nil {
 			res.WriteHeader(http.StatusInternalServerError)
 			log.Info("internal server error while deleting resources")
 
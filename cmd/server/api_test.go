@@ -4,14 +4,18 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
 
+	"github.com/julienschmidt/httprouter"
 	"github.com/project-safari/zebra"
 	"github.com/project-safari/zebra/cmd/herd/pkg"
+	"github.com/project-safari/zebra/compute"
 	"github.com/project-safari/zebra/dc"
 	"github.com/project-safari/zebra/network"
 	"github.com/project-safari/zebra/store"
@@ -19,7 +23,7 @@ import (
 )
 
 func makeQueryRequest(assert *assert.Assertions, resources *ResourceAPI, q *QueryRequest) *http.Request {
-	ctx := context.WithValue(context.Background(), ResourcesCtxKey, resources)
+	ctx := adminContext(context.Background(), resources)
 	req, err := http.NewRequestWithContext(ctx, "GET", "/api/v1/resources", nil)
 	assert.Nil(err)
 	assert.NotNil(req)
@@ -76,6 +80,170 @@ func TestQuery(t *testing.T) {
 	assert.Equal(rr.Code, http.StatusOK)
 }
 
+func TestPropertyQuery(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testpropertyquery"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	api := NewResourceAPI(store.DefaultFactory())
+	assert.Nil(api.Initialize(root))
+
+	red := zebra.Labels{"system.group": "eng", "color": "red"}
+	blue := zebra.Labels{"system.group": "eng", "color": "blue"}
+	s1 := compute.NewServer([]string{"sn1", "modelA", "s1"}, net.ParseIP("10.1.0.1"), red)
+	s2 := compute.NewServer([]string{"sn2", "modelA", "s2"}, net.ParseIP("10.2.0.1"), blue)
+	s3 := compute.NewServer([]string{"sn3", "modelB", "s3"}, net.ParseIP("10.1.0.2"), red)
+
+	for _, s := range []*compute.Server{s1, s2, s3} {
+		assert.Nil(api.Store.Create(s))
+	}
+
+	h := handleQuery()
+	query := func(qr *QueryRequest) []string {
+		rr := httptest.NewRecorder()
+		h(rr, makeQueryRequest(assert, api, qr), nil)
+		assert.Equal(http.StatusOK, rr.Code)
+
+		resMap := zebra.NewResourceMap(store.DefaultFactory())
+		assert.Nil(json.Unmarshal(rr.Body.Bytes(), resMap))
+
+		ids := []string{}
+
+		for _, l := range resMap.Resources {
+			for _, r := range l.Resources {
+				ids = append(ids, r.GetID())
+			}
+		}
+
+		return ids
+	}
+
+	modelA := zebra.Query{Op: zebra.MatchEqual, Key: "Model", Values: []string{"modelA"}}
+	subnet := zebra.Query{Op: zebra.MatchIn, Key: "BoardIP", Values: []string{"10.1.0.0/16"}}
+	isRed := zebra.Query{Op: zebra.MatchEqual, Key: "color", Values: []string{"red"}}
+
+	// Property query alone
+	assert.ElementsMatch([]string{s1.ID, s2.ID}, query(&QueryRequest{Properties: []zebra.Query{modelA}}))
+
+	// Several property queries
+	qr := &QueryRequest{Properties: []zebra.Query{modelA, subnet}}
+	assert.ElementsMatch([]string{s1.ID}, query(qr))
+
+	// Property queries filter types and labels
+	qr = &QueryRequest{Types: []string{"Server"}, Properties: []zebra.Query{subnet}}
+	assert.ElementsMatch([]string{s1.ID, s3.ID}, query(qr))
+
+	qr = &QueryRequest{Labels: []zebra.Query{isRed}, Properties: []zebra.Query{modelA}}
+	assert.ElementsMatch([]string{s1.ID}, query(qr))
+
+	// Nested properties
+	names := zebra.Query{Op: zebra.MatchNotIn, Key: "Credentials.Name", Values: []string{"s1", "s3"}}
+	qr = &QueryRequest{Properties: []zebra.Query{names}}
+	assert.ElementsMatch([]string{s2.ID}, query(qr))
+
+	// Query expressions
+	qr = &QueryRequest{Query: `label.color == blue or (model =~ "^modelA" and boardIP in 10.1.0.0/16)`}
+	assert.ElementsMatch([]string{s1.ID, s2.ID}, query(qr))
+
+	qr = &QueryRequest{Types: []string{"Server"}, Query: `not model prefix modelA`}
+	assert.ElementsMatch([]string{s3.ID}, query(qr))
+
+	rr := httptest.NewRecorder()
+	h(rr, makeQueryRequest(assert, api, &QueryRequest{Query: `model ==`}), nil)
+	assert.Equal(http.StatusBadRequest, rr.Code)
+}
+
+func TestQueryPage(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testquerypage"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	api := NewResourceAPI(store.DefaultFactory())
+	assert.Nil(api.Initialize(root))
+
+	red := zebra.Labels{"system.group": "eng", "color": "red"}
+	blue := zebra.Labels{"system.group": "eng", "color": "blue"}
+	s1 := compute.NewServer([]string{"sn1", "modelC", "s1"}, net.ParseIP("10.1.0.1"), red)
+	s2 := compute.NewServer([]string{"sn2", "modelA", "s2"}, net.ParseIP("10.2.0.1"), blue)
+	s3 := compute.NewServer([]string{"sn3", "modelB", "s3"}, net.ParseIP("10.1.0.2"), red)
+
+	for _, s := range []*compute.Server{s1, s2, s3} {
+		assert.Nil(api.Store.Create(s))
+	}
+
+	h := handleQuery()
+	query := func(qr *QueryRequest) *QueryPage {
+		rr := httptest.NewRecorder()
+		h(rr, makeQueryRequest(assert, api, qr), nil)
+		assert.Equal(http.StatusOK, rr.Code)
+
+		page := new(QueryPage)
+		assert.Nil(json.Unmarshal(rr.Body.Bytes(), page))
+
+		return page
+	}
+	id := func(r interface{}) interface{} {
+		m, _ := r.(map[string]interface{})
+
+		return m["id"]
+	}
+
+	// Pages sorted by property
+	qr := &QueryRequest{Fields: []string{"id"}}
+	qr.Limit = 2
+	qr.SortBy = "model"
+
+	page := query(qr)
+	assert.Len(page.Resources, 2)
+	assert.Equal(s2.ID, id(page.Resources[0]))
+	assert.Equal(s3.ID, id(page.Resources[1]))
+	assert.NotEmpty(page.Continue)
+
+	qr.Continue = page.Continue
+	page = query(qr)
+	assert.Len(page.Resources, 1)
+	assert.Equal(s1.ID, id(page.Resources[0]))
+	assert.Empty(page.Continue)
+
+	// Filters apply to pages, sorted by label descending
+	qr = &QueryRequest{Labels: []zebra.Query{{Op: zebra.MatchEqual, Key: "color", Values: []string{"red"}}}}
+	qr.SortBy = "label.color"
+	qr.Desc = true
+	qr.Fields = []string{"ID", "label.color", "credentials.name", "unknown"}
+
+	page = query(qr)
+	assert.Len(page.Resources, 2)
+
+	for _, r := range page.Resources {
+		m, ok := r.(map[string]interface{})
+		assert.True(ok)
+		assert.Len(m, 3)
+		assert.Equal("red", m["label.color"])
+		assert.Contains([]interface{}{"s1", "s3"}, m["credentials.name"])
+	}
+
+	// Bad page requests
+	qr = &QueryRequest{Query: `type == Server`}
+	qr.Continue = "bad"
+
+	rr := httptest.NewRecorder()
+	h(rr, makeQueryRequest(assert, api, qr), nil)
+	assert.Equal(http.StatusBadRequest, rr.Code)
+
+	qr = new(QueryRequest)
+	qr.Limit = -1
+
+	rr = httptest.NewRecorder()
+	h(rr, makeQueryRequest(assert, api, qr), nil)
+	assert.Equal(http.StatusBadRequest, rr.Code)
+}
+
 func TestBadQuery(t *testing.T) {
 	t.Parallel()
 	assert := assert.New(t)
@@ -101,15 +269,8 @@ func TestBadQuery(t *testing.T) {
 	handler.ServeHTTP(rr, req)
 	assert.Equal(rr.Code, http.StatusBadRequest)
 
-	// Cannot have both Types and Properties
+	// Must have valid label queries, with or without types
 	qr.IDs = []string{}
-	qr.Properties = []zebra.Query{{Op: zebra.MatchEqual, Key: "test", Values: []string{"test"}}}
-	req = makeQueryRequest(assert, api, qr)
-	handler.ServeHTTP(rr, req)
-	assert.Equal(rr.Code, http.StatusBadRequest)
-
-	// Cannot have Labels with anything else
-	qr.Properties = []zebra.Query{}
 	qr.Labels = []zebra.Query{
 		{Op: zebra.MatchEqual, Key: "test", Values: []string{"test"}},
 		{Op: zebra.MatchEqual, Key: "blah", Values: []string{"blah", "blah2"}},
@@ -118,7 +279,6 @@ func TestBadQuery(t *testing.T) {
 	handler.ServeHTTP(rr, req)
 	assert.Equal(rr.Code, http.StatusBadRequest)
 
-	// Must have valid label queries
 	qr.Types = []string{}
 	req = makeQueryRequest(assert, api, qr)
 	handler.ServeHTTP(rr, req)
@@ -158,7 +318,7 @@ func TestInvalidQuery(t *testing.T) {
 	assert.Equal(http.StatusInternalServerError, rr.Code)
 
 	// Invalid json request
-	ctx := context.WithValue(context.Background(), ResourcesCtxKey, api)
+	ctx := adminContext(context.Background(), api)
 	req, err = http.NewRequestWithContext(ctx, "GET", "/api/v1/resources", nil)
 	assert.Nil(err)
 	assert.NotNil(req)
@@ -211,32 +371,88 @@ func TestPostResource(t *testing.T) {
 	body := `{"lab":[{"id":"0100000003","type":"Lab","labels": {"owner": "shravya"},"name": "shravya's lab"}]}`
 
 	// Create new resource
-	req := createRequest(assert, "POST", "/resources", body, myAPI)
+	req := createAdminRequest(assert, "POST", "/resources", body, myAPI)
 	rr := httptest.NewRecorder()
 	handler.ServeHTTP(rr, req)
 	assert.NotEqual(http.StatusOK, rr.Code)
 
 	// Update existing resource
-	req = createRequest(assert, "POST", "/resources", body, myAPI)
+	req = createAdminRequest(assert, "POST", "/resources", body, myAPI)
 	rr = httptest.NewRecorder()
 	handler.ServeHTTP(rr, req)
 	assert.NotEqual(http.StatusOK, rr.Code)
 
 	// Create resource with an invalid type, won't read properly
 	body = `{"lab":[{"id":"","type":"test","labels": {"owner": "shravya"},"name": "shravya's lab"}]}`
-	req = createRequest(assert, "POST", "/resources", body, myAPI)
+	req = createAdminRequest(assert, "POST", "/resources", body, myAPI)
 	rr = httptest.NewRecorder()
 	handler.ServeHTTP(rr, req)
 	assert.Equal(http.StatusBadRequest, rr.Code)
 
 	// Create resource with an invalid ID
 	body = `{"lab":[{"id":"","type":"Lab","labels": {"owner": "shravya"},"name": "shravya's lab"}]}`
-	req = createRequest(assert, "POST", "/resources", body, myAPI)
+	req = createAdminRequest(assert, "POST", "/resources", body, myAPI)
 	rr = httptest.NewRecorder()
 	handler.ServeHTTP(rr, req)
 	assert.Equal(http.StatusBadRequest, rr.Code)
 }
 
+func TestResourceConflict(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testresourceconflict"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	api := NewResourceAPI(store.DefaultFactory())
+	assert.Nil(api.Initialize(root))
+
+	post := handlePost()
+	del := handleDelete()
+	send := func(h httprouter.Handle, method, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h(rr, createAdminRequest(assert, method, "/resources", body, api), nil)
+
+		return rr
+	}
+
+	body := `{"VLANPool":[{"id":"0100000004","type":"VLANPool","labels":{"system.group":"eng"},` +
+		`"rangeStart":1,"rangeEnd":10%s}]}`
+
+	// Create and update return the new resource versions
+	rr := send(post, "POST", fmt.Sprintf(body, ""))
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.Contains(rr.Body.String(), `"resourceVersion":1`)
+
+	rr = send(post, "POST", fmt.Sprintf(body, `,"resourceVersion":1`))
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.Contains(rr.Body.String(), `"resourceVersion":2`)
+
+	// Writes with a stale version conflict
+	rr = send(post, "POST", fmt.Sprintf(body, `,"resourceVersion":1`))
+	assert.Equal(http.StatusConflict, rr.Code)
+
+	rr = send(del, "DELETE", fmt.Sprintf(body, `,"resourceVersion":1`))
+	assert.Equal(http.StatusConflict, rr.Code)
+
+	// Batches are written all or nothing
+	batch := `{"VLANPool":[{"id":"0100000005","type":"VLANPool","labels":{"system.group":"eng"},` +
+		`"rangeStart":1,"rangeEnd":10},{"id":"0100000004","type":"VLANPool","labels":{"system.group":"eng"},` +
+		`"rangeStart":1,"rangeEnd":10,"resourceVersion":1}]}`
+
+	rr = send(post, "POST", batch)
+	assert.Equal(http.StatusConflict, rr.Code)
+	assert.Empty(api.Store.QueryUUID([]string{"0100000005"}).Resources)
+
+	rr = send(del, "DELETE", batch)
+	assert.Equal(http.StatusConflict, rr.Code)
+	assert.NotEmpty(api.Store.QueryUUID([]string{"0100000004"}).Resources)
+
+	rr = send(del, "DELETE", fmt.Sprintf(body, `,"resourceVersion":2`))
+	assert.Equal(http.StatusOK, rr.Code)
+}
+
 func TestDeleteResource(t *testing.T) { //nolint:funlen
 	t.Parallel()
 	assert := assert.New(t)
@@ -256,10 +472,11 @@ func TestDeleteResource(t *testing.T) { //nolint:funlen
 	lab1 := &dc.Lab{
 		NamedResource: zebra.NamedResource{
 			BaseResource: zebra.BaseResource{
-				ID:     "10000001",
-				Type:   "Lab",
-				Labels: nil,
-				Status: zebra.DefaultStatus(),
+				ID:              "10000001",
+				Type:            "Lab",
+				Labels:          nil,
+				Status:          zebra.DefaultStatus(),
+				ResourceVersion: 0,
 			},
 			Name: "Lab1",
 		},
@@ -268,10 +485,11 @@ func TestDeleteResource(t *testing.T) { //nolint:funlen
 	lab2 := &dc.Lab{
 		NamedResource: zebra.NamedResource{
 			BaseResource: zebra.BaseResource{
-				ID:     "10000002",
-				Type:   "Lab",
-				Labels: nil,
-				Status: zebra.DefaultStatus(),
+				ID:              "10000002",
+				Type:            "Lab",
+				Labels:          nil,
+				Status:          zebra.DefaultStatus(),
+				ResourceVersion: 0,
 			},
 			Name: "Lab2",
 		},
@@ -288,19 +506,19 @@ func TestDeleteResource(t *testing.T) { //nolint:funlen
 
 	// Invalid resources requested to be deleted
 	body := `{"lab":[{"id":"10000003","type":"Lab","name": "shravya's lab"}]}`
-	req := createRequest(assert, "DELETE", "/resources", body, myAPI)
+	req := createAdminRequest(assert, "DELETE", "/resources", body, myAPI)
 	rr := httptest.NewRecorder()
 	handler.ServeHTTP(rr, req)
 	assert.NotEqual(http.StatusOK, rr.Code)
 
 	body = `{"lab":[{"id":"","type":"","name": "shravya's lab"}]}`
-	req = createRequest(assert, "DELETE", "/resources", body, myAPI)
+	req = createAdminRequest(assert, "DELETE", "/resources", body, myAPI)
 	rr = httptest.NewRecorder()
 	handler.ServeHTTP(rr, req)
 	assert.Equal(http.StatusBadRequest, rr.Code)
 
 	body = `{"lab":[{"id":"0","type":"Lab","name": "shravya's lab"}]}`
-	req = createRequest(assert, "DELETE", "/resources", body, myAPI)
+	req = createAdminRequest(assert, "DELETE", "/resources", body, myAPI)
 	rr = httptest.NewRecorder()
 	handler.ServeHTTP(rr, req)
 	assert.Equal(http.StatusBadRequest, rr.Code)
@@ -308,7 +526,7 @@ func TestDeleteResource(t *testing.T) { //nolint:funlen
 	// DELETE resources
 	bytes, err := json.Marshal(myAPI.Store.Query())
 	assert.Nil(err)
-	req = createRequest(assert, "DELETE", "/resources", string(bytes), myAPI)
+	req = createAdminRequest(assert, "DELETE", "/resources", string(bytes), myAPI)
 	rr = httptest.NewRecorder()
 	handler.ServeHTTP(rr, req)
 	assert.Equal(http.StatusOK, rr.Code)
@@ -324,7 +542,7 @@ func TestValidateQueries(t *testing.T) {
 	qs := []zebra.Query{
 		{Op: zebra.MatchIn, Key: "test", Values: []string{"blah", "blah2"}},
 		{Op: zebra.MatchEqual, Key: "test", Values: []string{"blah", "blah2"}},
-		{Op: 8, Key: "test", Values: []string{"blah", "blah2"}},
+		{Op: 10, Key: "test", Values: []string{"blah", "blah2"}},
 	}
 
 	assert.Nil(qs[0].Validate())
@@ -370,3 +588,12 @@ func createRequest(assert *assert.Assertions, method string, url string,
 
 	return req
 }
+
+// createAdminRequest creates a request made by a user allowed to do anything.
+func createAdminRequest(assert *assert.Assertions, method string, url string,
+	body string, api *ResourceAPI,
+) *http.Request {
+	req := createRequest(assert, method, url, body, api)
+
+	return req.WithContext(adminContext(req.Context(), api))
+}
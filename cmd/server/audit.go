@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/audit"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/lease"
+)
+
+// SystemUser is the audited user of the changes zebra makes on its own, such
+// as releasing expired leases and activating queued leases.
+const SystemUser = "system"
+
+// systemContext returns the context with the claims of the system user.
+func systemContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ClaimsCtxKey, auth.NewClaims("zebra", SystemUser, nil, SystemUser))
+}
+
+var ErrAuditRequest = errors.New("invalid audit request")
+
+// auditEntry returns an audit entry of the action by the caller, the caller
+// and the authentication method are taken from the request context.
+func auditEntry(ctx context.Context, action string) *audit.Entry {
+	e := &audit.Entry{
+		Time:      time.Now(),
+		User:      "",
+		Method:    "",
+		Action:    action,
+		ID:        "",
+		Type:      "",
+		Resources: nil,
+		Changes:   nil,
+		Error:     "",
+	}
+
+	if claims, ok := ctx.Value(ClaimsCtxKey).(*auth.Claims); ok {
+		e.User = claims.Email
+	}
+
+	if method, ok := ctx.Value(MethodCtxKey).(string); ok {
+		e.Method = method
+	}
+
+	return e
+}
+
+// record writes the entry to the audit log. The audited change has been made
+// already, so errors are logged and not returned.
+func record(ctx context.Context, api *ResourceAPI, e *audit.Entry) {
+	if api.Audit == nil {
+		return
+	}
+
+	if err := api.Audit.Record(e); err != nil {
+		logr.FromContextOrDiscard(ctx).Error(err, "failed to write audit log", "action", e.Action, "id", e.ID)
+	}
+}
+
+// recordChange records a change of the resource by the caller, before is the
+// snapshot of the resource taken before the change and after is nil for
+// deletes.
+func recordChange(ctx context.Context, api *ResourceAPI, action string, res zebra.Resource, before, after []byte) {
+	e := auditEntry(ctx, action)
+	e.ID = res.GetID()
+	e.Type = res.GetType()
+	e.Changes = audit.Diff(before, after)
+
+	record(ctx, api, e)
+}
+
+// auditedTxn is a store transaction whose writes are recorded in the audit
+// log once it is committed.
+type auditedTxn struct {
+	zebra.Txn
+	ctx     context.Context
+	api     *ResourceAPI
+	changes []stagedChange
+}
+
+// stagedChange is a staged write of an audited transaction, before is the
+// snapshot of the stored resource when the write was staged.
+type stagedChange struct {
+	action string
+	res    zebra.Resource
+	before []byte
+}
+
+// beginAudited starts a store transaction whose writes are audited.
+func beginAudited(ctx context.Context, api *ResourceAPI) *auditedTxn {
+	return &auditedTxn{
+		Txn:     api.Store.Begin(),
+		ctx:     ctx,
+		api:     api,
+		changes: []stagedChange{},
+	}
+}
+
+// Create stages the creation or the update of the resource.
+func (t *auditedTxn) Create(res zebra.Resource) error {
+	before := audit.Snapshot(findResource(t.api, res.GetID()))
+
+	if err := t.Txn.Create(res); err != nil {
+		return err
+	}
+
+	action := audit.ActionUpdate
+	if before == nil {
+		action = audit.ActionCreate
+	}
+
+	t.changes = append(t.changes, stagedChange{action: action, res: res, before: before})
+
+	return nil
+}
+
+// Delete stages the deletion of the resource, the stored resource is audited
+// if there is one.
+func (t *auditedTxn) Delete(res zebra.Resource) error {
+	stored := findResource(t.api, res.GetID())
+	if stored == nil {
+		stored = res
+	}
+
+	if err := t.Txn.Delete(res); err != nil {
+		return err
+	}
+
+	t.changes = append(t.changes, stagedChange{action: audit.ActionDelete, res: stored, before: audit.Snapshot(stored)})
+
+	return nil
+}
+
+// Commit commits the transaction and records all of its changes.
+func (t *auditedTxn) Commit() error {
+	if err := t.Txn.Commit(); err != nil {
+		return err
+	}
+
+	for _, c := range t.changes {
+		var after []byte
+		if c.action != audit.ActionDelete {
+			after = audit.Snapshot(c.res)
+		}
+
+		recordChange(t.ctx, t.api, c.action, c.res, c.before, after)
+	}
+
+	return nil
+}
+
+// commitAll stages f for all resources in the resource map and commits the
+// transaction, so that either all resources are written or none. f is
+// either the Create or the Delete of the transaction.
+func commitAll(txn zebra.Txn, resMap *zebra.ResourceMap, f func(zebra.Resource) error) error {
+	if err := applyFunc(resMap, f); err != nil {
+		txn.Rollback()
+
+		return err
+	}
+
+	return txn.Commit()
+}
+
+// auditedCreate returns a function that creates or updates a resource in the
+// store and records the change in the audit log.
+func auditedCreate(ctx context.Context, api *ResourceAPI) func(zebra.Resource) error {
+	return func(res zebra.Resource) error {
+		txn := beginAudited(ctx, api)
+
+		return commitAll(txn, singleton(res), txn.Create)
+	}
+}
+
+// auditedDelete returns a function that deletes a resource from the store and
+// records the change in the audit log.
+func auditedDelete(ctx context.Context, api *ResourceAPI) func(zebra.Resource) error {
+	return func(res zebra.Resource) error {
+		txn := beginAudited(ctx, api)
+
+		return commitAll(txn, singleton(res), txn.Delete)
+	}
+}
+
+// singleton returns a resource map of the resource.
+func singleton(res zebra.Resource) *zebra.ResourceMap {
+	resMap := zebra.NewResourceMap(nil)
+	resMap.Add(res, res.GetType())
+
+	return resMap
+}
+
+// recordLease records a lease action, before is the snapshot of the lease
+// taken before the action. The leased resources are recorded by id, instead
+// of the changes to the lease requests.
+func recordLease(ctx context.Context, api *ResourceAPI, action string, l *lease.Lease, before []byte,
+	resources []string,
+) {
+	e := auditEntry(ctx, action)
+	e.ID = l.ID
+	e.Type = l.Type
+	e.Resources = resources
+	e.Changes = []audit.Change{}
+
+	for _, c := range audit.Diff(before, audit.Snapshot(l)) {
+		if c.Field != "request" {
+			e.Changes = append(e.Changes, c)
+		}
+	}
+
+	record(ctx, api, e)
+}
+
+// queuedSnapshots returns the snapshots of the queued leases by lease id, taken
+// before they are activated.
+func queuedSnapshots(api *ResourceAPI) map[string][]byte {
+	before := make(map[string][]byte)
+
+	for _, l := range api.Allocator.Queue() {
+		before[l.ID] = audit.Snapshot(l)
+	}
+
+	return before
+}
+
+// recordActivated records the activation of the queued leases, which zebra
+// activates on its own once their resources are free, by the system user.
+// The before map holds their snapshots by lease id.
+func recordActivated(ctx context.Context, api *ResourceAPI, activated []*lease.Lease, before map[string][]byte) {
+	ctx = systemContext(ctx)
+
+	for _, l := range activated {
+		recordLease(ctx, api, audit.ActionActivate, l, before[l.ID], leasedIDs(l))
+	}
+}
+
+// leasedIDs returns the ids of the resources assigned to the lease.
+func leasedIDs(l *lease.Lease) []string {
+	ids := []string{}
+
+	for _, r := range l.RequestList() {
+		for _, res := range r.Resources {
+			ids = append(ids, res.GetID())
+		}
+	}
+
+	return ids
+}
+
+// recordAuth records an authentication event of the user, err is nil if the
+// user authenticated successfully. Failures are counted in the metrics too.
+func recordAuth(ctx context.Context, api *ResourceAPI, action string, method string, user string, err error) {
+	e := auditEntry(ctx, action)
+	e.User = user
+	e.Method = method
+
+	if err != nil {
+		e.Error = err.Error()
+		api.Metrics.authFailure(method, authFailureReason(action, method, err))
+	}
+
+	record(ctx, api, e)
+}
+
+// newAuditFilter reads the audit filter from the url query, e.g.
+// ?user=admin@zebra.io&action=release&since=2022-06-01T00:00:00Z. Times are
+// in RFC 3339 format.
+func newAuditFilter(req *http.Request) (audit.Filter, error) {
+	values := req.URL.Query()
+	filter := audit.Filter{
+		User:   strings.TrimSpace(values.Get("user")),
+		Action: strings.TrimSpace(values.Get("action")),
+		ID:     strings.TrimSpace(values.Get("id")),
+		Type:   strings.TrimSpace(values.Get("type")),
+		Since:  time.Time{},
+		Until:  time.Time{},
+	}
+
+	for key, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if val := values.Get(key); val != "" {
+			parsed, err := time.Parse(time.RFC3339, val)
+			if err != nil {
+				return filter, ErrAuditRequest
+			}
+
+			*t = parsed
+		}
+	}
+
+	return filter, nil
+}
+
+// canReadAudit returns true if the claims allow reading the audit log. The
+// audit log has the emails, login failures and resource changes of all users,
+// so read access to all resources, which the default role grants, is not
+// enough: all privileges on the Audit key are required, as administrators
+// have.
+func canReadAudit(claims *auth.Claims) bool {
+	return claims.Write(auth.GroupKey("Audit", ""))
+}
+
+// handleAudit returns the audit log entries matching the url query filter.
+// The caller must be allowed to read the audit log, see canReadAudit.
+func handleAudit() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		log := logr.FromContextOrDiscard(ctx)
+		api, claims, ok := apiContext(ctx)
+
+		if !ok || api.Audit == nil {
+			res.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		if !canReadAudit(claims) {
+			writeForbidden(ctx, res, claims, []string{"Audit"})
+
+			return
+		}
+
+		filter, err := newAuditFilter(req)
+		if err != nil {
+			res.WriteHeader(http.StatusBadRequest)
+			log.Info("audit log could not be read, invalid request")
+
+			return
+		}
+
+		entries, err := api.Audit.Query(filter)
+		if err != nil {
+			res.WriteHeader(http.StatusInternalServerError)
+			log.Error(err, "internal server error while reading audit log")
+
+			return
+		}
+
+		writeJSON(ctx, res, &struct {
+			Entries []*audit.Entry `json:"entries"`
+		}{Entries: entries})
+	}
+}
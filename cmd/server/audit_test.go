@@ -0,0 +1,214 @@
+package main //nolint:testpackage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/audit"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/lease"
+	"github.com/project-safari/zebra/network"
+	"github.com/project-safari/zebra/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAudit(t *testing.T) { //nolint:funlen
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testaudit"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	api := NewResourceAPI(store.DefaultFactory())
+	assert.Nil(api.Initialize(root))
+
+	user := makeUser(assert)
+	assert.Nil(api.Store.Create(user))
+
+	routes := routeHandler()
+	serve := func(ctx context.Context, method string, path string, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequestWithContext(ctx, method, path, strings.NewReader(body))
+		assert.Nil(err)
+
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	query := func(ctx context.Context, filter string) []*audit.Entry {
+		rr := serve(ctx, "GET", "/api/v1/audit?"+filter, "")
+		assert.Equal(http.StatusOK, rr.Code)
+
+		auditRes := &struct {
+			Entries []*audit.Entry `json:"entries"`
+		}{}
+		assert.Nil(json.Unmarshal(rr.Body.Bytes(), auditRes))
+
+		return auditRes.Entries
+	}
+
+	ctx := context.WithValue(context.Background(), ResourcesCtxKey, api)
+	ctx = context.WithValue(ctx, ClaimsCtxKey, auth.NewClaims("zebra", user.Name, user.Role, user.Email))
+	ctx = context.WithValue(ctx, MethodCtxKey, audit.MethodJWT)
+
+	// Create and update a resource
+	vlan := &network.VLANPool{
+		BaseResource: *zebra.NewBaseResource("VLANPool", zebra.Labels{"system.group": "eng"}),
+		RangeStart:   1,
+		RangeEnd:     10,
+	}
+	resMap := zebra.NewResourceMap(nil)
+	resMap.Add(vlan, "VLANPool")
+
+	body, err := json.Marshal(resMap)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, serve(ctx, "POST", "/api/v1/resources", string(body)).Code)
+
+	rr := serve(ctx, "PATCH", "/api/v1/resources/"+vlan.ID, `{"rangeEnd":20}`)
+	assert.Equal(http.StatusOK, rr.Code)
+
+	entries := query(ctx, "id="+vlan.ID)
+	assert.Len(entries, 2)
+	assert.Equal(audit.ActionCreate, entries[0].Action)
+	assert.Equal(user.Email, entries[0].User)
+	assert.Equal(audit.MethodJWT, entries[0].Method)
+	assert.Equal("VLANPool", entries[0].Type)
+	assert.Equal(audit.ActionUpdate, entries[1].Action)
+	assert.Contains(entries[1].Changes, audit.Change{Field: "rangeEnd", Before: float64(10), After: float64(20)})
+
+	// Lease and release it, the queued lease is then activated
+	rr = serve(ctx, "POST", "/api/v1/leases",
+		`{"duration":3600000000000,"request":[{"type":"VLANPool","group":"eng","count":1}]}`)
+	assert.Equal(http.StatusOK, rr.Code)
+
+	l := findLeases(api.Store)[0]
+
+	rr = serve(ctx, "POST", "/api/v1/leases",
+		`{"duration":3600000000000,"request":[{"type":"VLANPool","group":"eng","count":1}]}`)
+	assert.Equal(http.StatusAccepted, rr.Code)
+
+	queued := api.Allocator.Queue()[0]
+	rr = serve(ctx, "POST", fmt.Sprintf("/api/v1/leases/%s/release", l.ID), "")
+	assert.Equal(http.StatusOK, rr.Code)
+
+	entries = query(ctx, "action=release&id="+vlan.ID)
+	assert.Len(entries, 1)
+	assert.Equal(l.ID, entries[0].ID)
+	assert.Equal([]string{vlan.ID}, entries[0].Resources)
+	assert.Contains(entries[0].Changes, audit.Change{Field: "status.state", Before: "active", After: "inactive"})
+
+	entries = query(ctx, "action=activate&id="+vlan.ID)
+	assert.Len(entries, 1)
+	assert.Equal(queued.ID, entries[0].ID)
+	assert.Equal(SystemUser, entries[0].User)
+	assert.Equal([]string{vlan.ID}, entries[0].Resources)
+	assert.Contains(entries[0].Changes, audit.Change{Field: "status.state", Before: "inactive", After: "active"})
+
+	// Delete it
+	rr = serve(ctx, "DELETE", "/api/v1/resources/"+vlan.ID, "")
+	assert.Equal(http.StatusOK, rr.Code)
+
+	entries = query(ctx, "action=delete")
+	assert.Len(entries, 1)
+	assert.NotEmpty(entries[0].Changes)
+
+	// Logins are audited, whether they succeed or not
+	login := loginAdapter()(nil)
+	login.ServeHTTP(httptest.NewRecorder(), makeLoginRequest(assert, user.Name, "wrong", user.Email, api))
+	login.ServeHTTP(httptest.NewRecorder(), makeLoginRequest(assert, user.Name, jiniWords, user.Email, api))
+
+	entries = query(ctx, "action=login&user="+user.Email)
+	assert.Len(entries, 2)
+	assert.NotEmpty(entries[0].Error)
+	assert.Equal(audit.MethodPassword, entries[0].Method)
+	assert.Empty(entries[1].Error)
+
+	// Time filters
+	now := time.Now().UTC()
+	assert.Empty(query(ctx, "since="+now.Add(time.Hour).Format(time.RFC3339)))
+	assert.Len(query(ctx, "until="+now.Add(time.Hour).Format(time.RFC3339)), 9)
+
+	rr = serve(ctx, "GET", "/api/v1/audit?since=yesterday", "")
+	assert.Equal(http.StatusBadRequest, rr.Code)
+
+	// The caller must be allowed to read the audit log
+	rr = serve(userContext(assert, api, "^VLANPool/:r"), "GET", "/api/v1/audit", "")
+	assert.Equal(http.StatusForbidden, rr.Code)
+
+	// Reading all resources, as the default role does, is not enough
+	rr = serve(userContext(assert, api, DefaultRole().Privileges[0].String()), "GET", "/api/v1/audit", "")
+	assert.Equal(http.StatusForbidden, rr.Code)
+
+	rr = serve(userContext(assert, api, "^Audit/:r"), "GET", "/api/v1/audit", "")
+	assert.Equal(http.StatusForbidden, rr.Code)
+
+	rr = serve(userContext(assert, api, "^Audit/$:c,r,u,d"), "GET", "/api/v1/audit", "")
+	assert.Equal(http.StatusOK, rr.Code)
+}
+
+// TestAuditExpired tests that the leases released by the reaper are audited,
+// whether the store backend hands out the stored resources or copies of them.
+func TestAuditExpired(t *testing.T) {
+	t.Parallel()
+
+	for _, backend := range []string{store.FileBackend, store.DBBackend} {
+		backend := backend
+
+		t.Run(backend, func(t *testing.T) {
+			t.Parallel()
+			assert := assert.New(t)
+
+			root := "testauditexpired" + backend
+
+			t.Cleanup(func() { os.RemoveAll(root) })
+
+			api := NewResourceAPI(store.DefaultFactory())
+			api.Backend = backend
+			assert.Nil(api.Initialize(root))
+
+			vlan := &network.VLANPool{
+				BaseResource: *zebra.NewBaseResource("VLANPool", zebra.Labels{"system.group": "eng"}),
+				RangeStart:   0,
+				RangeEnd:     10,
+			}
+			assert.Nil(api.Store.Create(vlan))
+
+			l := lease.NewLease(*makeUser(assert), time.Millisecond, []*lease.ResourceReq{
+				{Type: "VLANPool", Group: "eng", Name: "vlan", Count: 1},
+			})
+			_, err := api.Allocator.Allocate(l)
+			assert.Nil(err)
+
+			time.Sleep(10 * time.Millisecond)
+
+			before := expiredSnapshots(api)
+			assert.Len(before, 1)
+
+			released, _, err := api.Allocator.Reap()
+			assert.Nil(err)
+			assert.Len(released, 1)
+
+			recordExpired(context.Background(), api, released, before)
+
+			entries, err := api.Audit.Query(audit.Filter{
+				User: SystemUser, Action: audit.ActionExpire, ID: vlan.ID, Type: "", Since: time.Time{}, Until: time.Time{},
+			})
+			assert.Nil(err)
+			assert.Len(entries, 1)
+			assert.Equal(l.ID, entries[0].ID)
+			assert.Contains(entries[0].Changes, audit.Change{
+				Field: "status.state", Before: zebra.Active.String(), After: zebra.Inactive.String(),
+			})
+		})
+	}
+}
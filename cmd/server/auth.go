@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	"github.com/go-logr/logr"
+	"github.com/project-safari/zebra/audit"
 	"github.com/project-safari/zebra/auth"
 	"gojini.dev/web"
 )
@@ -14,9 +15,9 @@ func authAdapter() web.Adapter {
 	return func(nextHandler http.Handler) http.Handler {
 		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
 			if nextReq := rsaKey(res, req); nextReq != nil {
-				callNext(nextHandler, res, req)
+				callNext(nextHandler, res, nextReq)
 			} else if nextReq := jwtClaims(res, req); nextReq != nil {
-				callNext(nextHandler, res, req)
+				callNext(nextHandler, res, nextReq)
 			} else {
 				// No auth token so return unautorized status
 				res.WriteHeader(http.StatusUnauthorized)
@@ -54,6 +55,7 @@ func rsaKey(res http.ResponseWriter, req *http.Request) *http.Request {
 	user := findUser(api.Store, userEmail)
 	if user == nil {
 		log.Error(nil, "user not found", "user", userEmail)
+		recordAuth(ctx, api, audit.ActionAuth, audit.MethodRSA, userEmail, ErrUserNotFound)
 		res.WriteHeader(http.StatusUnauthorized)
 
 		return nil
@@ -62,6 +64,7 @@ func rsaKey(res http.ResponseWriter, req *http.Request) *http.Request {
 	// Verify that token is valid
 	if e := user.Authenticate(userToken); e != nil {
 		log.Error(e, "user token invalid")
+		recordAuth(ctx, api, audit.ActionAuth, audit.MethodRSA, userEmail, e)
 		res.WriteHeader(http.StatusUnauthorized)
 
 		return nil
@@ -70,6 +73,7 @@ func rsaKey(res http.ResponseWriter, req *http.Request) *http.Request {
 	// Set the claims into request
 	claims := auth.NewClaims("zebra", user.Name, user.Role, user.Email)
 	ctx = context.WithValue(ctx, ClaimsCtxKey, claims)
+	ctx = context.WithValue(ctx, MethodCtxKey, audit.MethodRSA)
 
 	return req.Clone(ctx)
 }
@@ -100,6 +104,10 @@ func jwtClaims(res http.ResponseWriter, req *http.Request) *http.Request {
 	if err != nil {
 		log.Error(err, "jwt cookie missing")
 
+		if user, token := creds(req); user == "" || token == "" {
+			api.Metrics.authFailure("", ReasonNoCredentials)
+		}
+
 		return nil
 	}
 
@@ -107,6 +115,7 @@ func jwtClaims(res http.ResponseWriter, req *http.Request) *http.Request {
 	jwtClaims, err := auth.FromJWT(jwtCookie.Value, authKey)
 	if err != nil {
 		log.Error(err, "bad jwt token")
+		recordAuth(ctx, api, audit.ActionAuth, audit.MethodJWT, "", err)
 		res.WriteHeader(http.StatusUnauthorized)
 
 		return nil
@@ -115,6 +124,7 @@ func jwtClaims(res http.ResponseWriter, req *http.Request) *http.Request {
 	// Make sure the jwt is still valid
 	if err := jwtClaims.Valid(); err != nil {
 		log.Error(err, "invalid jwt token")
+		recordAuth(ctx, api, audit.ActionAuth, audit.MethodJWT, jwtClaims.Email, err)
 		res.WriteHeader(http.StatusUnauthorized)
 
 		return nil
@@ -124,13 +134,18 @@ func jwtClaims(res http.ResponseWriter, req *http.Request) *http.Request {
 	user := findUser(api.Store, jwtClaims.Email)
 	if user == nil {
 		log.Error(err, "user not found", "user", jwtClaims.Subject)
+		recordAuth(ctx, api, audit.ActionAuth, audit.MethodJWT, jwtClaims.Email, ErrUserNotFound)
 		res.WriteHeader(http.StatusUnauthorized)
 
 		return nil
 	}
 
+	// Role bindings take effect without a new jwt
+	jwtClaims.Role = user.Role
+
 	// Set the claims into request
 	ctx = context.WithValue(ctx, ClaimsCtxKey, jwtClaims)
+	ctx = context.WithValue(ctx, MethodCtxKey, audit.MethodJWT)
 
 	return req.Clone(ctx)
 }
@@ -82,6 +82,9 @@ func TestRSAKey(t *testing.T) {
 
 	a := authAdapter()
 	handler := a(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		claims, ok := req.Context().Value(ClaimsCtxKey).(*auth.Claims)
+		assert.True(ok)
+		assert.Equal(user.Email, claims.Email)
 		res.WriteHeader(http.StatusOK)
 	}))
 	handler.ServeHTTP(rr, req)
@@ -119,6 +122,9 @@ func TestJWT(t *testing.T) {
 
 	a := authAdapter()
 	handler := a(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		claims, ok := req.Context().Value(ClaimsCtxKey).(*auth.Claims)
+		assert.True(ok)
+		assert.Equal(user.Email, claims.Email)
 		res.WriteHeader(http.StatusOK)
 	}))
 	handler.ServeHTTP(rr, req)
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+)
+
+var ErrForbidden = errors.New("not allowed")
+
+// Forbidden is the response to a request that the caller is not allowed to
+// make on some of the resources.
+type Forbidden struct {
+	Error     string   `json:"error"`
+	Resources []string `json:"resources"`
+}
+
+// apiContext returns the resource API and the caller claims from the request
+// context.
+func apiContext(ctx context.Context) (*ResourceAPI, *auth.Claims, bool) {
+	api, ok := ctx.Value(ResourcesCtxKey).(*ResourceAPI)
+	if !ok {
+		return nil, nil, false
+	}
+
+	claims, ok := ctx.Value(ClaimsCtxKey).(*auth.Claims)
+	if !ok {
+		return nil, nil, false
+	}
+
+	return api, claims, true
+}
+
+// canRead returns true if the claims allow reading the resource.
+func canRead(claims *auth.Claims, res zebra.Resource) bool {
+	return claims.Read(auth.KeyOf(res))
+}
+
+// canWrite returns true if the claims allow creating the resource, or
+// updating it if there is a stored resource with the same id. An update must
+// be allowed on the stored resource as well, so that resources cannot be moved
+// out of a group the caller cannot update.
+func canWrite(api *ResourceAPI, claims *auth.Claims, res zebra.Resource) bool {
+	old := findResource(api, res.GetID())
+	if old == nil {
+		return claims.Create(auth.KeyOf(res))
+	}
+
+	return claims.Update(auth.KeyOf(old)) && claims.Update(auth.KeyOf(res))
+}
+
+// canDelete returns true if the claims allow deleting the resource, the
+// stored resource is checked if there is one.
+func canDelete(api *ResourceAPI, claims *auth.Claims, res zebra.Resource) bool {
+	if old := findResource(api, res.GetID()); old != nil {
+		res = old
+	}
+
+	return claims.Delete(auth.KeyOf(res))
+}
+
+// filterReadable returns the resources in the resource map the claims allow
+// reading.
+func filterReadable(claims *auth.Claims, resMap *zebra.ResourceMap) *zebra.ResourceMap {
+	retMap := zebra.NewResourceMap(resMap.GetFactory())
+
+	for t, l := range resMap.Resources {
+		for _, res := range l.Resources {
+			if canRead(claims, res) {
+				retMap.Add(res, t)
+			}
+		}
+	}
+
+	return retMap
+}
+
+// forbiddenIDs returns the ids of the resources in the resource map that the
+// check does not allow.
+func forbiddenIDs(resMap *zebra.ResourceMap, allowed func(zebra.Resource) bool) []string {
+	ids := []string{}
+
+	for _, l := range resMap.Resources {
+		for _, res := range l.Resources {
+			if !allowed(res) {
+				ids = append(ids, res.GetID())
+			}
+		}
+	}
+
+	return ids
+}
+
+// writeForbidden writes a 403 response naming the resources the caller is not
+// allowed to change.
+func writeForbidden(ctx context.Context, res http.ResponseWriter, claims *auth.Claims, ids []string) {
+	log := logr.FromContextOrDiscard(ctx)
+	log.Info("request not allowed", "user", claims.Email, "resources", ids)
+
+	writeJSONStatus(ctx, res, http.StatusForbidden, &Forbidden{Error: ErrForbidden.Error(), Resources: ids})
+}
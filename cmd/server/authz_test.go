@@ -0,0 +1,143 @@
+package main //nolint:testpackage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/network"
+	"github.com/project-safari/zebra/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// adminContext returns a context with the resource api and the claims of a
+// user allowed to do anything.
+func adminContext(ctx context.Context, api *ResourceAPI) context.Context {
+	all, _ := auth.NewPriv("", true, true, true, true)
+	role := &auth.Role{Name: "admin", Privileges: []*auth.Priv{all}, Priority: AdminPriority}
+	ctx = context.WithValue(ctx, ResourcesCtxKey, api)
+
+	return context.WithValue(ctx, ClaimsCtxKey, auth.NewClaims("zebra", "admin", role, "admin@zebra.io"))
+}
+
+func userContext(assert *assert.Assertions, api *ResourceAPI, privs ...string) context.Context {
+	role := &auth.Role{Name: "test", Privileges: []*auth.Priv{}, Priority: 0}
+
+	for _, p := range privs {
+		priv := new(auth.Priv)
+		assert.Nil(priv.UnmarshalText([]byte(p)))
+		role.Privileges = append(role.Privileges, priv)
+	}
+
+	ctx := context.WithValue(context.Background(), ResourcesCtxKey, api)
+
+	return context.WithValue(ctx, ClaimsCtxKey, auth.NewClaims("zebra", "test", role, "test@zebra.io"))
+}
+
+func TestAuthorization(t *testing.T) { //nolint:funlen
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testauthorization"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	api := NewResourceAPI(store.DefaultFactory())
+	assert.Nil(api.Initialize(root))
+
+	eng := &network.VLANPool{
+		BaseResource: *zebra.NewBaseResource("VLANPool", zebra.Labels{"system.group": "eng"}),
+		RangeStart:   1,
+		RangeEnd:     10,
+	}
+	// The group name has the eng group as prefix
+	ops := &network.VLANPool{
+		BaseResource: *zebra.NewBaseResource("VLANPool", zebra.Labels{"system.group": "engineering"}),
+		RangeStart:   1,
+		RangeEnd:     10,
+	}
+
+	assert.Nil(api.Store.Create(eng))
+	assert.Nil(api.Store.Create(ops))
+
+	// The caller can read and update eng vlan pools only
+	ctx := userContext(assert, api, "VLANPool/eng:r,u")
+	serve := func(h httprouter.Handle, method string, id string, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequestWithContext(ctx, method, "/api/v1/resources", strings.NewReader(body))
+		assert.Nil(err)
+
+		rr := httptest.NewRecorder()
+		h(rr, req, httprouter.Params{{Key: "id", Value: id}})
+
+		return rr
+	}
+
+	rr := serve(handleQuery(), "GET", "", `{"types":["VLANPool"]}`)
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.Contains(rr.Body.String(), eng.ID)
+	assert.NotContains(rr.Body.String(), ops.ID)
+
+	rr = serve(handleQuery(), "GET", "", `{"limit":10}`)
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.Contains(rr.Body.String(), eng.ID)
+	assert.NotContains(rr.Body.String(), ops.ID)
+
+	rr = serve(handleLabels(), "GET", "", `{"labels":[]}`)
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.NotContains(rr.Body.String(), "engineering")
+
+	// Updates are allowed in eng, creates and moves to other groups are not
+	resMap := zebra.NewResourceMap(nil)
+	resMap.Add(eng, "VLANPool")
+	resMap.Add(ops, "VLANPool")
+
+	b, err := json.Marshal(resMap)
+	assert.Nil(err)
+
+	rr = serve(handlePost(), "POST", "", string(b))
+	assert.Equal(http.StatusForbidden, rr.Code)
+
+	forbidden := new(Forbidden)
+	assert.Nil(json.Unmarshal(rr.Body.Bytes(), forbidden))
+	assert.Equal([]string{ops.ID}, forbidden.Resources)
+
+	rr = serve(handlePost(), "POST", "", `{"VLANPool":[{"id":"`+eng.ID+
+		`","type":"VLANPool","labels":{"system.group":"eng"},"rangeStart":2,"rangeEnd":10}]}`)
+	assert.Equal(http.StatusOK, rr.Code)
+
+	rr = serve(handlePost(), "POST", "", `{"VLANPool":[{"id":"0123456789","type":"VLANPool",`+
+		`"labels":{"system.group":"eng"},"rangeStart":2,"rangeEnd":10}]}`)
+	assert.Equal(http.StatusForbidden, rr.Code)
+	assert.Contains(rr.Body.String(), "0123456789")
+
+	rr = serve(handlePatch(), "PATCH", eng.ID, `{"labels":{"color":"red"}}`)
+	assert.Equal(http.StatusOK, rr.Code)
+
+	rr = serve(handlePatch(), "PATCH", eng.ID, `{"labels":{"system.group":"ops"}}`)
+	assert.Equal(http.StatusForbidden, rr.Code)
+	assert.Contains(rr.Body.String(), eng.ID)
+
+	// Resources that cannot be read are not found
+	rr = serve(handlePatch(), "PATCH", ops.ID, `{"labels":{"color":"red"}}`)
+	assert.Equal(http.StatusNotFound, rr.Code)
+
+	// Deletes are not allowed
+	rr = serve(handleDeleteID(), "DELETE", eng.ID, "")
+	assert.Equal(http.StatusForbidden, rr.Code)
+
+	b, err = json.Marshal(resMap)
+	assert.Nil(err)
+
+	rr = serve(handleDelete(), "DELETE", "", string(b))
+	assert.Equal(http.StatusForbidden, rr.Code)
+	assert.Nil(json.Unmarshal(rr.Body.Bytes(), forbidden))
+	assert.ElementsMatch([]string{eng.ID, ops.ID}, forbidden.Resources)
+	assert.Len(api.Store.Query().Resources["VLANPool"].Resources, 2)
+}
@@ -6,4 +6,5 @@ const (
 	ResourcesCtxKey = CtxKey("resources")
 	AuthCtxKey      = CtxKey("authKey")
 	ClaimsCtxKey    = CtxKey("claims")
+	MethodCtxKey    = CtxKey("authMethod")
 )
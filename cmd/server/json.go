@@ -32,6 +32,10 @@ func readJSON(ctx context.Context, req *http.Request, data interface{}) error {
 }
 
 func writeJSON(ctx context.Context, res http.ResponseWriter, data interface{}) {
+	writeJSONStatus(ctx, res, http.StatusOK, data)
+}
+
+func writeJSONStatus(ctx context.Context, res http.ResponseWriter, status int, data interface{}) {
 	log := logr.FromContextOrDiscard(ctx)
 
 	bytes, err := json.Marshal(data)
@@ -42,7 +46,7 @@ func writeJSON(ctx context.Context, res http.ResponseWriter, data interface{}) {
 	}
 
 	res.Header().Set("Content-Type", "application/json")
-	res.WriteHeader(http.StatusOK)
+	res.WriteHeader(status)
 
 	if _, err := res.Write(bytes); err != nil {
 		log.Error(err, "error writing response")
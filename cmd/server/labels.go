@@ -1,16 +1,33 @@
 package main
 
 import (
+	"errors"
 	"net/http"
+	"sort"
+	"strconv"
 
+	"github.com/go-logr/logr"
 	"github.com/julienschmidt/httprouter"
 	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/labelstore"
 )
 
+// labelCatalog is implemented by the stores which keep a catalog of labels.
+type labelCatalog interface {
+	LabelCatalog() []labelstore.LabelCount
+}
+
+// handleLabels returns the label keys and their values of the resources the
+// caller can read, only those of the keys in the request body if any. The
+// url query can restrict the resources to some types, e.g. ?type=Server, and
+// ask for the number of resources of each type with each value with
+// withCounts=true.
 func handleLabels() httprouter.Handle {
 	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 		ctx := req.Context()
-		api, ok := ctx.Value(ResourcesCtxKey).(*ResourceAPI)
+		log := logr.FromContextOrDiscard(ctx)
+		api, claims, ok := apiContext(ctx)
 
 		if !ok {
 			res.WriteHeader(http.StatusInternalServerError)
@@ -22,31 +39,62 @@ func handleLabels() httprouter.Handle {
 			Labels []string `json:"labels"`
 		}{Labels: []string{}}
 
-		if err := readJSON(ctx, req, labelReq); err != nil {
+		if err := readJSON(ctx, req, labelReq); err != nil && !errors.Is(err, ErrEmptyBody) {
 			res.WriteHeader(http.StatusBadRequest)
 
 			return
 		}
 
-		matchSet := makeMatchSet(labelReq.Labels)
+		values := req.URL.Query()
+		withCounts := false
+
+		if val := values.Get("withCounts"); val != "" {
+			var err error
+
+			if withCounts, err = strconv.ParseBool(val); err != nil {
+				res.WriteHeader(http.StatusBadRequest)
+				log.Info("labels could not be returned, invalid withCounts")
+
+				return
+			}
+		}
+
+		counts := countLabels(labelCounts(api.Store), makeMatchSet(labelReq.Labels), values["type"],
+			func(scope labelstore.Scope) bool {
+				return claims.Read(auth.GroupKey(scope.Type, scope.Group))
+			})
 
 		labelRes := &struct {
-			Labels map[string][]string `json:"labels"`
-		}{}
-
-		// Iterate over all resources and cache the labels.
-		// We may have to optimize this query by adding a special
-		// store that will keep this cache intact as labels are
-		// added and removed to the resources. For now it a naive
-		// o(n)*o(m) implementation, where n is number of resources
-		// and m is amortized number of labels per resource
-		rMap := api.Store.Query()
-		labelRes.Labels = matchLabels(matchSet, rMap)
+			Labels map[string][]string                  `json:"labels"`
+			Counts map[string]map[string]map[string]int `json:"counts,omitempty"`
+		}{Labels: makeLabelValues(counts), Counts: nil}
+
+		if withCounts {
+			labelRes.Counts = counts
+		}
 
 		writeJSON(ctx, res, labelRes)
 	}
 }
 
+// labelCounts returns the label catalog of the store. The catalog is built
+// from all resources if the store does not keep one.
+func labelCounts(store zebra.Store) []labelstore.LabelCount {
+	if c, ok := store.(labelCatalog); ok {
+		return c.LabelCatalog()
+	}
+
+	catalog := labelstore.NewCatalog()
+
+	for t, l := range store.Query().Resources {
+		for _, r := range l.Resources {
+			catalog.Add(t, r.GetLabels())
+		}
+	}
+
+	return catalog.Counts()
+}
+
 func makeMatchSet(labels []string) map[string]struct{} {
 	matchSet := make(map[string]struct{}, len(labels))
 	for _, l := range labels {
@@ -56,43 +104,51 @@ func makeMatchSet(labels []string) map[string]struct{} {
 	return matchSet
 }
 
-func matchLabels(matchSet map[string]struct{}, rMap *zebra.ResourceMap) map[string][]string {
-	matchAny := len(matchSet) == 0
-	labelSet := make(map[string]map[string]struct{})
-
-	for _, resList := range rMap.Resources {
-		for _, r := range resList.Resources {
-			labels := r.GetLabels()
-			for k, v := range labels {
-				_, matchOk := matchSet[k] // check if key is list
-				matched := matchAny || matchOk
-
-				if matched {
-					valueSet, ok := labelSet[k]
-					if !ok {
-						valueSet = make(map[string]struct{})
-						labelSet[k] = valueSet
-					}
-
-					// add the value
-					valueSet[v] = struct{}{}
-				}
-			}
+// countLabels sums the label counts of the readable scopes by key, value and
+// type, only for the keys in the match set and the given types if not empty.
+func countLabels(labelCounts []labelstore.LabelCount, matchSet map[string]struct{}, types []string,
+	readable func(labelstore.Scope) bool,
+) map[string]map[string]map[string]int {
+	counts := make(map[string]map[string]map[string]int)
+
+	for _, c := range labelCounts {
+		if _, ok := matchSet[c.Key]; len(matchSet) != 0 && !ok {
+			continue
+		}
+
+		if len(types) != 0 && !zebra.IsIn(c.Type, types) {
+			continue
 		}
+
+		if !readable(c.Scope) {
+			continue
+		}
+
+		if counts[c.Key] == nil {
+			counts[c.Key] = make(map[string]map[string]int)
+		}
+
+		if counts[c.Key][c.Value] == nil {
+			counts[c.Key][c.Value] = make(map[string]int)
+		}
+
+		counts[c.Key][c.Value][c.Type] += c.Count
 	}
 
-	return makeLabelValues(labelSet)
+	return counts
 }
 
-func makeLabelValues(labelSet map[string]map[string]struct{}) map[string][]string {
+// makeLabelValues returns the sorted values of each label key.
+func makeLabelValues(counts map[string]map[string]map[string]int) map[string][]string {
 	labelVals := make(map[string][]string)
 
-	for k, valueSet := range labelSet {
-		valueList := make([]string, 0, len(valueSet))
-		for v := range valueSet {
+	for k, valueCounts := range counts {
+		valueList := make([]string, 0, len(valueCounts))
+		for v := range valueCounts {
 			valueList = append(valueList, v)
 		}
 
+		sort.Strings(valueList)
 		labelVals[k] = valueList
 	}
 
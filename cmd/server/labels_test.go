@@ -13,6 +13,7 @@ import (
 
 	"github.com/project-safari/zebra"
 	"github.com/project-safari/zebra/dc"
+	"github.com/project-safari/zebra/network"
 	"github.com/project-safari/zebra/store"
 	"github.com/stretchr/testify/assert"
 )
@@ -43,7 +44,7 @@ func makeStore(assert *assert.Assertions, root string) zebra.Store {
 }
 
 func makeLabelRequest(assert *assert.Assertions, resources *ResourceAPI, labels ...string) *http.Request {
-	ctx := context.WithValue(context.Background(), ResourcesCtxKey, resources)
+	ctx := adminContext(context.Background(), resources)
 	ctx = context.WithValue(ctx, AuthCtxKey, authKey)
 
 	req, err := http.NewRequestWithContext(ctx, "GET", "/api/v1/labels", nil)
@@ -69,7 +70,7 @@ func TestBadLabelReq(t *testing.T) {
 		h(w, r, nil)
 	})
 
-	ctx := context.WithValue(context.Background(), ResourcesCtxKey, NewResourceAPI(store.DefaultFactory()))
+	ctx := adminContext(context.Background(), NewResourceAPI(store.DefaultFactory()))
 	req, err := http.NewRequestWithContext(ctx, "GET", "/api/v1/labels", nil)
 	assert.Nil(err)
 	assert.NotNil(req)
@@ -137,3 +138,106 @@ func TestLabels(t *testing.T) {
 
 	assert.Equal(rr.Code, http.StatusOK)
 }
+
+// TestLabelCounts checks the label counts of both store backends, which keep
+// their label catalogs differently.
+func TestLabelCounts(t *testing.T) { //nolint:funlen
+	t.Parallel()
+
+	for _, backend := range []string{store.FileBackend, store.DBBackend} {
+		backend := backend
+
+		t.Run(backend, func(t *testing.T) {
+			t.Parallel()
+			assert := assert.New(t)
+
+			root := "test_label_counts_" + backend
+
+			t.Cleanup(func() { os.RemoveAll(root) })
+
+			api := NewResourceAPI(store.DefaultFactory())
+			api.Backend = backend
+			assert.Nil(api.Initialize(root))
+
+			for i, labels := range []zebra.Labels{
+				{"system.group": "eng", "color": "red"},
+				{"system.group": "eng", "color": "red"},
+				{"system.group": "eng", "color": "blue"},
+				{"system.group": "ops", "color": "red"},
+			} {
+				lab := new(dc.Lab)
+				lab.BaseResource = *zebra.NewBaseResource("Lab", labels)
+				lab.Name = fmt.Sprintf("lab-%d", i)
+				assert.Nil(api.Store.Create(lab))
+			}
+
+			vlan := &network.VLANPool{
+				BaseResource: *zebra.NewBaseResource("VLANPool", zebra.Labels{"system.group": "eng", "color": "red"}),
+				RangeStart:   1,
+				RangeEnd:     10,
+			}
+			assert.Nil(api.Store.Create(vlan))
+
+			type labelRes struct {
+				Labels map[string][]string                  `json:"labels"`
+				Counts map[string]map[string]map[string]int `json:"counts"`
+			}
+
+			labels := func(ctx context.Context, query string, body string) (int, *labelRes) {
+				req, err := http.NewRequestWithContext(ctx, "GET", "/api/v1/labels?"+query, bytes.NewBufferString(body))
+				assert.Nil(err)
+
+				rr := httptest.NewRecorder()
+				handleLabels()(rr, req, nil)
+
+				r := new(labelRes)
+				if rr.Code == http.StatusOK {
+					assert.Nil(json.Unmarshal(rr.Body.Bytes(), r))
+				}
+
+				return rr.Code, r
+			}
+
+			admin := adminContext(context.Background(), api)
+
+			// No body is needed, counts are only returned if asked for
+			code, r := labels(admin, "", "")
+			assert.Equal(http.StatusOK, code)
+			assert.Equal([]string{"blue", "red"}, r.Labels["color"])
+			assert.Nil(r.Counts)
+
+			code, r = labels(admin, "withCounts=true", "")
+			assert.Equal(http.StatusOK, code)
+			assert.Equal(map[string]map[string]int{
+				"blue": {"Lab": 1},
+				"red":  {"Lab": 3, "VLANPool": 1},
+			}, r.Counts["color"])
+			assert.Equal(map[string]map[string]int{
+				"eng": {"Lab": 3, "VLANPool": 1},
+				"ops": {"Lab": 1},
+			}, r.Counts["system.group"])
+
+			code, r = labels(admin, "withCounts=true&type=VLANPool", `{"labels":["color"]}`)
+			assert.Equal(http.StatusOK, code)
+			assert.Equal(map[string]map[string]map[string]int{"color": {"red": {"VLANPool": 1}}}, r.Counts)
+
+			code, _ = labels(admin, "withCounts=maybe", "")
+			assert.Equal(http.StatusBadRequest, code)
+
+			// Only the resources the caller can read are counted
+			code, r = labels(userContext(assert, api, "Lab/eng:r"), "withCounts=true", "")
+			assert.Equal(http.StatusOK, code)
+			assert.Equal(map[string]map[string]int{"blue": {"Lab": 1}, "red": {"Lab": 2}}, r.Counts["color"])
+
+			// Counts follow updates and deletes
+			vlan.Labels["color"] = "blue"
+			assert.Nil(api.Store.Create(vlan))
+			assert.Nil(api.Store.Delete(vlan))
+
+			code, r = labels(admin, "withCounts=true&type=VLANPool", "")
+			assert.Equal(http.StatusOK, code)
+			assert.Empty(r.Counts)
+			assert.Empty(r.Labels)
+		})
+	}
+}
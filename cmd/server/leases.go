@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/audit"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/lease"
+)
+
+type LeaseRequest struct {
+	Duration time.Duration        `json:"duration"`
+	Request  []*lease.ResourceReq `json:"request"`
+}
+
+var ErrLeaseRequest = errors.New("invalid lease request body")
+
+func (lr *LeaseRequest) Validate(ctx context.Context) error {
+	if lr.Duration <= 0 || lr.Duration.Hours() > zebra.DefaultMaxDuration {
+		return ErrLeaseRequest
+	}
+
+	if len(lr.Request) == 0 {
+		return ErrLeaseRequest
+	}
+
+	for _, r := range lr.Request {
+		if r == nil || r.Type == "" || r.Count <= 0 || len(r.Resources) != 0 {
+			return ErrLeaseRequest
+		}
+
+		if err := validateQueries(r.Filters); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func handleLeaseRequest() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		log := logr.FromContextOrDiscard(ctx)
+		api, claims, ok := apiContext(ctx)
+
+		if !ok {
+			res.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		lr := new(LeaseRequest)
+
+		// Read request, return error if applicable
+		if err := readJSON(ctx, req, lr); err != nil {
+			res.WriteHeader(http.StatusBadRequest)
+			log.Info("lease could not be requested, could not read request")
+
+			return
+		}
+
+		if err := lr.Validate(ctx); err != nil {
+			res.WriteHeader(http.StatusBadRequest)
+			log.Info("lease could not be requested, found invalid request")
+
+			return
+		}
+
+		owner := findUser(api.Store, claims.Email)
+		if owner == nil {
+			res.WriteHeader(http.StatusUnauthorized)
+			log.Info("lease could not be requested, user not found", "user", claims.Email)
+
+			return
+		}
+
+		// Leasing changes the resources, requests for a group the caller can
+		// not update are not allowed. Requests without a group only get the
+		// resources the caller can update.
+		if denied := forbiddenRequests(claims, lr.Request); len(denied) != 0 {
+			writeForbidden(ctx, res, claims, denied)
+
+			return
+		}
+
+		l := lease.NewLease(*owner, lr.Duration, lr.Request)
+
+		queued := queuedSnapshots(api)
+
+		l, activated, err := api.Allocator.Request(l)
+		if err != nil {
+			if errors.Is(err, lease.ErrNoCapacity) {
+				res.WriteHeader(http.StatusConflict)
+				log.Info("lease can never be satisfied", "user", claims.Email)
+
+				return
+			}
+
+			res.WriteHeader(http.StatusInternalServerError)
+			log.Error(err, "internal server error while allocating lease")
+
+			return
+		}
+
+		recordLease(ctx, api, audit.ActionLease, l, nil, leasedIDs(l))
+		recordActivated(ctx, api, activated, queued)
+
+		if !l.IsValid() {
+			log.Info("lease queued, waiting for free resources", "lease", l.ID, "user", claims.Email)
+			writeJSONStatus(ctx, res, http.StatusAccepted, l)
+
+			return
+		}
+
+		log.Info("successfully leased resources", "lease", l.ID, "user", claims.Email)
+
+		writeJSON(ctx, res, l)
+	}
+}
+
+func handleLeaseList() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		api, claims, ok := apiContext(ctx)
+
+		if !ok {
+			res.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		// By default only the leases owned by the caller are returned, all
+		// leases the caller can read are returned on request. The leased
+		// resources the caller cannot read are left out.
+		all := req.URL.Query().Get("all") == "true"
+
+		leaseRes := &struct {
+			Leases []*lease.Lease `json:"leases"`
+		}{Leases: []*lease.Lease{}}
+
+		for _, l := range findLeases(api.Store) {
+			if l.Owner() != claims.Email && (!all || !canRead(claims, l)) {
+				continue
+			}
+
+			if readable, ok := readableLease(api, claims, l); ok {
+				leaseRes.Leases = append(leaseRes.Leases, readable)
+			}
+		}
+
+		writeJSON(ctx, res, leaseRes)
+	}
+}
+
+func handleLeaseRelease() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		log := logr.FromContextOrDiscard(ctx)
+		api, claims, ok := apiContext(ctx)
+
+		if !ok {
+			res.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		l := findLease(api.Store, params.ByName("id"))
+		if l == nil {
+			res.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		// Only the owner or a user allowed to delete leases can release it
+		if l.Owner() != claims.Email && !claims.Delete(auth.KeyOf(l)) {
+			res.WriteHeader(http.StatusForbidden)
+			log.Info("lease could not be released, not allowed", "lease", l.ID, "user", claims.Email)
+
+			return
+		}
+
+		queued := queuedSnapshots(api)
+
+		released, activated, err := api.Allocator.Release(l)
+		if err != nil {
+			if errors.Is(err, lease.ErrLeaseEnded) {
+				res.WriteHeader(http.StatusConflict)
+				log.Info("lease could not be released, not active or queued", "lease", l.ID, "user", claims.Email)
+
+				return
+			}
+
+			res.WriteHeader(http.StatusInternalServerError)
+			log.Error(err, "internal server error while releasing lease")
+
+			return
+		}
+
+		recordLease(ctx, api, audit.ActionRelease, released, audit.Snapshot(l), leasedIDs(l))
+		recordActivated(ctx, api, activated, queued)
+
+		log.Info("successfully released lease", "lease", l.ID, "user", claims.Email)
+
+		writeJSON(ctx, res, released)
+	}
+}
+
+func handleLeaseExtend() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		log := logr.FromContextOrDiscard(ctx)
+		api, claims, ok := apiContext(ctx)
+
+		if !ok {
+			res.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		extendReq := &struct {
+			Duration time.Duration `json:"duration"`
+		}{}
+
+		if err := readJSON(ctx, req, extendReq); err != nil {
+			res.WriteHeader(http.StatusBadRequest)
+			log.Info("lease could not be extended, could not read request")
+
+			return
+		}
+
+		l := findLease(api.Store, params.ByName("id"))
+		if l == nil {
+			res.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		// Only the owner or a user allowed to update leases can extend it
+		if l.Owner() != claims.Email && !claims.Update(auth.KeyOf(l)) {
+			res.WriteHeader(http.StatusForbidden)
+			log.Info("lease could not be extended, not allowed", "lease", l.ID, "user", claims.Email)
+
+			return
+		}
+
+		extended, err := api.Allocator.Extend(l, extendReq.Duration)
+		if err != nil {
+			if errors.Is(err, lease.ErrLeaseValid) || errors.Is(err, lease.ErrLeaseExtend) {
+				res.WriteHeader(http.StatusBadRequest)
+				log.Info("lease could not be extended", "lease", l.ID, "error", err.Error())
+
+				return
+			}
+
+			res.WriteHeader(http.StatusInternalServerError)
+			log.Error(err, "internal server error while extending lease")
+
+			return
+		}
+
+		recordLease(ctx, api, audit.ActionExtend, extended, audit.Snapshot(l), leasedIDs(l))
+
+		log.Info("successfully extended lease", "lease", l.ID, "user", claims.Email)
+
+		writeJSON(ctx, res, extended)
+	}
+}
+
+// forbiddenRequests returns the type and group keys of the lease requests for
+// a group the claims do not allow leasing in.
+func forbiddenRequests(claims *auth.Claims, reqs []*lease.ResourceReq) []string {
+	keys := []string{}
+
+	for _, r := range reqs {
+		key := auth.GroupKey(r.Type, r.Group)
+		if r.Group != "" && !claims.Update(key) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// readableLease returns the lease with only the leased resources the claims
+// allow reading, or false if it cannot be copied. The stored lease is not
+// changed, a copy is returned if any resource is left out.
+func readableLease(api *ResourceAPI, claims *auth.Claims, l *lease.Lease) (*lease.Lease, bool) {
+	if canReadLeased(claims, l) {
+		return l, true
+	}
+
+	res, err := zebra.CopyResource(api.factory, l)
+	if err != nil {
+		return nil, false
+	}
+
+	copied, ok := res.(*lease.Lease)
+	if !ok {
+		return nil, false
+	}
+
+	for _, r := range copied.RequestList() {
+		resources := []zebra.Resource{}
+
+		for _, res := range r.Resources {
+			if canRead(claims, res) {
+				resources = append(resources, res)
+			}
+		}
+
+		r.Resources = resources
+	}
+
+	return copied, true
+}
+
+// canReadLeased returns true if the claims allow reading all the resources
+// leased by the lease.
+func canReadLeased(claims *auth.Claims, l *lease.Lease) bool {
+	for _, r := range l.RequestList() {
+		for _, res := range r.Resources {
+			if !canRead(claims, res) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func findLeases(store zebra.Store) []*lease.Lease {
+	leases := []*lease.Lease{}
+
+	for _, l := range store.QueryType([]string{"Lease"}).Resources {
+		for _, r := range l.Resources {
+			if aLease, ok := r.(*lease.Lease); ok {
+				leases = append(leases, aLease)
+			}
+		}
+	}
+
+	return leases
+}
+
+func findLease(store zebra.Store, id string) *lease.Lease {
+	for _, l := range store.QueryUUID([]string{id}).Resources {
+		for _, r := range l.Resources {
+			if aLease, ok := r.(*lease.Lease); ok {
+				return aLease
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,333 @@
+package main //nolint:testpackage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/lease"
+	"github.com/project-safari/zebra/network"
+	"github.com/project-safari/zebra/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeLeaseAPI(assert *assert.Assertions, root string, users ...*auth.User) *ResourceAPI {
+	api := NewResourceAPI(store.DefaultFactory())
+	assert.Nil(api.Initialize(root))
+
+	for _, u := range users {
+		assert.Nil(api.Store.Create(u))
+	}
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(api.Store.Create(&network.VLANPool{
+			BaseResource: *zebra.NewBaseResource("VLANPool", zebra.Labels{"system.group": "eng"}),
+			RangeStart:   0,
+			RangeEnd:     10,
+		}))
+	}
+
+	return api
+}
+
+func makeReadOnlyUser(assert *assert.Assertions) *auth.User {
+	key, err := auth.Generate()
+	assert.Nil(err)
+
+	return auth.NewUser("reader", "reader@domain", jiniWords, key, zebra.Labels{"system.group": "users"})
+}
+
+// grantLease allows the user to lease the resources with the given key.
+func grantLease(assert *assert.Assertions, user *auth.User, key string) {
+	priv, err := auth.NewPriv(key, false, false, true, false)
+	assert.Nil(err)
+
+	user.Role.Privileges = append(user.Role.Privileges, priv)
+}
+
+func makeLeaseRequest(assert *assert.Assertions, api *ResourceAPI, user *auth.User,
+	method string, url string, body interface{},
+) *http.Request {
+	ctx := context.WithValue(context.Background(), ResourcesCtxKey, api)
+	ctx = context.WithValue(ctx, ClaimsCtxKey, auth.NewClaims("zebra", user.Name, user.Role, user.Email))
+
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	assert.Nil(err)
+	assert.NotNil(req)
+
+	req.Body = ioutil.NopCloser(bytes.NewBuffer(nil))
+
+	if body != nil {
+		b, e := json.Marshal(body)
+		assert.Nil(e)
+
+		req.Body = ioutil.NopCloser(bytes.NewBuffer(b))
+	}
+
+	return req
+}
+
+func serveLease(h httprouter.Handle, req *http.Request, id string) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	h(rr, req, httprouter.Params{{Key: "id", Value: id}})
+
+	return rr
+}
+
+func TestLeaseRequest(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_lease_request"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	user := makeUser(assert)
+	api := makeLeaseAPI(assert, root, user)
+	h := handleLeaseRequest()
+
+	// No body
+	req := makeLeaseRequest(assert, api, user, "POST", "/api/v1/leases", nil)
+	assert.Equal(http.StatusBadRequest, serveLease(h, req, "").Code)
+
+	// Too long
+	lr := &LeaseRequest{
+		Duration: 5 * time.Hour,
+		Request:  []*lease.ResourceReq{{Type: "VLANPool", Group: "eng", Count: 2}},
+	}
+	req = makeLeaseRequest(assert, api, user, "POST", "/api/v1/leases", lr)
+	assert.Equal(http.StatusBadRequest, serveLease(h, req, "").Code)
+
+	// Not enough resources in the inventory
+	lr.Duration = time.Hour
+	lr.Request[0].Count = 4
+	req = makeLeaseRequest(assert, api, user, "POST", "/api/v1/leases", lr)
+	assert.Equal(http.StatusConflict, serveLease(h, req, "").Code)
+
+	lr.Request[0].Count = 2
+	req = makeLeaseRequest(assert, api, user, "POST", "/api/v1/leases", lr)
+	rr := serveLease(h, req, "")
+	assert.Equal(http.StatusOK, rr.Code)
+
+	l := new(struct {
+		ID     string       `json:"id"`
+		Status zebra.Status `json:"status"`
+	})
+	assert.Nil(json.Unmarshal(rr.Body.Bytes(), l))
+	assert.Equal(zebra.Active, l.Status.State)
+	assert.Equal(user.Email, l.Status.UsedBy)
+	assert.NotNil(findLease(api.Store, l.ID))
+
+	// Not enough free resources, lease is queued
+	req = makeLeaseRequest(assert, api, user, "POST", "/api/v1/leases", lr)
+	rr = serveLease(h, req, "")
+	assert.Equal(http.StatusAccepted, rr.Code)
+	assert.Nil(json.Unmarshal(rr.Body.Bytes(), l))
+	assert.Equal(zebra.Inactive, l.Status.State)
+	assert.Len(api.Allocator.Queue(), 1)
+
+	// Unknown user
+	req = makeLeaseRequest(assert, api, makeReadOnlyUser(assert), "POST", "/api/v1/leases", lr)
+	assert.Equal(http.StatusUnauthorized, serveLease(h, req, "").Code)
+
+	// Read only users can not lease
+	reader := makeReadOnlyUser(assert)
+	assert.Nil(api.Store.Create(reader))
+
+	req = makeLeaseRequest(assert, api, reader, "POST", "/api/v1/leases", lr)
+	rr = serveLease(h, req, "")
+	assert.Equal(http.StatusForbidden, rr.Code)
+	assert.Contains(rr.Body.String(), "VLANPool/eng")
+
+	// Requests without a group only get the resources the user can lease
+	grantLease(assert, reader, "VLANPool/ops")
+	lr.Request[0].Group = ""
+	req = makeLeaseRequest(assert, api, reader, "POST", "/api/v1/leases", lr)
+	assert.Equal(http.StatusConflict, serveLease(h, req, "").Code)
+
+	// No claims
+	req = createRequest(assert, "POST", "/api/v1/leases", "", api)
+	assert.Equal(http.StatusInternalServerError, serveLease(h, req, "").Code)
+}
+
+func TestLeaseList(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_lease_list"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	user := makeUser(assert)
+	reader := makeReadOnlyUser(assert)
+	api := makeLeaseAPI(assert, root, user, reader)
+
+	l, err := api.Allocator.Allocate(lease.NewLease(*user, time.Hour,
+		[]*lease.ResourceReq{{Type: "VLANPool", Group: "eng", Count: 1}}))
+	assert.Nil(err)
+
+	leaseRes := &struct {
+		Leases []map[string]interface{} `json:"leases"`
+	}{}
+
+	h := handleLeaseList()
+
+	req := makeLeaseRequest(assert, api, user, "GET", "/api/v1/leases", nil)
+	rr := serveLease(h, req, "")
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.Nil(json.Unmarshal(rr.Body.Bytes(), leaseRes))
+	assert.Len(leaseRes.Leases, 1)
+
+	// Reader does not own any lease
+	req = makeLeaseRequest(assert, api, reader, "GET", "/api/v1/leases", nil)
+	rr = serveLease(h, req, "")
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.Nil(json.Unmarshal(rr.Body.Bytes(), leaseRes))
+	assert.Empty(leaseRes.Leases)
+
+	// But can read all leases
+	req = makeLeaseRequest(assert, api, reader, "GET", "/api/v1/leases?all=true", nil)
+	rr = serveLease(h, req, "")
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.Nil(json.Unmarshal(rr.Body.Bytes(), leaseRes))
+	assert.Len(leaseRes.Leases, 1)
+	assert.Contains(rr.Body.String(), l.Request[0].Resources[0].GetID())
+
+	// Leases are read by type and group, the leased resources the caller
+	// cannot read are left out
+	priv, err := auth.NewPriv("^Lease/leases$", false, true, false, false)
+	assert.Nil(err)
+
+	reader.Role.Privileges = []*auth.Priv{priv}
+	req = makeLeaseRequest(assert, api, reader, "GET", "/api/v1/leases?all=true", nil)
+	rr = serveLease(h, req, "")
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.Nil(json.Unmarshal(rr.Body.Bytes(), leaseRes))
+	assert.Len(leaseRes.Leases, 1)
+	assert.NotContains(rr.Body.String(), l.Request[0].Resources[0].GetID())
+	assert.Len(findLease(api.Store, l.ID).Request[0].Resources, 1)
+
+	reader.Role.Privileges = []*auth.Priv{}
+	req = makeLeaseRequest(assert, api, reader, "GET", "/api/v1/leases?all=true", nil)
+	rr = serveLease(h, req, "")
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.Nil(json.Unmarshal(rr.Body.Bytes(), leaseRes))
+	assert.Empty(leaseRes.Leases)
+
+	req = createRequest(assert, "GET", "/api/v1/leases", "", api)
+	assert.Equal(http.StatusInternalServerError, serveLease(h, req, "").Code)
+}
+
+func TestLeaseRelease(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_lease_release"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	user := makeUser(assert)
+	reader := makeReadOnlyUser(assert)
+	grantLease(assert, reader, "VLANPool/eng")
+	api := makeLeaseAPI(assert, root, user, reader)
+
+	l, err := api.Allocator.Allocate(lease.NewLease(*reader, time.Hour,
+		[]*lease.ResourceReq{{Type: "VLANPool", Group: "eng", Count: 3}}))
+	assert.Nil(err)
+
+	other := lease.NewLease(*user, time.Hour, []*lease.ResourceReq{{Type: "VLANPool", Group: "eng", Count: 1}})
+	_, err = api.Allocator.Allocate(other)
+	assert.Equal(lease.ErrNoResources, err)
+
+	h := handleLeaseRelease()
+	url := fmt.Sprintf("/api/v1/leases/%s/release", l.ID)
+
+	req := makeLeaseRequest(assert, api, reader, "POST", url, nil)
+	assert.Equal(http.StatusNotFound, serveLease(h, req, "unknown").Code)
+
+	// Owner can release
+	req = makeLeaseRequest(assert, api, reader, "POST", url, nil)
+	assert.Equal(http.StatusOK, serveLease(h, req, l.ID).Code)
+	assert.Equal(zebra.Inactive, findLease(api.Store, l.ID).GetStatus().State)
+
+	other, err = api.Allocator.Allocate(other)
+	assert.Nil(err)
+
+	// Released leases can not be released again
+	req = makeLeaseRequest(assert, api, reader, "POST", url, nil)
+	assert.Equal(http.StatusConflict, serveLease(h, req, l.ID).Code)
+
+	// Reader can not release someone elses lease, admin can
+	req = makeLeaseRequest(assert, api, reader, "POST", url, nil)
+	assert.Equal(http.StatusForbidden, serveLease(h, req, other.ID).Code)
+
+	// Leases are released by type and group
+	priv, err := auth.NewPriv("^Lease/leases$", false, false, false, true)
+	assert.Nil(err)
+
+	reader.Role.Privileges = append(reader.Role.Privileges, priv)
+	req = makeLeaseRequest(assert, api, reader, "POST", url, nil)
+	assert.Equal(http.StatusOK, serveLease(h, req, other.ID).Code)
+
+	req = createRequest(assert, "POST", url, "", api)
+	assert.Equal(http.StatusInternalServerError, serveLease(h, req, l.ID).Code)
+}
+
+func TestLeaseExtend(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_lease_extend"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	user := makeUser(assert)
+	reader := makeReadOnlyUser(assert)
+	api := makeLeaseAPI(assert, root, user, reader)
+
+	l, err := api.Allocator.Allocate(lease.NewLease(*user, time.Hour,
+		[]*lease.ResourceReq{{Type: "VLANPool", Group: "eng", Count: 1}}))
+	assert.Nil(err)
+
+	h := handleLeaseExtend()
+	url := fmt.Sprintf("/api/v1/leases/%s/extend", l.ID)
+	extend := map[string]time.Duration{"duration": 2 * time.Hour}
+
+	req := makeLeaseRequest(assert, api, user, "POST", url, nil)
+	assert.Equal(http.StatusBadRequest, serveLease(h, req, l.ID).Code)
+
+	req = makeLeaseRequest(assert, api, user, "POST", url, extend)
+	assert.Equal(http.StatusNotFound, serveLease(h, req, "unknown").Code)
+
+	req = makeLeaseRequest(assert, api, reader, "POST", url, extend)
+	assert.Equal(http.StatusForbidden, serveLease(h, req, l.ID).Code)
+
+	// Leases are extended by type and group
+	grantLease(assert, reader, "^Lease/leases$")
+
+	req = makeLeaseRequest(assert, api, reader, "POST", url, map[string]time.Duration{"duration": time.Hour})
+	assert.Equal(http.StatusOK, serveLease(h, req, l.ID).Code)
+	assert.Equal(2*time.Hour, findLease(api.Store, l.ID).Duration)
+
+	req = makeLeaseRequest(assert, api, user, "POST", url, map[string]time.Duration{"duration": time.Hour})
+	assert.Equal(http.StatusOK, serveLease(h, req, l.ID).Code)
+	assert.Equal(3*time.Hour, findLease(api.Store, l.ID).Duration)
+
+	// Can not go beyond max duration
+	req = makeLeaseRequest(assert, api, user, "POST", url, extend)
+	assert.Equal(http.StatusBadRequest, serveLease(h, req, l.ID).Code)
+	assert.Equal(3*time.Hour, findLease(api.Store, l.ID).Duration)
+
+	req = createRequest(assert, "POST", url, "", api)
+	assert.Equal(http.StatusInternalServerError, serveLease(h, req, l.ID).Code)
+}
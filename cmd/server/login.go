@@ -2,15 +2,19 @@ package main
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/audit"
 	"github.com/project-safari/zebra/auth"
 	"gojini.dev/web"
 )
 
+var ErrUserNotFound = errors.New("user not found")
+
 func loginAdapter() web.Adapter {
 	return func(nextHandler http.Handler) http.Handler {
 		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
@@ -51,6 +55,7 @@ func loginAdapter() web.Adapter {
 			user := findUser(api.Store, userData.Email)
 			if user == nil {
 				log.Error(nil, "user not found", "user", userData.Email)
+				recordAuth(ctx, api, audit.ActionLogin, audit.MethodPassword, userData.Email, ErrUserNotFound)
 				res.WriteHeader(http.StatusUnauthorized)
 
 				return
@@ -58,11 +63,14 @@ func loginAdapter() web.Adapter {
 
 			if err := user.AuthenticatePassword(userData.Password); err != nil {
 				log.Error(err, "user auth failed", "user", user.Email)
+				recordAuth(ctx, api, audit.ActionLogin, audit.MethodPassword, user.Email, err)
 				res.WriteHeader(http.StatusUnauthorized)
 
 				return
 			}
 
+			recordAuth(ctx, api, audit.ActionLogin, audit.MethodPassword, user.Email, nil)
+
 			claims := auth.NewClaims("zebra", user.Name, user.Role, user.Email)
 			respondWithClaims(ctx, res, claims, authKey)
 
@@ -82,7 +90,10 @@ func makeCookie(jwt string) *http.Cookie {
 
 func findUser(store zebra.Store, email string) *auth.User {
 	resMap := store.QueryType([]string{"User"})
-	users := resMap.Resources["User"]
+	users, ok := resMap.Resources["User"]
+	if !ok {
+		return nil
+	}
 
 	for _, u := range users.Resources {
 		user, ok := u.(*auth.User)
@@ -61,6 +61,7 @@ func startServer(cfgStore *config.Store) error {
 	}
 
 	setup := setupAdapter(appCtx, cfgStore)
+	metrics := metricsAdapter()
 	login := loginAdapter()
 	register := registerAdapter()
 	auth := authAdapter()
@@ -68,11 +69,12 @@ func startServer(cfgStore *config.Store) error {
 	routes := routeHandler()
 
 	// The order of wrap matters, routes is the final handler that is being
-	// wrapped. setup, login and register are unauthenticated APIs that serve
-	// as a way to bootstrap authentication. auth, refresh and all endpoints
-	// registered by routes must be authenticated either via a jwt in the cookie
+	// wrapped. metrics counts and times all requests after setup. login and
+	// register are unauthenticated APIs that serve as a way to bootstrap
+	// authentication. auth, refresh and all endpoints registered by routes,
+	// /metrics included, must be authenticated either via a jwt in the cookie
 	// or via a rsa key token in the header.
-	handler := web.Wrap(routes, setup, login, register, auth, refresh)
+	handler := web.Wrap(routes, setup, metrics, login, register, auth, refresh)
 
 	webServer := web.NewServer(serverCfg, handler)
 
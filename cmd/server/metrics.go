@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/audit"
+	"github.com/project-safari/zebra/lease"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gojini.dev/web"
+)
+
+// Reasons of authentication failures.
+const (
+	ReasonNoCredentials = "no_credentials"
+	ReasonUserNotFound  = "user_not_found"
+	ReasonBadPassword   = "bad_password"
+	ReasonBadToken      = "bad_token"
+	ReasonBadJWT        = "bad_jwt"
+)
+
+// OtherRoute is the route label of the requests which match no route, so
+// that unknown paths do not create a series each.
+const OtherRoute = "other"
+
+// Metrics are the server metrics exposed in the Prometheus text format at
+// /metrics. The resource and lease gauges are kept up to date with the store
+// changes, see watchStore, so that a scrape does not walk the store.
+type Metrics struct {
+	registry     *prometheus.Registry
+	handler      http.Handler
+	requests     *prometheus.CounterVec
+	latency      *prometheus.HistogramVec
+	authFailures *prometheus.CounterVec
+	storeLatency *prometheus.HistogramVec
+	resources    *prometheus.GaugeVec
+	leases       prometheus.Gauge
+	lock         sync.Mutex
+	states       map[string]resourceState
+}
+
+// resourceState is what a resource adds to the resource and lease gauges.
+type resourceState struct {
+	resType string
+	lease   string
+	active  bool
+}
+
+func NewMetrics() *Metrics {
+	r := prometheus.NewRegistry()
+	m := &Metrics{
+		registry: r,
+		handler:  promhttp.HandlerFor(r, promhttp.HandlerOpts{}), //nolint:exhaustivestruct,exhaustruct
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{ //nolint:exhaustivestruct,exhaustruct
+			Name: "zebra_http_requests_total",
+			Help: "Number of http requests by method, route and status code.",
+		}, []string{"method", "route", "code"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{ //nolint:exhaustivestruct,exhaustruct
+			Name: "zebra_http_request_duration_seconds",
+			Help: "Latency of http requests by method and route.",
+		}, []string{"method", "route"}),
+		authFailures: prometheus.NewCounterVec(prometheus.CounterOpts{ //nolint:exhaustivestruct,exhaustruct
+			Name: "zebra_auth_failures_total",
+			Help: "Number of failed authentications by method and reason.",
+		}, []string{"method", "reason"}),
+		storeLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{ //nolint:exhaustivestruct,exhaustruct
+			Name: "zebra_store_operation_duration_seconds",
+			Help: "Latency of store operations by store and operation.",
+		}, []string{"store", "op"}),
+		resources: prometheus.NewGaugeVec(prometheus.GaugeOpts{ //nolint:exhaustivestruct,exhaustruct
+			Name: "zebra_resources",
+			Help: "Number of resources by type and lease state.",
+		}, []string{"type", "lease"}),
+		leases: prometheus.NewGauge(prometheus.GaugeOpts{ //nolint:exhaustivestruct,exhaustruct
+			Name: "zebra_active_leases",
+			Help: "Number of active leases.",
+		}),
+		lock:   sync.Mutex{},
+		states: make(map[string]resourceState),
+	}
+
+	r.MustRegister(m.requests, m.latency, m.authFailures, m.storeLatency, m.resources, m.leases)
+
+	return m
+}
+
+// authFailure counts a failed authentication, m may be nil.
+func (m *Metrics) authFailure(method string, reason string) {
+	if m != nil {
+		m.authFailures.WithLabelValues(method, reason).Inc()
+	}
+}
+
+// watchStore keeps the resource and lease gauges up to date with the store
+// changes until the context is done. The store is walked once when watching
+// starts, and again only if the watch falls behind. It is meant to be run in
+// its own goroutine.
+func (m *Metrics) watchStore(ctx context.Context, store zebra.Store) {
+	log := logr.FromContextOrDiscard(ctx)
+
+	for {
+		events, cancel, err := store.Watch(0)
+		if err != nil {
+			log.Error(err, "failed to watch the store, resource metrics are not updated")
+
+			return
+		}
+
+		// Events of changes made during the walk are applied after it, the
+		// last event of a resource leaves it in its current state.
+		m.reset(store)
+
+		done := m.follow(ctx, events)
+
+		cancel()
+
+		if done {
+			return
+		}
+	}
+}
+
+// follow applies the store events to the gauges until the context is done,
+// when it returns true, or the events channel is closed.
+func (m *Metrics) follow(ctx context.Context, events <-chan zebra.Event) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			return true
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+
+			if event.Type == zebra.EventDelete {
+				m.forget(event.Resource.GetID())
+			} else {
+				m.track(event.Resource)
+			}
+		}
+	}
+}
+
+// reset sets the gauges from the stored resources.
+func (m *Metrics) reset(store zebra.Store) {
+	m.lock.Lock()
+	m.states = make(map[string]resourceState)
+	m.resources.Reset()
+	m.leases.Set(0)
+	m.lock.Unlock()
+
+	for _, list := range store.Query().Resources {
+		for _, res := range list.Resources {
+			m.track(res)
+		}
+	}
+}
+
+// track counts the resource in its current state, instead of the state it
+// was counted in before.
+func (m *Metrics) track(res zebra.Resource) {
+	status := res.GetStatus()
+	_, isLease := res.(*lease.Lease)
+	state := resourceState{
+		resType: res.GetType(),
+		lease:   status.Lease.String(),
+		active:  isLease && status.State == zebra.Active,
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.untrack(res.GetID())
+	m.states[res.GetID()] = state
+	m.resources.WithLabelValues(state.resType, state.lease).Inc()
+
+	if state.active {
+		m.leases.Inc()
+	}
+}
+
+// forget stops counting the deleted resource.
+func (m *Metrics) forget(id string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.untrack(id)
+}
+
+// untrack removes the resource from the gauges, m.lock must be held.
+func (m *Metrics) untrack(id string) {
+	state, ok := m.states[id]
+	if !ok {
+		return
+	}
+
+	delete(m.states, id)
+	m.resources.WithLabelValues(state.resType, state.lease).Dec()
+
+	if state.active {
+		m.leases.Dec()
+	}
+}
+
+// handleMetrics serves the metrics to authenticated callers.
+func handleMetrics() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		api, ok := req.Context().Value(ResourcesCtxKey).(*ResourceAPI)
+		if !ok || api.Metrics == nil {
+			res.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		api.Metrics.handler.ServeHTTP(res, req)
+	}
+}
+
+// authFailureReason returns the reason of the authentication failure err of
+// the audited action.
+func authFailureReason(action string, method string, err error) string {
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		return ReasonUserNotFound
+	case action == audit.ActionLogin:
+		return ReasonBadPassword
+	case method == audit.MethodRSA:
+		return ReasonBadToken
+	default:
+		return ReasonBadJWT
+	}
+}
+
+// statusRecorder records the status code written by the next handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// Flush flushes the response, if the response writer can, so that watches
+// can be streamed through the recorder.
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// routeOf returns the route of the request, the path with the route
+// parameters replaced by their names, e.g. /api/v1/leases/:id/release.
+func routeOf(router *httprouter.Router, req *http.Request) string {
+	switch req.URL.Path {
+	case "/login", "/register", "/refresh":
+		return req.URL.Path
+	}
+
+	handle, params, _ := router.Lookup(req.Method, req.URL.Path)
+	if handle == nil {
+		return OtherRoute
+	}
+
+	segments := strings.Split(req.URL.Path, "/")
+	i := 0
+
+	for _, p := range params {
+		for ; i < len(segments); i++ {
+			if segments[i] == p.Value {
+				segments[i] = ":" + p.Key
+
+				break
+			}
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// metricsAdapter counts and times all requests by route, except the scrapes
+// of /metrics.
+func metricsAdapter() web.Adapter {
+	router := newRouter()
+
+	return func(nextHandler http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			api, ok := req.Context().Value(ResourcesCtxKey).(*ResourceAPI)
+			if !ok || api.Metrics == nil {
+				callNext(nextHandler, res, req)
+
+				return
+			}
+
+			if req.URL.Path == "/metrics" {
+				callNext(nextHandler, res, req)
+
+				return
+			}
+
+			m := api.Metrics
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: res, status: http.StatusOK}
+
+			callNext(nextHandler, rec, req)
+
+			route := routeOf(router, req)
+			m.requests.WithLabelValues(req.Method, route, strconv.Itoa(rec.status)).Inc()
+			m.latency.WithLabelValues(req.Method, route).Observe(time.Since(start).Seconds())
+		})
+	}
+}
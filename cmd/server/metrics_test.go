@@ -0,0 +1,115 @@
+package main //nolint:testpackage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/lease"
+	"github.com/project-safari/zebra/network"
+	"github.com/project-safari/zebra/store"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testmetrics"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	api := NewResourceAPI(store.DefaultFactory())
+	assert.Nil(api.Initialize(root))
+	assert.Nil(api.Store.Create(&network.VLANPool{
+		BaseResource: *zebra.NewBaseResource("VLANPool", zebra.Labels{"system.group": "eng"}),
+		RangeStart:   0,
+		RangeEnd:     10,
+	}))
+
+	ctx := adminContext(context.Background(), api)
+	ctx = context.WithValue(ctx, AuthCtxKey, authKey)
+	handler := metricsAdapter()(routeHandler())
+
+	serve := func(ctx context.Context, method string, path string) *httptest.ResponseRecorder {
+		req, err := http.NewRequestWithContext(ctx, method, path, nil)
+		assert.Nil(err)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	assert.Equal(http.StatusOK, serve(ctx, "GET", "/api/v1/leases").Code)
+	assert.Equal(http.StatusNotFound, serve(ctx, "POST", "/api/v1/leases/0123/release").Code)
+	assert.Equal(http.StatusNotFound, serve(ctx, "GET", "/api/v1/nowhere").Code)
+
+	m := api.Metrics
+	assert.Equal(1.0, testutil.ToFloat64(m.requests.WithLabelValues("GET", "/api/v1/leases", "200")))
+	assert.Equal(1.0, testutil.ToFloat64(m.requests.WithLabelValues("POST", "/api/v1/leases/:id/release", "404")))
+	assert.Equal(1.0, testutil.ToFloat64(m.requests.WithLabelValues("GET", OtherRoute, "404")))
+
+	// Authentication failures by reason
+	auth := authAdapter()(nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", "/api/v1/leases", nil)
+	assert.Nil(err)
+	auth.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(1.0, testutil.ToFloat64(m.authFailures.WithLabelValues("", ReasonNoCredentials)))
+
+	req.AddCookie(&http.Cookie{Name: "jwt", Value: "bad"}) //nolint:exhaustivestruct,exhaustruct
+	auth.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(1.0, testutil.ToFloat64(m.authFailures.WithLabelValues("jwt", ReasonBadJWT)))
+
+	login := loginAdapter()(nil)
+	login.ServeHTTP(httptest.NewRecorder(), makeLoginRequest(assert, "jini", jiniWords, "nobody@domain", api))
+	assert.Equal(1.0, testutil.ToFloat64(m.authFailures.WithLabelValues("password", ReasonUserNotFound)))
+
+	// The resource gauges follow the store
+	watchCtx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	go m.watchStore(watchCtx, api.Store)
+
+	assert.Eventually(func() bool {
+		return testutil.ToFloat64(m.resources.WithLabelValues("VLANPool", "free")) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	l := lease.NewLease(*makeUser(assert), time.Hour, []*lease.ResourceReq{{Type: "VLANPool", Group: "eng", Count: 1}})
+	_, _, err = api.Allocator.Request(l)
+	assert.Nil(err)
+
+	assert.Eventually(func() bool {
+		return testutil.ToFloat64(m.resources.WithLabelValues("VLANPool", "leased")) == 1 &&
+			testutil.ToFloat64(m.resources.WithLabelValues("VLANPool", "free")) == 0 &&
+			testutil.ToFloat64(m.leases) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// Scrapes must be authenticated
+	anonymous := context.WithValue(context.Background(), ResourcesCtxKey, api)
+	anonymous = context.WithValue(anonymous, AuthCtxKey, authKey)
+	req, err = http.NewRequestWithContext(anonymous, "GET", "/metrics", nil)
+	assert.Nil(err)
+
+	rr := httptest.NewRecorder()
+	metricsAdapter()(authAdapter()(routeHandler())).ServeHTTP(rr, req)
+	assert.Equal(http.StatusUnauthorized, rr.Code)
+
+	rr = serve(ctx, "GET", "/metrics")
+	assert.Equal(http.StatusOK, rr.Code)
+
+	body := rr.Body.String()
+	assert.Contains(body, `zebra_http_requests_total{code="200",method="GET",route="/api/v1/leases"} 1`)
+	assert.Contains(body, `zebra_auth_failures_total{method="jwt",reason="bad_jwt"} 1`)
+	assert.Contains(body, `zebra_store_operation_duration_seconds_count{op="commit",store="FileStore"}`)
+	assert.Contains(body, `zebra_resources{lease="leased",type="VLANPool"} 1`)
+	assert.Contains(body, "zebra_active_leases 1")
+
+	// The scrapes are not counted as requests
+	assert.NotContains(body, `route="/metrics"`)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+)
+
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+var ErrPatch = errors.New("invalid patch")
+
+// applyPatch applies a JSON Merge Patch (RFC 7386) or a JSON Patch (RFC 6902),
+// depending on the content type, to the json document. Merge patch is the
+// default. Patches which cannot be decoded return ErrPatch, the errors of
+// patches which cannot be applied wrap the jsonpatch errors.
+func applyPatch(contentType string, doc []byte, patch []byte) ([]byte, error) {
+	if !strings.HasPrefix(contentType, JSONPatchType) {
+		if !json.Valid(patch) {
+			return nil, ErrPatch
+		}
+
+		out, err := jsonpatch.MergePatch(doc, patch)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrPatch, err.Error())
+		}
+
+		return out, nil
+	}
+
+	ops, err := jsonpatch.DecodePatch(patch)
+	if err != nil {
+		return nil, ErrPatch
+	}
+
+	return ops.Apply(doc)
+}
@@ -0,0 +1,73 @@
+package main //nolint:testpackage
+
+import (
+	"errors"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergePatch(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	doc := `{"a":"b","c":{"d":"e","f":"g"},"l":[1,2]}`
+
+	out, err := applyPatch(MergePatchType, []byte(doc), []byte(`{"a":"z","c":{"f":null,"h":"i"},"l":[3]}`))
+	assert.Nil(err)
+	assert.JSONEq(`{"a":"z","c":{"d":"e","h":"i"},"l":[3]}`, string(out))
+
+	out, err = applyPatch("", []byte(doc), []byte(`{"c":null}`))
+	assert.Nil(err)
+	assert.JSONEq(`{"a":"b","l":[1,2]}`, string(out))
+
+	_, err = applyPatch(MergePatchType, []byte(doc), []byte(`{"a":`))
+	assert.Equal(ErrPatch, err)
+}
+
+func TestJSONPatch(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	doc := []byte(`{"labels":{"system.group":"eng"},"status":{"fault":"none"},"l":[1,2],"a/b":1}`)
+	patch := func(ops string) (string, error) {
+		out, err := applyPatch(JSONPatchType, doc, []byte(ops))
+
+		return string(out), err
+	}
+
+	out, err := patch(`[
+		{"op":"test","path":"/status/fault","value":"none"},
+		{"op":"add","path":"/labels/color","value":"red"},
+		{"op":"replace","path":"/status/fault","value":"major"},
+		{"op":"add","path":"/l/1","value":5},
+		{"op":"add","path":"/l/-","value":9},
+		{"op":"remove","path":"/l/0"},
+		{"op":"copy","from":"/labels","path":"/copy"},
+		{"op":"move","from":"/a~1b","path":"/ab"}
+	]`)
+	assert.Nil(err)
+	assert.JSONEq(`{"labels":{"system.group":"eng","color":"red"},"status":{"fault":"major"},`+
+		`"l":[5,2,9],"copy":{"system.group":"eng","color":"red"},"ab":1}`, out)
+
+	// Errors without a jsonpatch error to match are nil
+	bad := map[string]error{
+		`[{"op":"test","path":"/status/fault","value":"major"}]`: jsonpatch.ErrTestFailed,
+		`[{"op":"replace","path":"/unknown","value":1}]`:         jsonpatch.ErrMissing,
+		`[{"op":"add","path":"/unknown/key","value":1}]`:         jsonpatch.ErrMissing,
+		`[{"op":"add","path":"/l/5","value":1}]`:                 jsonpatch.ErrInvalidIndex,
+		`[{"op":"remove","path":"/l/x"}]`:                        nil,
+		`[{"op":"rename","path":"/labels"}]`:                     nil,
+		`{"op":"remove","path":"/labels"}`:                       ErrPatch,
+	}
+
+	for ops, e := range bad {
+		_, err := patch(ops)
+		assert.NotNil(err, ops)
+
+		if e != nil {
+			assert.True(errors.Is(err, e), ops)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/audit"
+	"github.com/project-safari/zebra/lease"
+)
+
+// ReapInterval is the interval at which expired leases are released.
+const ReapInterval = time.Minute
+
+// reapLeases periodically releases all expired leases, returning their
+// resources to the free pool, until the context is done. It is meant to be
+// run in its own goroutine.
+func reapLeases(ctx context.Context, api *ResourceAPI, interval time.Duration) {
+	log := logr.FromContextOrDiscard(ctx)
+	ticker := time.NewTicker(interval)
+
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			expired, queued := expiredSnapshots(api), queuedSnapshots(api)
+
+			released, activated, err := api.Allocator.Reap()
+			if err != nil {
+				log.Error(err, "failed to release expired leases")
+			}
+
+			recordExpired(ctx, api, released, expired)
+			recordActivated(ctx, api, activated, queued)
+
+			if len(released) > 0 {
+				log.Info("released expired leases", "count", len(released))
+			}
+		}
+	}
+}
+
+// expiredSnapshots returns the snapshots of the active leases that have
+// expired by lease id, taken before they are released.
+func expiredSnapshots(api *ResourceAPI) map[string][]byte {
+	before := make(map[string][]byte)
+
+	for _, l := range findLeases(api.Store) {
+		if l.GetStatus().State == zebra.Active && l.IsExpired() {
+			before[l.ID] = audit.Snapshot(l)
+		}
+	}
+
+	return before
+}
+
+// recordExpired records the release of the expired leases that have been
+// released by the system user, before holds their snapshots by lease id.
+func recordExpired(ctx context.Context, api *ResourceAPI, released []*lease.Lease, before map[string][]byte) {
+	ctx = systemContext(ctx)
+
+	for _, l := range released {
+		recordLease(ctx, api, audit.ActionExpire, l, before[l.ID], leasedIDs(l))
+	}
+}
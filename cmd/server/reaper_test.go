@@ -0,0 +1,65 @@
+package main //nolint:testpackage
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/lease"
+	"github.com/project-safari/zebra/network"
+	"github.com/project-safari/zebra/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReapLeases(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testreapleases"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	api := NewResourceAPI(store.DefaultFactory())
+	assert.Nil(api.Initialize(root))
+
+	vlan := &network.VLANPool{
+		BaseResource: *zebra.NewBaseResource("VLANPool", zebra.Labels{"system.group": "eng"}),
+		RangeStart:   0,
+		RangeEnd:     10,
+	}
+	assert.Nil(api.Store.Create(vlan))
+
+	user := createNewUser("tester", "tester@zebra.project-safari.io", "Riddikulus!1", nil)
+	grantLease(assert, user, "VLANPool/eng")
+
+	l := lease.NewLease(*user, time.Millisecond, []*lease.ResourceReq{
+		{Type: "VLANPool", Group: "eng", Name: "vlan", Count: 1},
+	})
+	_, err := api.Allocator.Allocate(l)
+	assert.Nil(err)
+
+	// The stored vlan pool is a leased copy
+	assert.Equal(zebra.Leased, findResource(api, vlan.ID).GetStatus().Lease)
+	assert.Equal(zebra.Free, vlan.Status.Lease)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		reapLeases(ctx, api, time.Millisecond)
+		close(done)
+	}()
+
+	assert.Eventually(func() bool {
+		return findLease(api.Store, l.ID).GetStatus().State == zebra.Inactive
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+
+	stored := findResource(api, vlan.ID)
+	assert.Equal(zebra.Free, stored.GetStatus().Lease)
+	assert.Empty(stored.GetStatus().UsedBy)
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/go-logr/logr"
 	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/audit"
 	"github.com/project-safari/zebra/auth"
 	"gojini.dev/web"
 )
@@ -81,6 +82,12 @@ func registerHandler(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	e := auditEntry(ctx, audit.ActionRegister)
+	e.User, e.Method = newuser.Email, audit.MethodPassword
+	e.ID, e.Type = newuser.ID, newuser.Type
+	e.Changes = audit.Diff(nil, audit.Snapshot(newuser))
+	record(ctx, api, e)
+
 	responseRegister(log, res, newuser)
 	log.Info("Registry succeeded", "user", registryData.Name)
 }
@@ -108,7 +115,7 @@ func createNewUser(name string, email string, password string, key *auth.RsaIden
 
 	newuser := &auth.User{
 		Key:          key,
-		PasswordHash: password,
+		PasswordHash: auth.HashPassword(password),
 		Role:         DefaultRole(),
 		Email:        email,
 		NamedResource: zebra.NamedResource{
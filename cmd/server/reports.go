@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/usage"
+)
+
+// ReportPeriod is the default period of utilization reports, ending now.
+const ReportPeriod = 30 * 24 * time.Hour
+
+var ErrReportRequest = errors.New("invalid utilization report request")
+
+// ReportRequest is the period and grouping of a utilization report.
+type ReportRequest struct {
+	From    time.Time
+	To      time.Time
+	GroupBy string
+}
+
+// newReportRequest reads the report request from the url query, e.g.
+// ?from=2022-06-01T00:00:00Z&to=2022-07-01T00:00:00Z&groupBy=group. Times are
+// in RFC 3339 format, the report covers the last ReportPeriod grouped by type
+// by default.
+func newReportRequest(req *http.Request) (*ReportRequest, error) {
+	values := req.URL.Query()
+	rr := &ReportRequest{
+		From:    time.Time{},
+		To:      time.Now(),
+		GroupBy: usage.GroupByType,
+	}
+
+	if groupBy := values.Get("groupBy"); groupBy != "" {
+		rr.GroupBy = groupBy
+	}
+
+	for key, t := range map[string]*time.Time{"from": &rr.From, "to": &rr.To} {
+		if val := values.Get(key); val != "" {
+			parsed, err := time.Parse(time.RFC3339, val)
+			if err != nil {
+				return nil, ErrReportRequest
+			}
+
+			*t = parsed
+		}
+	}
+
+	if rr.From.IsZero() {
+		rr.From = rr.To.Add(-ReportPeriod)
+	}
+
+	return rr, nil
+}
+
+// leasable returns the stored resources the claims allow reading which can be
+// leased, that is all resources but the leases, users and roles.
+func leasable(api *ResourceAPI, claims *auth.Claims) []zebra.Resource {
+	resources := []zebra.Resource{}
+
+	for t, list := range api.Store.Query().Resources {
+		if t == "Lease" || t == auth.UserType().Name || t == auth.RoleType().Name {
+			continue
+		}
+
+		for _, res := range list.Resources {
+			if canRead(claims, res) {
+				resources = append(resources, res)
+			}
+		}
+	}
+
+	return resources
+}
+
+// usageIntervals returns the intervals of the period the claims allow
+// reading, both from the usage log and from the leases that are still active.
+func usageIntervals(api *ResourceAPI, claims *auth.Claims, rr *ReportRequest) ([]*usage.Interval, error) {
+	intervals := []*usage.Interval{}
+
+	if api.Usage != nil {
+		logged, err := api.Usage.Query(rr.From, rr.To)
+		if err != nil {
+			return nil, err
+		}
+
+		intervals = append(intervals, logged...)
+	}
+
+	now := time.Now()
+
+	for _, l := range findLeases(api.Store) {
+		for _, i := range l.Intervals(now) {
+			if i.Overlaps(rr.From, rr.To) {
+				intervals = append(intervals, i)
+			}
+		}
+	}
+
+	readable := make([]*usage.Interval, 0, len(intervals))
+
+	for _, i := range intervals {
+		if claims.Read(auth.GroupKey(i.Type, i.Group)) {
+			readable = append(readable, i)
+		}
+	}
+
+	return readable, nil
+}
+
+// handleUtilization returns the utilization report of the resources the
+// caller can read for the period and grouping in the url query.
+func handleUtilization() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		log := logr.FromContextOrDiscard(ctx)
+		api, claims, ok := apiContext(ctx)
+
+		if !ok {
+			res.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		rr, err := newReportRequest(req)
+		if err != nil {
+			res.WriteHeader(http.StatusBadRequest)
+			log.Info("utilization report could not be created, invalid request")
+
+			return
+		}
+
+		intervals, err := usageIntervals(api, claims, rr)
+		if err != nil {
+			res.WriteHeader(http.StatusInternalServerError)
+			log.Error(err, "internal server error while reading usage log")
+
+			return
+		}
+
+		report, err := usage.NewReport(rr.From, rr.To, rr.GroupBy, intervals, leasable(api, claims))
+		if err != nil {
+			res.WriteHeader(http.StatusBadRequest)
+			log.Info("utilization report could not be created", "error", err.Error())
+
+			return
+		}
+
+		writeJSON(ctx, res, report)
+	}
+}
@@ -0,0 +1,124 @@
+package main //nolint:testpackage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/lease"
+	"github.com/project-safari/zebra/network"
+	"github.com/project-safari/zebra/store"
+	"github.com/project-safari/zebra/usage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUtilization(t *testing.T) { //nolint:funlen
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testutilization"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	api := NewResourceAPI(store.DefaultFactory())
+	assert.Nil(api.Initialize(root))
+
+	for _, group := range []string{"eng", "eng", "ops", "ops"} {
+		assert.Nil(api.Store.Create(&network.VLANPool{
+			BaseResource: *zebra.NewBaseResource("VLANPool", zebra.Labels{"system.group": group}),
+			RangeStart:   0,
+			RangeEnd:     10,
+		}))
+	}
+
+	user := makeUser(assert)
+	assert.Nil(api.Store.Create(user))
+
+	// A released lease and an active lease
+	released := lease.NewLease(*user, time.Hour, []*lease.ResourceReq{
+		{Type: "VLANPool", Group: "eng", Name: "eng", Count: 2},
+	})
+	released, err := api.Allocator.Allocate(released)
+	assert.Nil(err)
+
+	_, _, err = api.Allocator.Release(released)
+	assert.Nil(err)
+
+	active := lease.NewLease(*user, time.Hour, []*lease.ResourceReq{
+		{Type: "VLANPool", Group: "ops", Name: "ops", Count: 1},
+	})
+	_, err = api.Allocator.Allocate(active)
+	assert.Nil(err)
+
+	routes := routeHandler()
+	report := func(ctx context.Context, query string) (int, *usage.Report) {
+		req, err := http.NewRequestWithContext(ctx, "GET", "/api/v1/reports/utilization?"+query, nil)
+		assert.Nil(err)
+
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		r := new(usage.Report)
+		if rr.Code == http.StatusOK {
+			assert.Nil(json.Unmarshal(rr.Body.Bytes(), r))
+		}
+
+		return rr.Code, r
+	}
+
+	ctx := adminContext(context.Background(), api)
+
+	code, r := report(ctx, "groupBy=user")
+	assert.Equal(http.StatusOK, code)
+	assert.Equal(usage.GroupByUser, r.GroupBy)
+	assert.Equal(4, r.Resources)
+	assert.Len(r.Rows, 1)
+	assert.Equal(user.Email, r.Rows[0].Key)
+	assert.Equal(2, r.Rows[0].Leases)
+	assert.Greater(r.Rows[0].Hours, 0.0)
+	assert.Equal(user.Email, r.TopConsumers[0].User)
+	assert.True(r.To.Sub(r.From) == ReportPeriod)
+
+	code, r = report(ctx, "groupBy=group")
+	assert.Equal(http.StatusOK, code)
+	assert.Len(r.Rows, 2)
+
+	for _, row := range r.Rows {
+		assert.Equal(2, row.Resources)
+		assert.Equal(1, row.Leases)
+	}
+
+	// Types by default
+	code, r = report(ctx, "")
+	assert.Equal(http.StatusOK, code)
+	assert.Equal(usage.GroupByType, r.GroupBy)
+	assert.Equal("VLANPool", r.Rows[0].Key)
+
+	// Nothing was leased before now
+	from := time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+	to := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	code, r = report(ctx, "from="+from+"&to="+to)
+	assert.Equal(http.StatusOK, code)
+	assert.Zero(r.Hours)
+
+	// Only the resources the caller can read are reported
+	code, r = report(userContext(assert, api, "VLANPool/ops:r"), "groupBy=group")
+	assert.Equal(http.StatusOK, code)
+	assert.Equal(2, r.Resources)
+	assert.Len(r.Rows, 1)
+	assert.Equal("ops", r.Rows[0].Key)
+
+	code, _ = report(ctx, "groupBy=color")
+	assert.Equal(http.StatusBadRequest, code)
+
+	code, _ = report(ctx, "from=yesterday")
+	assert.Equal(http.StatusBadRequest, code)
+
+	code, _ = report(ctx, "from="+to+"&to="+from)
+	assert.Equal(http.StatusBadRequest, code)
+}
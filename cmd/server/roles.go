@@ -0,0 +1,425 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/go-logr/logr"
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+)
+
+// RoleGroup is the system.group of roles created without one.
+const RoleGroup = "system"
+
+var (
+	ErrRoleRequest = errors.New("invalid role request body")
+	ErrManagedType = errors.New("roles and users are managed with the roles and users api")
+)
+
+// managedType returns true for the roles and users, which cannot be written
+// with the resources api so that roles are validated, role names are unique
+// and users are bound to roles by the roles api only.
+func managedType(res zebra.Resource) bool {
+	return res.GetType() == "Role" || res.GetType() == "User"
+}
+
+// RoleRequest is the body of a role create or update request.
+type RoleRequest struct {
+	auth.Role
+	Labels zebra.Labels `json:"labels,omitempty"`
+}
+
+func (rr *RoleRequest) Validate(ctx context.Context) error {
+	if rr.Name == "" {
+		return ErrRoleRequest
+	}
+
+	for _, p := range rr.Privileges {
+		if p == nil {
+			return ErrRoleRequest
+		}
+	}
+
+	return nil
+}
+
+// BindRequest is the body of a request binding a user to a role.
+type BindRequest struct {
+	Email string `json:"email"`
+}
+
+func findRoles(store zebra.Store) []*auth.RoleResource {
+	roles := []*auth.RoleResource{}
+
+	for _, l := range store.QueryType([]string{"Role"}).Resources {
+		for _, r := range l.Resources {
+			if role, ok := r.(*auth.RoleResource); ok {
+				roles = append(roles, role)
+			}
+		}
+	}
+
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+
+	return roles
+}
+
+func findRole(store zebra.Store, name string) *auth.RoleResource {
+	for _, role := range findRoles(store) {
+		if role.Name == name {
+			return role
+		}
+	}
+
+	return nil
+}
+
+// findBoundUsers returns the users bound to the role with the given name.
+func findBoundUsers(store zebra.Store, name string) []*auth.User {
+	users := []*auth.User{}
+
+	for _, l := range store.QueryType([]string{"User"}).Resources {
+		for _, r := range l.Resources {
+			if u, ok := r.(*auth.User); ok && u.Role != nil && u.Role.Name == name {
+				users = append(users, u)
+			}
+		}
+	}
+
+	return users
+}
+
+// roleLabels returns the role labels with the system.group label set to the
+// given group if it is missing.
+func roleLabels(labels zebra.Labels, group string) zebra.Labels {
+	if labels == nil {
+		labels = zebra.Labels{}
+	}
+
+	if !labels.HasKey("system.group") {
+		labels.Add("system.group", group)
+	}
+
+	return labels
+}
+
+// bindUser binds the user to the role and stores the user with the given
+// create function. The user keeps a copy of the role, the stored user is not
+// changed in place so that its state before the change can be audited.
+func bindUser(create func(zebra.Resource) error, user *auth.User, role *auth.Role) error {
+	bound := *user
+	bound.Role = role.Copy()
+
+	return create(&bound)
+}
+
+// roleContext returns the resource api, the claims and the stored role named
+// in the request path, or writes the error response. Roles the caller cannot
+// read are not found.
+func roleContext(res http.ResponseWriter, req *http.Request,
+	params httprouter.Params,
+) (*ResourceAPI, *auth.Claims, *auth.RoleResource, bool) {
+	ctx := req.Context()
+	log := logr.FromContextOrDiscard(ctx)
+	api, claims, ok := apiContext(ctx)
+
+	if !ok {
+		res.WriteHeader(http.StatusInternalServerError)
+
+		return nil, nil, nil, false
+	}
+
+	role := findRole(api.Store, params.ByName("name"))
+	if role == nil || !canRead(claims, role) {
+		res.WriteHeader(http.StatusNotFound)
+		log.Info("role not found", "role", params.ByName("name"))
+
+		return nil, nil, nil, false
+	}
+
+	return api, claims, role, true
+}
+
+func handleRoleList() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		api, claims, ok := apiContext(ctx)
+
+		if !ok {
+			res.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		roleRes := &struct {
+			Roles []*auth.RoleResource `json:"roles"`
+		}{Roles: []*auth.RoleResource{}}
+
+		for _, role := range findRoles(api.Store) {
+			if canRead(claims, role) {
+				roleRes.Roles = append(roleRes.Roles, role)
+			}
+		}
+
+		writeJSON(ctx, res, roleRes)
+	}
+}
+
+func handleRoleGet() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		if _, _, role, ok := roleContext(res, req, params); ok {
+			writeJSON(req.Context(), res, role)
+		}
+	}
+}
+
+func handleRoleCreate() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		log := logr.FromContextOrDiscard(ctx)
+		api, claims, ok := apiContext(ctx)
+
+		if !ok {
+			res.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		rr := new(RoleRequest)
+		if err := readJSON(ctx, req, rr); err != nil || rr.Validate(ctx) != nil {
+			res.WriteHeader(http.StatusBadRequest)
+			log.Info("role could not be created, invalid request")
+
+			return
+		}
+
+		// The privileges of the role must be the caller's own, so that callers
+		// cannot grant more than they have
+		role := auth.NewRoleResource(&rr.Role, roleLabels(rr.Labels, RoleGroup))
+		if !claims.Create(auth.KeyOf(role)) || !claims.Covers(&role.Role) {
+			writeForbidden(ctx, res, claims, []string{role.Name})
+
+			return
+		}
+
+		if findRole(api.Store, role.Name) != nil {
+			res.WriteHeader(http.StatusConflict)
+			log.Info("role could not be created, role exists", "role", role.Name)
+
+			return
+		}
+
+		if err := auditedCreate(ctx, api)(role); err != nil {
+			res.WriteHeader(http.StatusInternalServerError)
+			log.Error(err, "internal server error while creating role")
+
+			return
+		}
+
+		log.Info("successfully created role", "role", role.Name)
+
+		writeJSONStatus(ctx, res, http.StatusCreated, role)
+	}
+}
+
+// handleRoleUpdate replaces the privileges, priority and labels of the role,
+// the users bound to the role get the updated role.
+func handleRoleUpdate() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		log := logr.FromContextOrDiscard(ctx)
+
+		api, claims, old, ok := roleContext(res, req, params)
+		if !ok {
+			return
+		}
+
+		rr := new(RoleRequest)
+		if err := readJSON(ctx, req, rr); err != nil || rr.Validate(ctx) != nil || rr.Name != old.Name {
+			res.WriteHeader(http.StatusBadRequest)
+			log.Info("role could not be updated, invalid request")
+
+			return
+		}
+
+		role := auth.NewRoleResource(&rr.Role, roleLabels(rr.Labels, old.Labels["system.group"]))
+		role.ID = old.ID
+		role.ResourceVersion = old.ResourceVersion
+
+		if !claims.Update(auth.KeyOf(old)) || !claims.Update(auth.KeyOf(role)) || !claims.Covers(&role.Role) {
+			writeForbidden(ctx, res, claims, []string{old.Name})
+
+			return
+		}
+
+		if err := auditedCreate(ctx, api)(role); err != nil {
+			res.WriteHeader(http.StatusInternalServerError)
+			log.Error(err, "internal server error while updating role")
+
+			return
+		}
+
+		for _, u := range findBoundUsers(api.Store, role.Name) {
+			if err := bindUser(auditedCreate(ctx, api), u, &role.Role); err != nil {
+				res.WriteHeader(http.StatusInternalServerError)
+				log.Error(err, "internal server error while updating role users")
+
+				return
+			}
+		}
+
+		log.Info("successfully updated role", "role", role.Name)
+
+		writeJSON(ctx, res, role)
+	}
+}
+
+// handleRoleDelete deletes the role, the users bound to the role are bound
+// to the default role.
+func handleRoleDelete() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		log := logr.FromContextOrDiscard(ctx)
+
+		api, claims, role, ok := roleContext(res, req, params)
+		if !ok {
+			return
+		}
+
+		if !claims.Delete(auth.KeyOf(role)) {
+			writeForbidden(ctx, res, claims, []string{role.Name})
+
+			return
+		}
+
+		if err := auditedDelete(ctx, api)(role); err != nil {
+			res.WriteHeader(http.StatusInternalServerError)
+			log.Error(err, "internal server error while deleting role")
+
+			return
+		}
+
+		for _, u := range findBoundUsers(api.Store, role.Name) {
+			if err := bindUser(auditedCreate(ctx, api), u, DefaultRole()); err != nil {
+				res.WriteHeader(http.StatusInternalServerError)
+				log.Error(err, "internal server error while unbinding role users")
+
+				return
+			}
+		}
+
+		log.Info("successfully deleted role", "role", role.Name)
+
+		res.WriteHeader(http.StatusOK)
+	}
+}
+
+func handleRoleUsers() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		api, _, role, ok := roleContext(res, req, params)
+		if !ok {
+			return
+		}
+
+		usersRes := &struct {
+			Users []string `json:"users"`
+		}{Users: []string{}}
+
+		for _, u := range findBoundUsers(api.Store, role.Name) {
+			usersRes.Users = append(usersRes.Users, u.Email)
+		}
+
+		sort.Strings(usersRes.Users)
+
+		writeJSON(req.Context(), res, usersRes)
+	}
+}
+
+// handleRoleBind binds a user to the role. The caller must be allowed to
+// update both the role and the user, and must have all the privileges of the
+// role.
+func handleRoleBind() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		log := logr.FromContextOrDiscard(ctx)
+
+		api, claims, role, ok := roleContext(res, req, params)
+		if !ok {
+			return
+		}
+
+		br := new(BindRequest)
+		if err := readJSON(ctx, req, br); err != nil || br.Email == "" {
+			res.WriteHeader(http.StatusBadRequest)
+			log.Info("role could not be bound, invalid request")
+
+			return
+		}
+
+		if !claims.Covers(&role.Role) {
+			writeForbidden(ctx, res, claims, []string{role.Name})
+
+			return
+		}
+
+		bindRole(ctx, res, api, claims, br.Email, role.Name, &role.Role)
+	}
+}
+
+// handleRoleUnbind binds a user bound to the role to the default role.
+func handleRoleUnbind() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		api, claims, role, ok := roleContext(res, req, params)
+		if !ok {
+			return
+		}
+
+		bindRole(req.Context(), res, api, claims, params.ByName("email"), role.Name, DefaultRole())
+	}
+}
+
+// bindRole binds the user with the email to the given role, the caller must
+// be allowed to update the user and the role named roleName.
+func bindRole(ctx context.Context, res http.ResponseWriter, api *ResourceAPI,
+	claims *auth.Claims, email string, roleName string, role *auth.Role,
+) {
+	log := logr.FromContextOrDiscard(ctx)
+
+	user := findUser(api.Store, email)
+	if user == nil || !canRead(claims, user) {
+		res.WriteHeader(http.StatusNotFound)
+		log.Info("user not found", "user", email)
+
+		return
+	}
+
+	// Unbinding a user that is not bound to the role is not found either
+	if role.Name != roleName && (user.Role == nil || user.Role.Name != roleName) {
+		res.WriteHeader(http.StatusNotFound)
+		log.Info("user not bound to role", "user", email, "role", roleName)
+
+		return
+	}
+
+	stored := findRole(api.Store, roleName)
+	if !claims.Update(auth.KeyOf(user)) || !claims.Update(auth.KeyOf(stored)) {
+		writeForbidden(ctx, res, claims, []string{email})
+
+		return
+	}
+
+	if err := bindUser(auditedCreate(ctx, api), user, role); err != nil {
+		res.WriteHeader(http.StatusInternalServerError)
+		log.Error(err, "internal server error while binding role")
+
+		return
+	}
+
+	log.Info("successfully bound role", "user", email, "role", role.Name)
+
+	res.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,314 @@
+package main //nolint:testpackage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/store"
+	"github.com/stretchr/testify/assert"
+	"gojini.dev/config"
+)
+
+func TestRoles(t *testing.T) { //nolint:funlen
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testroles"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	api := NewResourceAPI(store.DefaultFactory())
+	assert.Nil(api.Initialize(root))
+
+	key, err := auth.Generate()
+	assert.Nil(err)
+
+	user := createNewUser("bob", "bob@zebra.io", "Riddikulus!1", key.Public())
+	assert.Nil(api.Store.Create(user))
+
+	routes := routeHandler()
+	serve := func(ctx context.Context, method string, path string, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequestWithContext(ctx, method, path, strings.NewReader(body))
+		assert.Nil(err)
+
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	ctx := adminContext(context.Background(), api)
+
+	// Create a role
+	rr := serve(ctx, "POST", "/api/v1/roles", `{"name":"eng","privileges":["Server/eng:r"]}`)
+	assert.Equal(http.StatusCreated, rr.Code)
+
+	role := new(auth.RoleResource)
+	assert.Nil(json.Unmarshal(rr.Body.Bytes(), role))
+	assert.Equal("eng", role.Name)
+	assert.Equal(RoleGroup, role.Labels["system.group"])
+	assert.True(role.Read("Server/eng"))
+
+	rr = serve(ctx, "POST", "/api/v1/roles", `{"name":"eng","privileges":["Server/eng:r"]}`)
+	assert.Equal(http.StatusConflict, rr.Code)
+
+	rr = serve(ctx, "POST", "/api/v1/roles", `{"name":"","privileges":[]}`)
+	assert.Equal(http.StatusBadRequest, rr.Code)
+
+	rr = serve(ctx, "GET", "/api/v1/roles", "")
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.Contains(rr.Body.String(), `"name":"eng"`)
+
+	rr = serve(ctx, "GET", "/api/v1/roles/eng", "")
+	assert.Equal(http.StatusOK, rr.Code)
+
+	rr = serve(ctx, "GET", "/api/v1/roles/ops", "")
+	assert.Equal(http.StatusNotFound, rr.Code)
+
+	// Bind the user, the user gets a copy of the role
+	rr = serve(ctx, "POST", "/api/v1/roles/eng/users", `{"email":"bob@zebra.io"}`)
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.Equal("eng", findUser(api.Store, "bob@zebra.io").Role.Name)
+
+	rr = serve(ctx, "POST", "/api/v1/roles/eng/users", `{"email":"alice@zebra.io"}`)
+	assert.Equal(http.StatusNotFound, rr.Code)
+
+	rr = serve(ctx, "GET", "/api/v1/roles/eng/users", "")
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.Contains(rr.Body.String(), "bob@zebra.io")
+
+	// Update the role, the bound user is updated too
+	rr = serve(ctx, "PUT", "/api/v1/roles/eng", `{"name":"eng","privileges":["Server/eng:r,u"]}`)
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.True(findUser(api.Store, "bob@zebra.io").Role.Update("Server/eng"))
+
+	rr = serve(ctx, "PUT", "/api/v1/roles/eng", `{"name":"ops","privileges":["Server/eng:r,u"]}`)
+	assert.Equal(http.StatusBadRequest, rr.Code)
+
+	// A user that can only read roles cannot change them
+	userCtx := userContext(assert, api, "Role/.*:r", "User/.*:r")
+
+	rr = serve(userCtx, "GET", "/api/v1/roles/eng", "")
+	assert.Equal(http.StatusOK, rr.Code)
+
+	rr = serve(userCtx, "POST", "/api/v1/roles", `{"name":"ops","privileges":["Server/ops:r"]}`)
+	assert.Equal(http.StatusForbidden, rr.Code)
+
+	rr = serve(userCtx, "PUT", "/api/v1/roles/eng", `{"name":"eng","privileges":[":c,r,u,d"]}`)
+	assert.Equal(http.StatusForbidden, rr.Code)
+
+	rr = serve(userCtx, "DELETE", "/api/v1/roles/eng/users/bob@zebra.io", "")
+	assert.Equal(http.StatusForbidden, rr.Code)
+
+	rr = serve(userCtx, "DELETE", "/api/v1/roles/eng", "")
+	assert.Equal(http.StatusForbidden, rr.Code)
+
+	rr = serve(userContext(assert, api, "Server/.*:r"), "GET", "/api/v1/roles", "")
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.NotContains(rr.Body.String(), "eng")
+
+	// Unbind the user, the user is bound to the default role
+	rr = serve(ctx, "DELETE", "/api/v1/roles/eng/users/bob@zebra.io", "")
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.Equal(DefaultRole().Name, findUser(api.Store, "bob@zebra.io").Role.Name)
+
+	rr = serve(ctx, "DELETE", "/api/v1/roles/eng/users/bob@zebra.io", "")
+	assert.Equal(http.StatusNotFound, rr.Code)
+
+	// Delete the role, the bound users are bound to the default role
+	rr = serve(ctx, "POST", "/api/v1/roles/eng/users", `{"email":"bob@zebra.io"}`)
+	assert.Equal(http.StatusOK, rr.Code)
+
+	rr = serve(ctx, "DELETE", "/api/v1/roles/eng", "")
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.Nil(findRole(api.Store, "eng"))
+	assert.Equal(DefaultRole().Name, findUser(api.Store, "bob@zebra.io").Role.Name)
+}
+
+func TestRoleEscalation(t *testing.T) { //nolint:funlen
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testroleescalation"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	api := NewResourceAPI(store.DefaultFactory())
+	assert.Nil(api.Initialize(root))
+
+	key, err := auth.Generate()
+	assert.Nil(err)
+
+	user := createNewUser("bob", "bob@zebra.io", "Riddikulus!1", key.Public())
+	assert.Nil(api.Store.Create(user))
+
+	routes := routeHandler()
+	serve := func(ctx context.Context, method string, path string, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequestWithContext(ctx, method, path, strings.NewReader(body))
+		assert.Nil(err)
+
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	ctx := adminContext(context.Background(), api)
+	rr := serve(ctx, "POST", "/api/v1/roles", `{"name":"admin","privileges":[":c,r,u,d"]}`)
+	assert.Equal(http.StatusCreated, rr.Code)
+
+	// A role manager can only grant the privileges it has
+	userCtx := userContext(assert, api, "Role/.*:c,r,u,d", "User/.*:r,u", "Server/eng:r,u")
+
+	rr = serve(userCtx, "POST", "/api/v1/roles", `{"name":"root","privileges":[":c,r,u,d"]}`)
+	assert.Equal(http.StatusForbidden, rr.Code)
+
+	rr = serve(userCtx, "POST", "/api/v1/roles", `{"name":"eng","privileges":["Server/eng:c,r,u"]}`)
+	assert.Equal(http.StatusForbidden, rr.Code)
+
+	rr = serve(userCtx, "POST", "/api/v1/roles", `{"name":"eng","privileges":["Server/eng:r"]}`)
+	assert.Equal(http.StatusCreated, rr.Code)
+
+	rr = serve(userCtx, "PUT", "/api/v1/roles/eng", `{"name":"eng","privileges":["Server/.*:r,u"]}`)
+	assert.Equal(http.StatusForbidden, rr.Code)
+
+	rr = serve(userCtx, "PUT", "/api/v1/roles/eng", `{"name":"eng","privileges":["Server/eng:r,u"]}`)
+	assert.Equal(http.StatusOK, rr.Code)
+
+	rr = serve(userCtx, "POST", "/api/v1/roles/admin/users", `{"email":"bob@zebra.io"}`)
+	assert.Equal(http.StatusForbidden, rr.Code)
+	assert.Equal(DefaultRole().Name, findUser(api.Store, "bob@zebra.io").Role.Name)
+
+	// Nor a higher priority than its own
+	rr = serve(userCtx, "POST", "/api/v1/roles", `{"name":"urgent","priority":1,"privileges":["Server/eng:r"]}`)
+	assert.Equal(http.StatusForbidden, rr.Code)
+
+	rr = serve(userCtx, "PUT", "/api/v1/roles/eng", `{"name":"eng","priority":1,"privileges":["Server/eng:r,u"]}`)
+	assert.Equal(http.StatusForbidden, rr.Code)
+
+	rr = serve(ctx, "POST", "/api/v1/roles", `{"name":"urgent","priority":1,"privileges":["Server/eng:r"]}`)
+	assert.Equal(http.StatusCreated, rr.Code)
+
+	rr = serve(userCtx, "POST", "/api/v1/roles/urgent/users", `{"email":"bob@zebra.io"}`)
+	assert.Equal(http.StatusForbidden, rr.Code)
+
+	rr = serve(userCtx, "POST", "/api/v1/roles/eng/users", `{"email":"bob@zebra.io"}`)
+	assert.Equal(http.StatusOK, rr.Code)
+
+	// Roles and users cannot be written with the resources api
+	role := auth.NewRoleResource(&auth.Role{Name: "root", Privileges: DefaultRole().Privileges, Priority: 0},
+		zebra.Labels{"system.group": RoleGroup})
+	body, err := json.Marshal(map[string][]interface{}{"Role": {role}})
+	assert.Nil(err)
+
+	rr = serve(ctx, "POST", "/api/v1/resources", string(body))
+	assert.Equal(http.StatusBadRequest, rr.Code)
+	assert.Nil(findRole(api.Store, "root"))
+
+	body, err = json.Marshal(map[string][]interface{}{"User": {user}})
+	assert.Nil(err)
+
+	rr = serve(ctx, "POST", "/api/v1/resources", string(body))
+	assert.Equal(http.StatusBadRequest, rr.Code)
+
+	rr = serve(ctx, "DELETE", "/api/v1/resources", string(body))
+	assert.Equal(http.StatusBadRequest, rr.Code)
+
+	rr = serve(ctx, "PATCH", "/api/v1/resources/"+user.ID, `{"role":{"name":"admin","privileges":[":c,r,u,d"]}}`)
+	assert.Equal(http.StatusBadRequest, rr.Code)
+
+	rr = serve(ctx, "DELETE", "/api/v1/resources/"+user.ID, "")
+	assert.Equal(http.StatusBadRequest, rr.Code)
+	assert.Equal("eng", findUser(api.Store, "bob@zebra.io").Role.Name)
+}
+
+func TestBootstrapAdmin(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testbootstrap"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	api := NewResourceAPI(store.DefaultFactory())
+	assert.Nil(api.Initialize(root))
+
+	// No admin configured
+	assert.Nil(bootstrapAdmin(context.Background(), api.Store, config.New(), root))
+	assert.Nil(findRole(api.Store, AdminRole))
+
+	cfgStore := config.New()
+	assert.Nil(cfgStore.LoadFromStr(context.Background(),
+		`{"admin": {"name": "admin", "email": "admin@zebra.io", "password": "Riddikulus!1"}}`))
+
+	assert.Nil(bootstrapAdmin(context.Background(), api.Store, cfgStore, root))
+
+	admin := findUser(api.Store, "admin@zebra.io")
+	assert.NotNil(admin)
+	assert.Equal(AdminRole, admin.Role.Name)
+	assert.True(admin.Role.Delete("Server/eng"))
+	assert.Nil(admin.AuthenticatePassword("Riddikulus!1"))
+	assert.NotNil(findRole(api.Store, AdminRole))
+
+	// Bootstrapping again keeps the admin user and rebinds it
+	admin.Role = DefaultRole()
+	assert.Nil(api.Store.Create(admin))
+	assert.Nil(bootstrapAdmin(context.Background(), api.Store, cfgStore, root))
+	assert.Equal(AdminRole, findUser(api.Store, "admin@zebra.io").Role.Name)
+	assert.Len(findRoles(api.Store), 1)
+
+	// Without a configured password, one is generated and written once to a
+	// file only the owner can read, it is never logged
+	logged := []string{}
+	ctx := logr.NewContext(context.Background(), funcr.NewJSON(func(obj string) {
+		logged = append(logged, obj)
+	}, funcr.Options{}))
+
+	cfgStore = config.New()
+	assert.Nil(cfgStore.LoadFromStr(context.Background(), `{"admin": {"name": "root", "email": "root@zebra.io"}}`))
+	assert.Nil(bootstrapAdmin(ctx, api.Store, cfgStore, root))
+	assert.Len(logged, 1)
+
+	file := filepath.Join(root, AdminPasswordFile)
+	info, err := os.Stat(file)
+	assert.Nil(err)
+	assert.Equal(os.FileMode(auth.ReadOnly), info.Mode().Perm())
+
+	data, err := os.ReadFile(file)
+	assert.Nil(err)
+
+	password := strings.TrimSpace(string(data))
+	assert.NotContains(logged[0], password)
+
+	rootUser := findUser(api.Store, "root@zebra.io")
+	assert.NotNil(rootUser)
+	assert.Nil(rootUser.AuthenticatePassword(password))
+
+	assert.Nil(os.Remove(file))
+	assert.Nil(bootstrapAdmin(ctx, api.Store, cfgStore, root))
+	assert.Len(logged, 1)
+	assert.NoFileExists(file)
+}
+
+func TestGeneratePassword(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	password, err := generatePassword()
+	assert.Nil(err)
+	assert.Nil(zebra.ValidatePassword(password))
+
+	other, err := generatePassword()
+	assert.Nil(err)
+	assert.NotEqual(password, other)
+}
@@ -7,15 +7,41 @@ import (
 )
 
 // routeHandler returns a http handler that handles all routes under the
-// /api/v1 endpoint. It is expected that this handler is the final handler
-// and requires the request context to be set with log, store, auth etc.
+// /api/v1 endpoint and /metrics. It is expected that this handler is the final
+// handler and requires the request context to be set with log, store, auth
+// etc.
 func routeHandler() http.Handler {
+	return newRouter()
+}
+
+// newRouter returns the router of all routes under the /api/v1 endpoint and
+// /metrics.
+func newRouter() *httprouter.Router {
 	router := httprouter.New()
 	router.GET("/api/v1/types", handleTypes())
 	router.GET("/api/v1/labels", handleLabels())
 	router.GET("/api/v1/resources", handleQuery())
+	router.GET("/api/v1/watch", handleWatch())
+	router.GET("/api/v1/audit", handleAudit())
+	router.GET("/api/v1/reports/utilization", handleUtilization())
 	router.POST("/api/v1/resources", handlePost())
 	router.DELETE("/api/v1/resources", handleDelete())
+	router.PUT("/api/v1/resources/:id", handlePut())
+	router.PATCH("/api/v1/resources/:id", handlePatch())
+	router.DELETE("/api/v1/resources/:id", handleDeleteID())
+	router.GET("/api/v1/leases", handleLeaseList())
+	router.POST("/api/v1/leases", handleLeaseRequest())
+	router.POST("/api/v1/leases/:id/release", handleLeaseRelease())
+	router.POST("/api/v1/leases/:id/extend", handleLeaseExtend())
+	router.GET("/api/v1/roles", handleRoleList())
+	router.POST("/api/v1/roles", handleRoleCreate())
+	router.GET("/api/v1/roles/:name", handleRoleGet())
+	router.PUT("/api/v1/roles/:name", handleRoleUpdate())
+	router.DELETE("/api/v1/roles/:name", handleRoleDelete())
+	router.GET("/api/v1/roles/:name/users", handleRoleUsers())
+	router.POST("/api/v1/roles/:name/users", handleRoleBind())
+	router.DELETE("/api/v1/roles/:name/users/:email", handleRoleUnbind())
+	router.GET("/metrics", handleMetrics())
 
 	return router
 }
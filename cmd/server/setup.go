@@ -2,11 +2,19 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io/fs"
+	"math"
 	"net/http"
 	"os"
+	"path/filepath"
 
 	"github.com/go-logr/logr"
 	"github.com/go-logr/zerologr"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
 	"github.com/project-safari/zebra/store"
 	"github.com/rs/zerolog"
 	"gojini.dev/config"
@@ -23,8 +31,9 @@ func setupLogger(cfgStore *config.Store) context.Context {
 
 func setupAdapter(ctx context.Context, cfgStore *config.Store) web.Adapter {
 	storeCfg := struct {
-		Root string `json:"rootDir"`
-	}{Root: ""}
+		Root    string `json:"rootDir"`
+		Backend string `json:"backend"`
+	}{Root: "", Backend: store.FileBackend}
 
 	if e := cfgStore.Get("store", &storeCfg); e != nil {
 		panic(e)
@@ -39,10 +48,19 @@ func setupAdapter(ctx context.Context, cfgStore *config.Store) web.Adapter {
 	factory := store.DefaultFactory()
 
 	resAPI := NewResourceAPI(factory)
+	resAPI.Backend = storeCfg.Backend
+
 	if e := resAPI.Initialize(storeCfg.Root); e != nil {
 		panic(e)
 	}
 
+	if e := bootstrapAdmin(ctx, resAPI.Store, cfgStore, storeCfg.Root); e != nil {
+		panic(e)
+	}
+
+	go reapLeases(ctx, resAPI, ReapInterval)
+	go resAPI.Metrics.watchStore(ctx, resAPI.Store)
+
 	return func(nextHandler http.Handler) http.Handler {
 		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
 			if nextHandler == nil {
@@ -63,3 +81,107 @@ func setupAdapter(ctx context.Context, cfgStore *config.Store) web.Adapter {
 		})
 	}
 }
+
+// AdminRole is the name of the role of the bootstrap admin.
+const AdminRole = "admin"
+
+// AdminPriority is the priority of the admin role, the highest, so that the
+// admin can create and bind roles of any priority.
+const AdminPriority = math.MaxInt32
+
+// AdminPasswordEnv is the environment variable the password of the bootstrap
+// admin is read from.
+const AdminPasswordEnv = "ZEBRA_ADMIN_PASSWORD"
+
+// AdminPasswordFile is the file in the store root the generated password of
+// the bootstrap admin is written to.
+const AdminPasswordFile = "admin.password"
+
+// bootstrapAdmin creates the admin role and the admin user from the admin
+// config, if there is one. The admin user is bound to the admin role, which
+// allows everything on every resource. The admin password is read from the
+// AdminPasswordEnv environment variable, or from the config. If there is none
+// a password is generated when the admin user is created, and written once to
+// the AdminPasswordFile in the store root, readable by the owner only.
+func bootstrapAdmin(ctx context.Context, s zebra.Store, cfgStore *config.Store, root string) error {
+	adminCfg := struct {
+		Name     string `json:"name"`
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}{Name: "", Email: "", Password: ""}
+
+	if e := cfgStore.Get("admin", &adminCfg); e != nil {
+		// No bootstrap admin configured
+		return nil //nolint:nilerr
+	}
+
+	role := findRole(s, AdminRole)
+	if role == nil {
+		all, err := auth.NewPriv("", true, true, true, true)
+		if err != nil {
+			return err
+		}
+
+		admin := &auth.Role{Name: AdminRole, Privileges: []*auth.Priv{all}, Priority: AdminPriority}
+		role = auth.NewRoleResource(admin, zebra.Labels{"system.group": RoleGroup})
+
+		if err := s.Create(role); err != nil {
+			return err
+		}
+	}
+
+	user := findUser(s, adminCfg.Email)
+	if user == nil {
+		key, err := auth.Generate()
+		if err != nil {
+			return err
+		}
+
+		password := os.Getenv(AdminPasswordEnv)
+		if password == "" {
+			password = adminCfg.Password
+		}
+
+		if password == "" {
+			if password, err = generatePassword(); err != nil {
+				return err
+			}
+
+			file := filepath.Join(root, AdminPasswordFile)
+			if err := writePassword(file, password); err != nil {
+				return err
+			}
+
+			logr.FromContextOrDiscard(ctx).Info("generated bootstrap admin password, change it after login",
+				"email", adminCfg.Email, "file", file)
+		}
+
+		user = createNewUser(adminCfg.Name, adminCfg.Email, password, key.Public())
+	}
+
+	return bindUser(s.Create, user, &role.Role)
+}
+
+// writePassword writes the password to the file, which only the owner can
+// read. A file left from an earlier bootstrap is replaced.
+func writePassword(file string, password string) error {
+	if err := os.Remove(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return os.WriteFile(file, []byte(password+"\n"), auth.ReadOnly)
+}
+
+// generatePassword returns a random password which passes the password
+// rules.
+func generatePassword() (string, error) {
+	const size = 18
+
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	// The suffix makes sure all the character classes are there
+	return base64.RawURLEncoding.EncodeToString(buf) + "aA1!", nil
+}
@@ -3,8 +3,10 @@ package main //nolint:testpackage
 import (
 	"context"
 	"os"
+	"path"
 	"testing"
 
+	"github.com/project-safari/zebra/store"
 	"github.com/stretchr/testify/assert"
 	"gojini.dev/config"
 )
@@ -56,6 +58,31 @@ func TestSetup(t *testing.T) {
 	assert.NotNil(setupAdapter(ctx, cfgStore))
 }
 
+func TestSetupBackend(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_setup_backend"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	cfgStore := config.New()
+	ctx := setupLogger(cfgStore)
+	assert.Nil(cfgStore.LoadFromStr(ctx, `{"store": {"rootDir": "`+root+`", "backend": "tape"}, "authKey": "key"}`))
+
+	// Unknown backend
+	assert.Panics(func() {
+		setupAdapter(ctx, cfgStore)
+	})
+
+	cfgStore = config.New()
+	assert.Nil(cfgStore.LoadFromStr(ctx, `{"store": {"rootDir": "`+root+`", "backend": "db"}, "authKey": "key"}`))
+	assert.NotNil(setupAdapter(ctx, cfgStore))
+
+	_, err := os.Stat(path.Join(root, store.DBFile))
+	assert.Nil(err)
+}
+
 func TestSetupAdapter(t *testing.T) {
 	t.Parallel()
 	assert := assert.New(t)
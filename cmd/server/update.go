@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/store"
+)
+
+var ErrResourceChange = errors.New("resource id and type cannot be changed")
+
+// findResource returns the stored resource with the given id, or nil.
+func findResource(api *ResourceAPI, id string) zebra.Resource {
+	for _, l := range api.Store.QueryUUID([]string{id}).Resources {
+		if len(l.Resources) != 0 {
+			return l.Resources[0]
+		}
+	}
+
+	return nil
+}
+
+// decodeResource decodes a single json resource, using its type to create
+// the resource object.
+func decodeResource(data []byte) (zebra.Resource, error) {
+	resList := zebra.NewResourceList(store.DefaultFactory())
+
+	list := append(append([]byte{'['}, data...), ']')
+	if err := resList.UnmarshalJSON(list); err != nil {
+		return nil, err
+	}
+
+	if len(resList.Resources) != 1 {
+		return nil, ErrEmptyBody
+	}
+
+	return resList.Resources[0], nil
+}
+
+// replaceResource validates the new version of the stored resource and
+// writes it, the response is the stored resource with its new version.
+func replaceResource(ctx context.Context, res http.ResponseWriter, rr *resourceRequest, data []byte) {
+	log := logr.FromContextOrDiscard(ctx)
+	api, old := rr.api, rr.old
+
+	newRes, err := decodeResource(data)
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		log.Info("resource could not be updated, could not read resource")
+
+		return
+	}
+
+	if newRes.GetID() != old.GetID() || newRes.GetType() != old.GetType() {
+		res.WriteHeader(http.StatusBadRequest)
+		log.Info("resource could not be updated", "error", ErrResourceChange)
+
+		return
+	}
+
+	if managedType(old) {
+		res.WriteHeader(http.StatusBadRequest)
+		log.Info("resource could not be updated", "error", ErrManagedType)
+
+		return
+	}
+
+	if err := newRes.Validate(ctx); err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		log.Info("resource could not be updated, found invalid resource", "error", err.Error())
+
+		return
+	}
+
+	if !canWrite(api, rr.claims, newRes) {
+		writeForbidden(ctx, res, rr.claims, []string{old.GetID()})
+
+		return
+	}
+
+	if err := auditedCreate(ctx, api)(newRes); errors.Is(err, zebra.ErrConflict) {
+		res.WriteHeader(http.StatusConflict)
+		log.Info("resource could not be updated, stale resource version", "id", old.GetID())
+
+		return
+	} else if err != nil {
+		res.WriteHeader(http.StatusInternalServerError)
+		log.Error(err, "internal server error while updating resource")
+
+		return
+	}
+
+	log.Info("successfully updated resource", "id", old.GetID())
+
+	writeJSON(ctx, res, newRes)
+}
+
+// resourceRequest is a request on the stored resource with the id in the
+// request path.
+type resourceRequest struct {
+	api    *ResourceAPI
+	claims *auth.Claims
+	old    zebra.Resource
+	body   []byte
+}
+
+// newResourceRequest returns the resource request, or writes the error
+// response and returns nil.
+func newResourceRequest(res http.ResponseWriter, req *http.Request,
+	params httprouter.Params, readBody bool,
+) *resourceRequest {
+	ctx := req.Context()
+	log := logr.FromContextOrDiscard(ctx)
+	api, claims, ok := apiContext(ctx)
+
+	if !ok {
+		res.WriteHeader(http.StatusInternalServerError)
+
+		return nil
+	}
+
+	var body []byte
+
+	if readBody {
+		var err error
+
+		if body, err = ioutil.ReadAll(req.Body); err != nil || len(body) == 0 {
+			res.WriteHeader(http.StatusBadRequest)
+			log.Info("resource could not be updated, could not read request")
+
+			return nil
+		}
+	}
+
+	id := params.ByName("id")
+
+	// Resources the caller cannot read are not found
+	old := findResource(api, id)
+	if old == nil || !canRead(claims, old) {
+		res.WriteHeader(http.StatusNotFound)
+		log.Info("resource not found", "id", id)
+
+		return nil
+	}
+
+	return &resourceRequest{api: api, claims: claims, old: old, body: body}
+}
+
+// handlePut replaces the resource with the id in the path by the resource in
+// the request body.
+func handlePut() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		rr := newResourceRequest(res, req, params, true)
+		if rr == nil {
+			return
+		}
+
+		replaceResource(req.Context(), res, rr, rr.body)
+	}
+}
+
+// handlePatch applies the JSON Merge Patch or JSON Patch in the request body
+// to the resource with the id in the path. Unless the patch sets the resource
+// version, the patch is applied to the version that was read.
+func handlePatch() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		log := logr.FromContextOrDiscard(ctx)
+
+		rr := newResourceRequest(res, req, params, true)
+		if rr == nil {
+			return
+		}
+
+		doc, err := json.Marshal(rr.old)
+		if err != nil {
+			res.WriteHeader(http.StatusInternalServerError)
+			log.Error(err, "internal server error while patching resource")
+
+			return
+		}
+
+		patched, err := applyPatch(req.Header.Get("Content-Type"), doc, rr.body)
+		if err != nil {
+			res.WriteHeader(http.StatusBadRequest)
+			log.Info("resource could not be patched", "error", err.Error())
+
+			return
+		}
+
+		replaceResource(ctx, res, rr, patched)
+	}
+}
+
+// handleDeleteID deletes the resource with the id in the path.
+func handleDeleteID() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		log := logr.FromContextOrDiscard(ctx)
+
+		rr := newResourceRequest(res, req, params, false)
+		if rr == nil {
+			return
+		}
+
+		if managedType(rr.old) {
+			res.WriteHeader(http.StatusBadRequest)
+			log.Info("resource could not be deleted", "error", ErrManagedType)
+
+			return
+		}
+
+		if !canDelete(rr.api, rr.claims, rr.old) {
+			writeForbidden(ctx, res, rr.claims, []string{rr.old.GetID()})
+
+			return
+		}
+
+		if err := auditedDelete(ctx, rr.api)(rr.old); err != nil {
+			res.WriteHeader(http.StatusInternalServerError)
+			log.Error(err, "internal server error while deleting resource")
+
+			return
+		}
+
+		log.Info("successfully deleted resource", "id", rr.old.GetID())
+
+		res.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,137 @@
+package main //nolint:testpackage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/network"
+	"github.com/project-safari/zebra/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeUpdateServer(api *ResourceAPI) *httptest.Server {
+	router := routeHandler()
+
+	return httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		ctx := adminContext(req.Context(), api)
+		router.ServeHTTP(res, req.WithContext(ctx))
+	}))
+}
+
+func sendUpdate(assert *assert.Assertions, method, url, contentType, body string) (int, *network.VLANPool) {
+	req, err := http.NewRequestWithContext(context.Background(), method, url, strings.NewReader(body))
+	assert.Nil(err)
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(err)
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || method == http.MethodDelete {
+		return resp.StatusCode, nil
+	}
+
+	vlan := new(network.VLANPool)
+	assert.Nil(json.NewDecoder(resp.Body).Decode(vlan))
+
+	return resp.StatusCode, vlan
+}
+
+func TestUpdateResource(t *testing.T) { //nolint:funlen
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testupdateresource"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	api := NewResourceAPI(store.DefaultFactory())
+	assert.Nil(api.Initialize(root))
+
+	vlan := &network.VLANPool{
+		BaseResource: *zebra.NewBaseResource("VLANPool", zebra.Labels{"system.group": "eng"}),
+		RangeStart:   1,
+		RangeEnd:     10,
+	}
+	assert.Nil(api.Store.Create(vlan))
+
+	server := makeUpdateServer(api)
+	defer server.Close()
+
+	url := server.URL + "/api/v1/resources/" + vlan.ID
+
+	// Full replacement
+	code, stored := sendUpdate(assert, http.MethodPut, url, "",
+		`{"id":"`+vlan.ID+`","type":"VLANPool","labels":{"system.group":"eng"},"rangeStart":2,"rangeEnd":20}`)
+	assert.Equal(http.StatusOK, code)
+	assert.Equal(uint16(2), stored.RangeStart)
+	assert.Equal(uint64(2), stored.ResourceVersion)
+
+	// Merge patch adds a label and changes the fault
+	code, stored = sendUpdate(assert, http.MethodPatch, url, MergePatchType,
+		`{"labels":{"color":"red"},"status":{"fault":"major"}}`)
+	assert.Equal(http.StatusOK, code)
+	assert.Equal("red", stored.Labels["color"])
+	assert.Equal(zebra.Major, stored.Status.Fault)
+	assert.Equal(uint16(20), stored.RangeEnd)
+	assert.Equal(uint64(3), stored.ResourceVersion)
+
+	// JSON patch
+	code, stored = sendUpdate(assert, http.MethodPatch, url, JSONPatchType,
+		`[{"op":"remove","path":"/labels/color"},{"op":"replace","path":"/rangeEnd","value":30}]`)
+	assert.Equal(http.StatusOK, code)
+	assert.NotContains(stored.Labels, "color")
+	assert.Equal(uint16(30), stored.RangeEnd)
+
+	// Patches are revalidated
+	code, _ = sendUpdate(assert, http.MethodPatch, url, MergePatchType, `{"rangeStart":100}`)
+	assert.Equal(http.StatusBadRequest, code)
+
+	code, _ = sendUpdate(assert, http.MethodPatch, url, MergePatchType, `{"labels":{"system.group":null}}`)
+	assert.Equal(http.StatusBadRequest, code)
+
+	code, _ = sendUpdate(assert, http.MethodPatch, url, MergePatchType, `{"status":{"fault":"bad"}}`)
+	assert.Equal(http.StatusBadRequest, code)
+
+	code, _ = sendUpdate(assert, http.MethodPatch, url, JSONPatchType, `[{"op":"remove","path":"/unknown"}]`)
+	assert.Equal(http.StatusBadRequest, code)
+
+	// The id and type cannot change
+	code, _ = sendUpdate(assert, http.MethodPatch, url, MergePatchType, `{"id":"0123456789"}`)
+	assert.Equal(http.StatusBadRequest, code)
+
+	code, _ = sendUpdate(assert, http.MethodPatch, url, MergePatchType, `{"type":"Lab"}`)
+	assert.Equal(http.StatusBadRequest, code)
+
+	// Stale versions conflict
+	code, _ = sendUpdate(assert, http.MethodPatch, url, MergePatchType, `{"resourceVersion":1,"rangeEnd":40}`)
+	assert.Equal(http.StatusConflict, code)
+
+	code, _ = sendUpdate(assert, http.MethodPut, url, "",
+		`{"id":"`+vlan.ID+`","type":"VLANPool","labels":{"system.group":"eng"},"rangeEnd":2,"resourceVersion":1}`)
+	assert.Equal(http.StatusConflict, code)
+
+	code, _ = sendUpdate(assert, http.MethodPut, url, "", ``)
+	assert.Equal(http.StatusBadRequest, code)
+
+	// Delete by id
+	code, _ = sendUpdate(assert, http.MethodDelete, url, "", "")
+	assert.Equal(http.StatusOK, code)
+	assert.Empty(api.Store.QueryUUID([]string{vlan.ID}).Resources)
+
+	code, _ = sendUpdate(assert, http.MethodDelete, url, "", "")
+	assert.Equal(http.StatusNotFound, code)
+
+	code, _ = sendUpdate(assert, http.MethodPatch, url, MergePatchType, `{}`)
+	assert.Equal(http.StatusNotFound, code)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+)
+
+var ErrWatchRequest = errors.New("invalid watch request")
+
+// WatchRequest selects the events streamed by a watch. Labels are "key=value"
+// pairs that must all match, Since is the last revision seen by the client.
+type WatchRequest struct {
+	Types  []string
+	Labels map[string]string
+	Since  uint64
+	SSE    bool
+}
+
+// newWatchRequest reads the watch request from the url query, e.g.
+// ?types=Server,VLANPool&labels=system.group=eng&since=10. The Last-Event-ID
+// header sent by reconnecting event source clients is used if since is not
+// given. Events are sent as Server-Sent Events if the client accepts them,
+// and as json lines otherwise.
+func newWatchRequest(req *http.Request) (*WatchRequest, error) {
+	values := req.URL.Query()
+	wr := &WatchRequest{
+		Types:  splitValues(values, "types"),
+		Labels: map[string]string{},
+		Since:  0,
+		SSE:    strings.Contains(req.Header.Get("Accept"), "text/event-stream"),
+	}
+
+	for _, l := range splitValues(values, "labels") {
+		kv := strings.SplitN(l, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, ErrWatchRequest
+		}
+
+		wr.Labels[kv[0]] = kv[1]
+	}
+
+	since := values.Get("since")
+	if since == "" {
+		since = req.Header.Get("Last-Event-ID")
+	}
+
+	if since != "" {
+		rev, err := strconv.ParseUint(since, 10, 64)
+		if err != nil {
+			return nil, ErrWatchRequest
+		}
+
+		wr.Since = rev
+	}
+
+	return wr, nil
+}
+
+func splitValues(values url.Values, key string) []string {
+	ret := []string{}
+
+	for _, v := range values[key] {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				ret = append(ret, s)
+			}
+		}
+	}
+
+	return ret
+}
+
+func (wr *WatchRequest) match(res zebra.Resource) bool {
+	if len(wr.Types) != 0 && !zebra.IsIn(res.GetType(), wr.Types) {
+		return false
+	}
+
+	labels := res.GetLabels()
+
+	for k, v := range wr.Labels {
+		if val, ok := labels[k]; !ok || val != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// write writes the event as a Server-Sent Event or as a json line.
+func (wr *WatchRequest) write(res http.ResponseWriter, event zebra.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if wr.SSE {
+		_, err = fmt.Fprintf(res, "id: %d\nevent: %s\ndata: %s\n\n", event.Revision, event.Type, data)
+	} else {
+		_, err = fmt.Fprintf(res, "%s\n", data)
+	}
+
+	return err
+}
+
+func handleWatch() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		log := logr.FromContextOrDiscard(ctx)
+		api, claims, ok := apiContext(ctx)
+		flusher, canFlush := res.(http.Flusher)
+
+		if !ok || !canFlush {
+			res.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		wr, err := newWatchRequest(req)
+		if err != nil {
+			res.WriteHeader(http.StatusBadRequest)
+			log.Info("resources could not be watched, invalid request")
+
+			return
+		}
+
+		events, cancel, err := api.Store.Watch(wr.Since)
+		if errors.Is(err, zebra.ErrRevisionGone) {
+			res.WriteHeader(http.StatusGone)
+			log.Info("resources could not be watched, revision is gone", "since", wr.Since)
+
+			return
+		} else if err != nil {
+			res.WriteHeader(http.StatusInternalServerError)
+			log.Error(err, "internal server error while watching resources")
+
+			return
+		}
+
+		defer cancel()
+
+		if wr.SSE {
+			res.Header().Set("Content-Type", "text/event-stream")
+		} else {
+			res.Header().Set("Content-Type", "application/x-ndjson")
+		}
+
+		res.Header().Set("Cache-Control", "no-cache")
+		res.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		log.Info("watching resources", "since", wr.Since)
+
+		streamEvents(ctx, res, flusher, claims, wr, events)
+	}
+}
+
+// streamEvents writes the matching events until the client goes away or the
+// watcher is dropped for falling behind.
+func streamEvents(ctx context.Context, res http.ResponseWriter, flusher http.Flusher,
+	claims *auth.Claims, wr *WatchRequest, events <-chan zebra.Event,
+) {
+	log := logr.FromContextOrDiscard(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				log.Info("watcher fell behind, closing watch")
+
+				return
+			}
+
+			if !wr.match(event.Resource) || !canRead(claims, event.Resource) {
+				continue
+			}
+
+			if err := wr.write(res, event); err != nil {
+				log.Error(err, "error writing watch event")
+
+				return
+			}
+
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main //nolint:testpackage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/network"
+	"github.com/project-safari/zebra/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeWatchServer(api *ResourceAPI) *httptest.Server {
+	h := handleWatch()
+
+	return httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		ctx := adminContext(req.Context(), api)
+		h(res, req.WithContext(ctx), nil)
+	}))
+}
+
+func watch(assert *assert.Assertions, url string, sse bool) (*http.Response, *bufio.Reader) {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+	assert.Nil(err)
+
+	if sse {
+		req.Header.Set("Accept", "text/event-stream")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(err)
+
+	return resp, bufio.NewReader(resp.Body)
+}
+
+type watchEvent struct {
+	Revision uint64          `json:"revision"`
+	Type     zebra.EventType `json:"type"`
+	Resource struct {
+		ID string `json:"id"`
+	} `json:"resource"`
+}
+
+func TestWatch(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testwatch"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	api := NewResourceAPI(store.DefaultFactory())
+	assert.Nil(api.Initialize(root))
+
+	server := makeWatchServer(api)
+	defer server.Close()
+
+	resp, body := watch(assert, server.URL+"/api/v1/watch?types=VLANPool&labels=color=red", false)
+	defer resp.Body.Close()
+
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal("application/x-ndjson", resp.Header.Get("Content-Type"))
+
+	blue := &network.VLANPool{
+		BaseResource: *zebra.NewBaseResource("VLANPool", zebra.Labels{"system.group": "eng", "color": "blue"}),
+		RangeStart:   1,
+		RangeEnd:     10,
+	}
+	red := &network.VLANPool{
+		BaseResource: *zebra.NewBaseResource("VLANPool", zebra.Labels{"system.group": "eng", "color": "red"}),
+		RangeStart:   1,
+		RangeEnd:     10,
+	}
+
+	assert.Nil(api.Store.Create(blue))
+	assert.Nil(api.Store.Create(red))
+	assert.Nil(api.Store.Delete(red))
+
+	// Only the red vlan pool events are streamed
+	for _, eventType := range []zebra.EventType{zebra.EventCreate, zebra.EventDelete} {
+		line, err := body.ReadBytes('\n')
+		assert.Nil(err)
+
+		event := new(watchEvent)
+		assert.Nil(json.Unmarshal(line, event))
+		assert.Equal(eventType, event.Type)
+		assert.Equal(red.ID, event.Resource.ID)
+	}
+
+	// Resume as an event source after the first event
+	sseResp, sseBody := watch(assert, server.URL+"/api/v1/watch?since=1", true)
+	defer sseResp.Body.Close()
+
+	assert.Equal(http.StatusOK, sseResp.StatusCode)
+	assert.Equal("text/event-stream", sseResp.Header.Get("Content-Type"))
+
+	lines := []string{}
+
+	for len(lines) < 3 {
+		line, err := sseBody.ReadString('\n')
+		assert.Nil(err)
+
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	assert.Equal("id: 2", lines[0])
+	assert.Equal("event: create", lines[1])
+	assert.Contains(lines[2], red.ID)
+
+	// Bad and unavailable revisions
+	goneResp, _ := watch(assert, server.URL+"/api/v1/watch?since=100", false)
+	defer goneResp.Body.Close()
+
+	assert.Equal(http.StatusGone, goneResp.StatusCode)
+
+	badResp, _ := watch(assert, server.URL+"/api/v1/watch?since=x&labels=color", false)
+	defer badResp.Body.Close()
+
+	assert.Equal(http.StatusBadRequest, badResp.StatusCode)
+}
@@ -0,0 +1,60 @@
+package zebra
+
+import (
+	"errors"
+	"strings"
+)
+
+type EventType uint8
+
+// Constants defined for EventType type.
+const (
+	EventCreate EventType = iota
+	EventUpdate
+	EventDelete
+)
+
+var (
+	ErrEventType    = errors.New(`event type is incorrect, must be in ["create", "update", "delete"]`)
+	ErrRevisionGone = errors.New("revision is no longer available")
+)
+
+// Event is a change to a resource in the store. Revisions increase by one
+// with every change, so that watchers can resume after the last event seen.
+type Event struct {
+	Revision uint64    `json:"revision"`
+	Type     EventType `json:"type"`
+	Resource Resource  `json:"resource"`
+}
+
+func (e EventType) String() string {
+	strs := map[EventType]string{EventCreate: "create", EventUpdate: "update", EventDelete: "delete"}
+	estr, ok := strs[e]
+
+	if !ok {
+		return Unknown
+	}
+
+	return estr
+}
+
+func (e EventType) MarshalText() ([]byte, error) {
+	return []byte(e.String()), nil
+}
+
+func (e *EventType) UnmarshalText(data []byte) error {
+	emap := map[string]EventType{
+		"create": EventCreate,
+		"update": EventUpdate,
+		"delete": EventDelete,
+	}
+
+	eval, ok := emap[strings.ToLower(string(data))]
+	if !ok {
+		return ErrEventType
+	}
+
+	*e = eval
+
+	return nil
+}
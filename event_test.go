@@ -0,0 +1,28 @@
+package zebra_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/project-safari/zebra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventType(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	for _, e := range []zebra.EventType{zebra.EventCreate, zebra.EventUpdate, zebra.EventDelete} {
+		b, err := json.Marshal(e)
+		assert.Nil(err)
+
+		var back zebra.EventType
+		assert.Nil(json.Unmarshal(b, &back))
+		assert.Equal(e, back)
+	}
+
+	assert.Equal(zebra.Unknown, zebra.EventType(10).String())
+
+	var e zebra.EventType
+	assert.Equal(zebra.ErrEventType, e.UnmarshalText([]byte("modify")))
+}
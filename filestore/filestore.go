@@ -5,10 +5,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path"
-	"syscall"
+	"sync"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/project-safari/zebra"
@@ -18,6 +17,7 @@ const RWRR = os.FileMode(0o644)
 
 // FileStore implements Store.
 type FileStore struct {
+	lock        sync.Mutex
 	storageRoot string
 	factory     zebra.ResourceFactory
 }
@@ -38,15 +38,24 @@ var ErrFactoryNil = errors.New("resource factory is nil for filestore")
 // name keys with corresponding constructor function values.
 func NewFileStore(root string, resourceFactory zebra.ResourceFactory) *FileStore {
 	return &FileStore{
+		lock:        sync.Mutex{},
 		storageRoot: root,
 		factory:     resourceFactory,
 	}
 }
 
 // Initialize store given path. Path is relative to current file location.
-// If folders already exist, do nothing (existing store is unchanged).
+// If folders already exist, the existing store is recovered: a batch left in
+// the journal by a crash is completed and partially written files are removed.
 func (f *FileStore) Initialize() error {
-	return f.init()
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if err := f.init(); err != nil {
+		return err
+	}
+
+	return f.recover()
 }
 
 // init implements the store initialization. This function must never be called
@@ -74,12 +83,22 @@ func (f *FileStore) init() error {
 // Wipe store given path. Path is relative to current file location.
 // If store does not exist, do nothing.
 func (f *FileStore) Wipe() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if err := os.RemoveAll(f.journalPath()); err != nil {
+		return err
+	}
+
 	return os.RemoveAll(f.filestoreResourcesPath())
 }
 
 // Clear store given path (i.e. delete all resource objects). Path is relative
 // to current file location. If store does not exist, create store.
 func (f *FileStore) Clear() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
 	if err := os.RemoveAll(f.filestoreResourcesPath()); err != nil {
 		return err
 	}
@@ -144,72 +163,41 @@ func (f *FileStore) Load() (*zebra.ResourceMap, error) {
 // Store new object given storage root path and resource pointer.
 // If object already exists, update.
 func (f *FileStore) Create(res zebra.Resource) error {
-	if _, err := os.Stat(f.resourcesFilePath(res)); err == nil {
-		return f.update(res)
-	}
-
-	dir := f.resourcesFolderPath(res)
-
-	object, err := json.Marshal(res)
-	if err != nil {
-		return err
-	}
-
-	cleanup := func(f *os.File, err error) error {
-		errs := multierror.Append(nil, err)
-
-		if e := f.Close(); e != nil {
-			errs = multierror.Append(errs, e)
-		}
-
-		if e := os.Remove(f.Name()); e != nil {
-			errs = multierror.Append(errs, e)
-		}
+	return f.Apply([]zebra.Resource{res}, nil)
+}
 
-		return errs
-	}
+// Delete object given storage root path and UUID.
+// If object does not exist, do nothing.
+func (f *FileStore) Delete(res zebra.Resource) error {
+	return f.Apply(nil, []zebra.Resource{res})
+}
 
-	file, err := ioutil.TempFile(dir, "temp_")
-	if err != nil {
+// Apply stores the created resources and deletes the deleted resources, either
+// all of them or none. A resource must not be both created and deleted. The
+// changes are recorded in the journal before any stored file is touched, so
+// that a batch interrupted by a crash is completed when the store is
+// initialized again. If a change fails, the changes already applied are
+// undone the same way. If only the journal cannot be removed afterwards, all
+// changes are stored and ErrJournalRemove is returned along with the cause.
+func (f *FileStore) Apply(creates []zebra.Resource, deletes []zebra.Resource) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	ops, err := f.journalOps(creates, deletes)
+	if err != nil || len(ops) == 0 {
 		return err
 	}
 
-	if _, err := file.Write(object); err != nil {
-		return cleanup(file, err)
-	}
-
-	if err := file.Chmod(RWRR); err != nil {
-		return cleanup(file, err)
-	}
-
-	if err := file.Close(); err != nil {
-		return cleanup(file, err)
-	}
-
-	return os.Rename(file.Name(), f.resourcesFilePath(res))
-}
-
-// Update existing object.
-func (f *FileStore) update(res zebra.Resource) error {
-	if err := f.Delete(res); err != nil {
+	if err := f.writeJournal(ops); err != nil {
 		return err
 	}
 
-	return f.Create(res)
-}
-
-// Delete object given storage root path and UUID.
-// If object does not exist, return error.
-func (f *FileStore) Delete(res zebra.Resource) error {
-	path := f.resourcesFilePath(res)
-
-	// attempt to delete resource that does not exist, just return nil
-	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
-		return nil
+	if err := f.replay(ops); err != nil {
+		return f.undo(err, ops)
 	}
 
-	if err := syscall.Unlink(path); err != nil {
-		return err
+	if err := f.removeJournal(); err != nil {
+		return multierror.Append(ErrJournalRemove, err)
 	}
 
 	return nil
@@ -245,13 +233,6 @@ func (f *FileStore) resourcesFilePath(res zebra.Resource) string {
 	return path.Join(f.storageRoot, "resources", resID[:2], resID[2:])
 }
 
-// Return folder path given resource.
-func (f *FileStore) resourcesFolderPath(res zebra.Resource) string {
-	resID := res.GetID()
-
-	return path.Join(f.storageRoot, "resources", resID[:2])
-}
-
 // Return path to filestore resources folder.
 func (f *FileStore) filestoreResourcesPath() string {
 	return path.Join(f.storageRoot, "resources")
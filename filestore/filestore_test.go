@@ -1,8 +1,10 @@
 package filestore_test
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"path"
 	"testing"
 
 	"github.com/project-safari/zebra"
@@ -270,6 +272,124 @@ func TestBadLoad2(t *testing.T) {
 	assert.NotNil(err)
 }
 
+func TestApply(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "teststoreapply"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	types := zebra.Factory()
+	types.Add(network.VLANPoolType())
+
+	fs := filestore.NewFileStore(root, types)
+	assert.Nil(fs.Initialize())
+
+	newVLAN := func() *network.VLANPool {
+		vlan := getVLAN()
+		vlan.Labels = zebra.Labels{"system.group": "eng"}
+
+		return vlan
+	}
+
+	kept, gone := newVLAN(), newVLAN()
+	assert.Nil(fs.Apply([]zebra.Resource{kept, gone}, nil))
+
+	resources, err := fs.Load()
+	assert.Nil(err)
+	assert.Len(resources.Resources["VLANPool"].Resources, 2)
+
+	// Update one, delete the other and create a new one
+	added := newVLAN()
+	kept.RangeEnd = 5
+	assert.Nil(fs.Apply([]zebra.Resource{kept, added}, []zebra.Resource{gone, newVLAN()}))
+
+	resources, err = fs.Load()
+	assert.Nil(err)
+	assert.Len(resources.Resources["VLANPool"].Resources, 2)
+
+	_, err = os.Stat(getPath(root, gone))
+	assert.True(os.IsNotExist(err))
+
+	// A failed batch changes nothing, the folder of the new resource is gone
+	broken := newVLAN()
+	assert.Nil(os.RemoveAll(path.Dir(getPath(root, broken))))
+
+	kept.RangeEnd = 7
+	assert.NotNil(fs.Apply([]zebra.Resource{kept, broken}, []zebra.Resource{added}))
+
+	resources, err = fs.Load()
+	assert.Nil(err)
+	assert.Len(resources.Resources["VLANPool"].Resources, 2)
+
+	for _, res := range resources.Resources["VLANPool"].Resources {
+		vlan, ok := res.(*network.VLANPool)
+		assert.True(ok)
+
+		if vlan.ID == kept.ID {
+			assert.Equal(uint16(5), vlan.RangeEnd)
+		}
+	}
+
+	_, err = os.Stat(path.Join(root, filestore.JournalFile))
+	assert.True(os.IsNotExist(err))
+}
+
+func TestRecover(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "teststorerecover"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	types := zebra.Factory()
+	types.Add(network.VLANPoolType())
+
+	fs := filestore.NewFileStore(root, types)
+	assert.Nil(fs.Initialize())
+
+	kept, gone := getVLAN(), getVLAN()
+	kept.Labels = zebra.Labels{"system.group": "eng"}
+	gone.Labels = kept.Labels
+	assert.Nil(fs.Apply([]zebra.Resource{kept, gone}, nil))
+
+	// Crash while applying a batch which updates one and deletes the other,
+	// the first file was half written
+	kept.RangeEnd = 9
+	updated, err := json.Marshal(kept)
+	assert.Nil(err)
+
+	temp := path.Join(path.Dir(getPath(root, kept)), "temp_"+kept.ID[2:]+"123")
+	assert.Nil(os.WriteFile(temp, updated[:5], filestore.RWRR))
+
+	batch := fmt.Sprintf(`{"ops":[{"id":%q,"after":%s},{"id":%q}]}`, kept.ID, updated, gone.ID)
+	assert.Nil(os.WriteFile(path.Join(root, filestore.JournalFile), []byte(batch), filestore.RWRR))
+
+	// The batch is completed on initialization
+	fs = filestore.NewFileStore(root, types)
+	assert.Nil(fs.Initialize())
+
+	resources, err := fs.Load()
+	assert.Nil(err)
+	assert.Len(resources.Resources["VLANPool"].Resources, 1)
+
+	vlan, ok := resources.Resources["VLANPool"].Resources[0].(*network.VLANPool)
+	assert.True(ok)
+	assert.Equal(kept.ID, vlan.ID)
+	assert.Equal(uint16(9), vlan.RangeEnd)
+
+	for _, file := range []string{temp, path.Join(root, filestore.JournalFile)} {
+		_, err = os.Stat(file)
+		assert.True(os.IsNotExist(err))
+	}
+
+	// An invalid journal is not replayed
+	assert.Nil(os.WriteFile(path.Join(root, filestore.JournalFile), []byte("{"), filestore.RWRR))
+	assert.Equal(filestore.ErrJournalInvalid, fs.Initialize())
+}
+
 func getVLAN() *network.VLANPool {
 	return &network.VLANPool{
 		BaseResource: *zebra.NewBaseResource("VLANPool", nil),
@@ -0,0 +1,282 @@
+package filestore
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/project-safari/zebra"
+)
+
+// JournalFile is the write-ahead journal in the storage root. It holds the
+// batch being applied, if any, and is removed once the batch is applied.
+const JournalFile = "journal"
+
+// tempPrefix is the prefix of the files written before being renamed in place.
+const tempPrefix = "temp_"
+
+var ErrJournalInvalid = errors.New("journal invalid")
+
+// ErrJournalRemove is returned along with the cause if a batch has been
+// applied but its journal could not be removed. The batch is stored, the
+// journal left behind only applies it again on the next initialization.
+var ErrJournalRemove = errors.New("batch applied, journal could not be removed")
+
+// removeFile removes the file, it is replaced in the tests.
+var removeFile = os.Remove //nolint:gochecknoglobals
+
+// journalOp sets the file of the resource with the given ID to After, or
+// removes it if After is empty. Before is the previous contents of the file,
+// empty if there was none, so that the op can be undone.
+type journalOp struct {
+	ID     string          `json:"id"`
+	After  json.RawMessage `json:"after,omitempty"`
+	Before json.RawMessage `json:"before,omitempty"`
+}
+
+type journal struct {
+	Ops []journalOp `json:"ops"`
+}
+
+// journalOps returns the ops storing the created resources and deleting the
+// deleted resources. Deleting a resource which is not stored is left out.
+func (f *FileStore) journalOps(creates []zebra.Resource, deletes []zebra.Resource) ([]journalOp, error) {
+	ops := make([]journalOp, 0, len(creates)+len(deletes))
+
+	for _, res := range creates {
+		after, err := json.Marshal(res)
+		if err != nil {
+			return nil, err
+		}
+
+		before, err := readFile(f.resourcesFilePath(res))
+		if err != nil {
+			return nil, err
+		}
+
+		ops = append(ops, journalOp{ID: res.GetID(), After: after, Before: before})
+	}
+
+	for _, res := range deletes {
+		before, err := readFile(f.resourcesFilePath(res))
+		if err != nil {
+			return nil, err
+		}
+
+		if before != nil {
+			ops = append(ops, journalOp{ID: res.GetID(), After: nil, Before: before})
+		}
+	}
+
+	return ops, nil
+}
+
+// writeJournal durably replaces the journal with the ops. The journal is
+// written aside and renamed in place, so that it is either whole or missing
+// after a crash.
+func (f *FileStore) writeJournal(ops []journalOp) error {
+	contents, err := json.Marshal(journal{Ops: ops})
+	if err != nil {
+		return err
+	}
+
+	return writeFile(f.journalPath(), contents)
+}
+
+// removeJournal durably removes the journal once its batch is applied.
+func (f *FileStore) removeJournal() error {
+	if err := removeFile(f.journalPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return syncDir(f.storageRoot)
+}
+
+// replay applies the ops in order. Ops can be replayed any number of times,
+// so that a batch interrupted anywhere can be completed.
+func (f *FileStore) replay(ops []journalOp) error {
+	for _, op := range ops {
+		if len(op.ID) <= 2 { //nolint:gomnd
+			return ErrJournalInvalid
+		}
+
+		file := path.Join(f.filestoreResourcesPath(), op.ID[:2], op.ID[2:])
+
+		if op.After != nil {
+			if err := writeFile(file, op.After); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err := os.Remove(file); errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if err := syncDir(path.Dir(file)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// undo undoes the ops of the batch which failed with err. The undo is itself
+// journaled first, if the journal cannot be written the batch is left in the
+// journal and completed on the next initialization instead. The batch error
+// is returned along with the errors of the undo.
+func (f *FileStore) undo(err error, ops []journalOp) error {
+	errs := multierror.Append(nil, err)
+
+	undo := make([]journalOp, 0, len(ops))
+	for i := len(ops) - 1; i >= 0; i-- {
+		undo = append(undo, journalOp{ID: ops[i].ID, After: ops[i].Before, Before: ops[i].After})
+	}
+
+	if e := f.writeJournal(undo); e != nil {
+		return multierror.Append(errs, e)
+	}
+
+	if e := f.replay(undo); e != nil {
+		return multierror.Append(errs, e)
+	}
+
+	if e := f.removeJournal(); e != nil {
+		errs = multierror.Append(errs, e)
+	}
+
+	return errs
+}
+
+// recover completes the batch left in the journal, if any, and removes the
+// files which were being written when the store stopped.
+func (f *FileStore) recover() error {
+	temps := []string{}
+
+	for _, pattern := range []string{
+		path.Join(f.filestoreResourcesPath(), "*", tempPrefix+"*"),
+		path.Join(f.storageRoot, tempPrefix+JournalFile+"*"),
+	} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+
+		temps = append(temps, matches...)
+	}
+
+	contents, err := os.ReadFile(f.journalPath())
+
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		j := journal{Ops: nil}
+		if err := json.Unmarshal(contents, &j); err != nil {
+			return ErrJournalInvalid
+		}
+
+		if err := f.replay(j.Ops); err != nil {
+			return err
+		}
+
+		if err := f.removeJournal(); err != nil {
+			return err
+		}
+	}
+
+	for _, temp := range temps {
+		if err := os.Remove(temp); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Return path to the journal.
+func (f *FileStore) journalPath() string {
+	return path.Join(f.storageRoot, JournalFile)
+}
+
+// readFile returns the contents of the file, nil if it does not exist.
+func readFile(file string) ([]byte, error) {
+	contents, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	return contents, err
+}
+
+// writeFile durably replaces the file with the contents. The contents are
+// written to a temporary file in the same folder, synced and renamed in
+// place, then the folder is synced so that the rename survives a crash.
+func writeFile(file string, contents []byte) error {
+	dir := path.Dir(file)
+
+	temp, err := os.CreateTemp(dir, tempPrefix+path.Base(file))
+	if err != nil {
+		return err
+	}
+
+	cleanup := func(err error) error {
+		errs := multierror.Append(nil, err)
+
+		if e := temp.Close(); e != nil && !errors.Is(e, os.ErrClosed) {
+			errs = multierror.Append(errs, e)
+		}
+
+		if e := os.Remove(temp.Name()); e != nil {
+			errs = multierror.Append(errs, e)
+		}
+
+		return errs
+	}
+
+	if _, err := temp.Write(contents); err != nil {
+		return cleanup(err)
+	}
+
+	if err := temp.Chmod(RWRR); err != nil {
+		return cleanup(err)
+	}
+
+	if err := temp.Sync(); err != nil {
+		return cleanup(err)
+	}
+
+	if err := temp.Close(); err != nil {
+		return cleanup(err)
+	}
+
+	if err := os.Rename(temp.Name(), file); err != nil {
+		return cleanup(err)
+	}
+
+	return syncDir(dir)
+}
+
+// syncDir syncs the folder, so that the files created, renamed or removed in
+// it survive a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	if err := d.Sync(); err != nil {
+		d.Close()
+
+		return err
+	}
+
+	return d.Close()
+}
@@ -0,0 +1,55 @@
+package filestore //nolint:testpackage
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/network"
+	"github.com/stretchr/testify/assert"
+)
+
+var errRemove = errors.New("remove failed")
+
+//nolint:paralleltest
+func TestJournalRemove(t *testing.T) {
+	assert := assert.New(t)
+
+	root := "teststorejournalremove"
+
+	t.Cleanup(func() {
+		removeFile = os.Remove
+		os.RemoveAll(root)
+	})
+
+	types := zebra.Factory()
+	types.Add(network.VLANPoolType())
+
+	fs := NewFileStore(root, types)
+	assert.Nil(fs.Initialize())
+
+	vlan := network.NewVlanPool(0, 1, zebra.Labels{"system.group": "eng"})
+
+	// The batch is stored even though its journal is left behind
+	removeFile = func(string) error { return errRemove }
+	err := fs.Apply([]zebra.Resource{vlan}, nil)
+	assert.True(errors.Is(err, ErrJournalRemove))
+	assert.True(errors.Is(err, errRemove))
+
+	removeFile = os.Remove
+
+	resources, err := fs.Load()
+	assert.Nil(err)
+	assert.Len(resources.Resources["VLANPool"].Resources, 1)
+
+	// Replaying the journal left behind changes nothing
+	assert.Nil(fs.Initialize())
+
+	resources, err = fs.Load()
+	assert.Nil(err)
+	assert.Len(resources.Resources["VLANPool"].Resources, 1)
+
+	_, err = os.Stat(fs.journalPath())
+	assert.True(os.IsNotExist(err))
+}
@@ -0,0 +1,106 @@
+// Package jsonlog implements an append-only log of json values stored one per
+// line in a file. The audit and usage logs are built on it.
+package jsonlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/project-safari/zebra/filestore"
+)
+
+// MaxLine is the size of the longest line which can be read from a log.
+const MaxLine = 1 << 24
+
+var ErrLogPath = errors.New("log path is empty")
+
+// Log is an append-only log of json lines in a file. Appends are serialized
+// and never seen half written by scans.
+type Log struct {
+	lock sync.RWMutex
+	file string
+}
+
+// NewLog returns a log stored in the given file.
+func NewLog(file string) *Log {
+	return &Log{
+		lock: sync.RWMutex{},
+		file: file,
+	}
+}
+
+// Initialize creates the directory of the log file if it does not exist.
+func (l *Log) Initialize() error {
+	if l.file == "" {
+		return ErrLogPath
+	}
+
+	return os.MkdirAll(path.Dir(l.file), os.ModePerm)
+}
+
+// Append appends the values to the log in a single write, nothing is written
+// if any of them cannot be marshaled.
+func (l *Log) Append(values ...interface{}) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	data := []byte{}
+
+	for _, v := range values {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		data = append(append(data, b...), '\n')
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	f, err := os.OpenFile(l.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, filestore.RWRR)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+
+		return err
+	}
+
+	return f.Close()
+}
+
+// Scan calls f with each line of the log in the order they were appended,
+// until f returns an error, which is returned. A log which has not been
+// appended to yet has no lines.
+func (l *Log) Scan(f func(line []byte) error) error {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	file, err := os.Open(l.file)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), MaxLine)
+
+	for scanner.Scan() {
+		if err := f(scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,73 @@
+package jsonlog_test
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/project-safari/zebra/filestore"
+	"github.com/project-safari/zebra/jsonlog"
+	"github.com/stretchr/testify/assert"
+)
+
+var errStop = errors.New("stop")
+
+func TestLog(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testjsonlog"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	assert.Equal(jsonlog.ErrLogPath, jsonlog.NewLog("").Initialize())
+
+	file := filepath.Join(root, "logs", "test.log")
+	log := jsonlog.NewLog(file)
+	assert.Nil(log.Initialize())
+
+	lines := func() []string {
+		values := []string{}
+
+		assert.Nil(log.Scan(func(line []byte) error {
+			var v string
+			if err := json.Unmarshal(line, &v); err != nil {
+				return err
+			}
+
+			values = append(values, v)
+
+			return nil
+		}))
+
+		return values
+	}
+
+	// No lines before the first append
+	assert.Empty(lines())
+
+	assert.Nil(log.Append())
+	assert.Nil(log.Append("thor", "loki"))
+	assert.Nil(log.Append("odin"))
+	assert.Equal([]string{"thor", "loki", "odin"}, lines())
+
+	info, err := os.Stat(file)
+	assert.Nil(err)
+	assert.Equal(filestore.RWRR, info.Mode().Perm())
+
+	// Nothing is appended if a value cannot be marshaled
+	assert.NotNil(log.Append("frigg", math.Inf(1)))
+	assert.Equal([]string{"thor", "loki", "odin"}, lines())
+
+	// Scans stop at the first error
+	count := 0
+	assert.Equal(errStop, log.Scan(func(line []byte) error {
+		count++
+
+		return errStop
+	}))
+	assert.Equal(1, count)
+}
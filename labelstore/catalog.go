@@ -0,0 +1,106 @@
+package labelstore
+
+import (
+	"sort"
+
+	"github.com/project-safari/zebra"
+)
+
+// GroupLabel is the label of the group of a resource.
+const GroupLabel = "system.group"
+
+// Scope is the type and group of resources, which read access is granted on.
+type Scope struct {
+	Type  string `json:"type"`
+	Group string `json:"group"`
+}
+
+// LabelCount is the number of resources of a scope with a label value.
+type LabelCount struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Scope
+	Count int `json:"count"`
+}
+
+// Catalog keeps the label keys, their values and the number of resources of
+// each scope with each value as resources are added and removed.
+type Catalog struct {
+	counts map[string]map[string]map[Scope]int
+}
+
+func NewCatalog() *Catalog {
+	return &Catalog{counts: make(map[string]map[string]map[Scope]int)}
+}
+
+// Add counts the labels of a resource of the given type.
+func (c *Catalog) Add(resType string, labels zebra.Labels) {
+	scope := Scope{Type: resType, Group: labels[GroupLabel]}
+
+	for key, val := range labels {
+		if c.counts[key] == nil {
+			c.counts[key] = make(map[string]map[Scope]int)
+		}
+
+		if c.counts[key][val] == nil {
+			c.counts[key][val] = make(map[Scope]int)
+		}
+
+		c.counts[key][val][scope]++
+	}
+}
+
+// Remove uncounts the labels of a resource of the given type, they must have
+// been added before.
+func (c *Catalog) Remove(resType string, labels zebra.Labels) {
+	scope := Scope{Type: resType, Group: labels[GroupLabel]}
+
+	for key, val := range labels {
+		values := c.counts[key]
+		if values == nil || values[val] == nil {
+			continue
+		}
+
+		if values[val][scope]--; values[val][scope] <= 0 {
+			delete(values[val], scope)
+		}
+
+		if len(values[val]) == 0 {
+			delete(values, val)
+		}
+
+		if len(values) == 0 {
+			delete(c.counts, key)
+		}
+	}
+}
+
+// Counts returns the label counts sorted by key, value, type and group.
+func (c *Catalog) Counts() []LabelCount {
+	counts := []LabelCount{}
+
+	for key, values := range c.counts {
+		for val, scopes := range values {
+			for scope, count := range scopes {
+				counts = append(counts, LabelCount{Key: key, Value: val, Scope: scope, Count: count})
+			}
+		}
+	}
+
+	sort.Slice(counts, func(i, j int) bool {
+		a, b := counts[i], counts[j]
+
+		switch {
+		case a.Key != b.Key:
+			return a.Key < b.Key
+		case a.Value != b.Value:
+			return a.Value < b.Value
+		case a.Type != b.Type:
+			return a.Type < b.Type
+		default:
+			return a.Group < b.Group
+		}
+	})
+
+	return counts
+}
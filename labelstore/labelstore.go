@@ -7,7 +7,9 @@ import (
 type LabelStore struct {
 	factory   zebra.ResourceFactory
 	uuids     map[string]zebra.Resource
+	labels    map[string]zebra.Labels
 	resources map[string]*zebra.ResourceMap
+	catalog   *Catalog
 }
 
 // Return new label store pointer given resource map.
@@ -25,12 +27,30 @@ func NewLabelStore(resources *zebra.ResourceMap) *LabelStore {
 
 			return ret
 		}(),
+		labels:    make(map[string]zebra.Labels),
 		resources: makeLabelMap(resources),
+		catalog:   NewCatalog(),
+	}
+
+	for id, res := range labelstore.uuids {
+		labelstore.labels[id] = copyLabels(res.GetLabels())
+		labelstore.catalog.Add(res.GetType(), res.GetLabels())
 	}
 
 	return labelstore
 }
 
+// copyLabels returns a copy of the labels, so that the indexed labels of a
+// resource are known even if its labels are changed in place.
+func copyLabels(labels zebra.Labels) zebra.Labels {
+	ret := make(zebra.Labels, len(labels))
+	for key, val := range labels {
+		ret[key] = val
+	}
+
+	return ret
+}
+
 func makeLabelMap(resources *zebra.ResourceMap) map[string]*zebra.ResourceMap {
 	labelMap := make(map[string]*zebra.ResourceMap)
 
@@ -56,6 +76,8 @@ func (ls *LabelStore) Initialize() error {
 func (ls *LabelStore) Wipe() error {
 	ls.resources = nil
 	ls.uuids = nil
+	ls.labels = nil
+	ls.catalog = nil
 
 	return nil
 }
@@ -63,6 +85,8 @@ func (ls *LabelStore) Wipe() error {
 func (ls *LabelStore) Clear() error {
 	ls.resources = make(map[string]*zebra.ResourceMap)
 	ls.uuids = make(map[string]zebra.Resource)
+	ls.labels = make(map[string]zebra.Labels)
+	ls.catalog = NewCatalog()
 
 	return nil
 }
@@ -89,9 +113,11 @@ func (ls *LabelStore) Create(res zebra.Resource) error {
 	}
 
 	// Create a new resource
+	labels := copyLabels(res.GetLabels())
 	ls.uuids[res.GetID()] = res
+	ls.labels[res.GetID()] = labels
 
-	for label, val := range res.GetLabels() {
+	for label, val := range labels {
 		if ls.resources[label] == nil {
 			ls.resources[label] = zebra.NewResourceMap(ls.factory)
 		}
@@ -99,6 +125,8 @@ func (ls *LabelStore) Create(res zebra.Resource) error {
 		ls.resources[label].Add(res, val)
 	}
 
+	ls.catalog.Add(res.GetType(), labels)
+
 	return nil
 }
 
@@ -114,13 +142,17 @@ func (ls *LabelStore) update(oldRes zebra.Resource, res zebra.Resource) error {
 // Delete a resource.
 func (ls *LabelStore) Delete(res zebra.Resource) error {
 	// If resource does not exist in store, just return without error
-	if _, err := ls.find(res.GetID()); err != nil {
+	stored, err := ls.find(res.GetID())
+	if err != nil {
 		return nil
 	}
 
-	for label, val := range res.GetLabels() {
+	// The labels the resource was indexed with are removed
+	labels := ls.labels[res.GetID()]
+
+	for label, val := range labels {
 		if ls.resources[label] != nil {
-			ls.resources[label].Delete(res, val)
+			ls.resources[label].Delete(stored, val)
 
 			if len(ls.resources[label].Resources) == 0 {
 				delete(ls.resources, label)
@@ -128,42 +160,37 @@ func (ls *LabelStore) Delete(res zebra.Resource) error {
 		}
 	}
 
+	ls.catalog.Remove(stored.GetType(), labels)
+
 	delete(ls.uuids, res.GetID())
+	delete(ls.labels, res.GetID())
 
 	return nil
 }
 
-// Return all resources of given label - label value pairs in a ResourceMap.
-func (ls *LabelStore) Query(query zebra.Query) *zebra.ResourceMap {
-	if query.Op == zebra.MatchEqual || query.Op == zebra.MatchIn {
-		return ls.labelMatch(query, true)
-	}
-
-	return ls.labelMatch(query, false)
+// Catalog returns the number of resources with each label value, by type and
+// group.
+func (ls *LabelStore) Catalog() []LabelCount {
+	return ls.catalog.Counts()
 }
 
-func (ls *LabelStore) labelMatch(query zebra.Query, inVals bool) *zebra.ResourceMap {
+// Return all resources of given label - label value pairs in a ResourceMap.
+// Resources without the label never match.
+func (ls *LabelStore) Query(query zebra.Query) *zebra.ResourceMap {
 	results := zebra.NewResourceMap(ls.factory)
 
-	if inVals {
-		for _, val := range query.Values {
-			if ls.resources[query.Key] == nil || ls.resources[query.Key].Resources[val] == nil {
-				continue
-			}
-
-			for _, res := range ls.resources[query.Key].Resources[val].Resources {
-				results.Add(res, res.GetType())
-			}
-		}
-
+	valMaps, ok := ls.resources[query.Key]
+	if !ok {
 		return results
 	}
 
-	for val, valMap := range ls.resources[query.Key].Resources {
-		if !zebra.IsIn(val, query.Values) {
-			for _, res := range valMap.Resources {
-				results.Add(res, res.GetType())
-			}
+	for val, valMap := range valMaps.Resources {
+		if !query.Match(val, true) {
+			continue
+		}
+
+		for _, res := range valMap.Resources {
+			results.Add(res, res.GetType())
 		}
 	}
 
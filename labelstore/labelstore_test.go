@@ -209,6 +209,50 @@ func TestQuery(t *testing.T) {
 	assert.Equal(1, len(resources.Resources))
 }
 
+func TestCatalog(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	vlan1 := getVLAN()
+	vlan1.Labels = zebra.Labels{"system.group": "eng", "a": "i"}
+
+	vlan2 := getVLAN()
+	vlan2.Labels = zebra.Labels{"system.group": "eng", "a": "i"}
+
+	resMap := zebra.NewResourceMap(nil)
+	resMap.Add(vlan1, "VLANPool")
+
+	ls := labelstore.NewLabelStore(resMap)
+	assert.Nil(ls.Create(vlan2))
+
+	eng := labelstore.Scope{Type: "VLANPool", Group: "eng"}
+	ops := labelstore.Scope{Type: "VLANPool", Group: "ops"}
+
+	assert.Equal([]labelstore.LabelCount{
+		{Key: "a", Value: "i", Scope: eng, Count: 2},
+		{Key: "system.group", Value: "eng", Scope: eng, Count: 2},
+	}, ls.Catalog())
+
+	// Updates uncount the labels counted before, even if the resource was
+	// changed in place
+	vlan2.Labels["system.group"] = "ops"
+	vlan2.Labels["a"] = "j"
+	assert.Nil(ls.Create(vlan2))
+
+	assert.Equal([]labelstore.LabelCount{
+		{Key: "a", Value: "i", Scope: eng, Count: 1},
+		{Key: "a", Value: "j", Scope: ops, Count: 1},
+		{Key: "system.group", Value: "eng", Scope: eng, Count: 1},
+		{Key: "system.group", Value: "ops", Scope: ops, Count: 1},
+	}, ls.Catalog())
+
+	assert.Equal(1, len(ls.Query(zebra.Query{Op: zebra.MatchEqual, Key: "a", Values: []string{"i"}}).Resources))
+
+	assert.Nil(ls.Delete(vlan1))
+	assert.Nil(ls.Delete(vlan2))
+	assert.Empty(ls.Catalog())
+}
+
 func getVLAN() *network.VLANPool {
 	return &network.VLANPool{
 		BaseResource: *zebra.NewBaseResource("VLANPool", nil),
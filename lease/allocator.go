@@ -0,0 +1,447 @@
+package lease
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/usage"
+)
+
+var (
+	ErrLeaseActive  = errors.New("lease is already active")
+	ErrLeaseEnded   = errors.New("lease is neither active nor queued")
+	ErrNoResources  = errors.New("not enough free resources to satisfy lease request")
+	ErrStoreMissing = errors.New("allocator store is nil")
+	ErrLeaseType    = errors.New("store factory does not make leases")
+)
+
+// Allocator satisfies lease resource requests with free resources from a
+// store. All allocations are serialized so that two leases can never be
+// handed the same resource.
+type Allocator struct {
+	lock  sync.Mutex
+	store zebra.Store
+	usage *usage.Log
+}
+
+// Return new allocator pointer which allocates resources from the given store.
+func NewAllocator(store zebra.Store) *Allocator {
+	return &Allocator{
+		lock:  sync.Mutex{},
+		store: store,
+		usage: nil,
+	}
+}
+
+// RecordUsage records the intervals the resources of released leases were
+// leased for in the given usage log.
+func (a *Allocator) RecordUsage(log *usage.Log) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.usage = log
+}
+
+// Allocate picks free resources for every unsatisfied request in the lease,
+// marks them as leased by the lease owner, activates the lease and stores it.
+// Either all requests are satisfied or no resource is modified. The given
+// lease is not changed, the activated lease as stored is returned.
+func (a *Allocator) Allocate(l *Lease) (*Lease, error) {
+	if a.store == nil {
+		return nil, ErrStoreMissing
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return a.allocate(l)
+}
+
+// allocate implements Allocate. The leased resources and the lease are
+// written in one transaction, so either all of them are stored or none. This
+// function must never be called without holding the allocator lock.
+func (a *Allocator) allocate(l *Lease) (*Lease, error) {
+	if l.IsValid() {
+		return nil, ErrLeaseActive
+	}
+
+	next, err := a.copyLease(l)
+	if err != nil {
+		return nil, err
+	}
+
+	picks, err := a.pick(next)
+	if err != nil {
+		return nil, err
+	}
+
+	txn := a.store.Begin()
+
+	if err := a.lease(txn, picks, next.Owner(), next.ID); err != nil {
+		txn.Rollback()
+
+		return nil, err
+	}
+
+	for req, resources := range picks {
+		for _, res := range resources {
+			if err := req.Assign(res); err != nil {
+				txn.Rollback()
+
+				return nil, err
+			}
+		}
+	}
+
+	if err := next.Activate(); err != nil {
+		txn.Rollback()
+
+		return nil, err
+	}
+
+	if err := txn.Create(next); err != nil {
+		txn.Rollback()
+
+		return nil, err
+	}
+
+	if err := txn.Commit(); err != nil {
+		return nil, err
+	}
+
+	return next, nil
+}
+
+// copyLease returns a copy of the lease to be changed and stored. Stored
+// leases are shared with the readers of the store, so they are never changed
+// in place.
+func (a *Allocator) copyLease(l *Lease) (*Lease, error) {
+	copied, err := zebra.CopyResource(a.store.QueryUUID(nil).GetFactory(), l)
+	if err != nil {
+		return nil, err
+	}
+
+	next, ok := copied.(*Lease)
+	if !ok {
+		return nil, ErrLeaseType
+	}
+
+	return next, nil
+}
+
+// lease stages copies of the picked resources marked as leased by owner under
+// the lease id in the transaction, the picks are replaced by the copies.
+func (a *Allocator) lease(txn zebra.Txn, picks map[*ResourceReq][]zebra.Resource, owner, leaseID string,
+) error {
+	for _, resources := range picks {
+		for i, res := range resources {
+			copied, err := a.withLease(res, zebra.Leased, owner, leaseID)
+			if err != nil {
+				return err
+			}
+
+			if err := txn.Create(copied); err != nil {
+				return err
+			}
+
+			resources[i] = copied
+		}
+	}
+
+	return nil
+}
+
+// withLease returns a copy of the resource with the given lease state, user and
+// lease id. Stored resources are shared with the readers of the store, so they
+// are never changed in place.
+func (a *Allocator) withLease(res zebra.Resource, lease zebra.Lease, usedBy, leaseID string,
+) (zebra.Resource, error) {
+	copied, err := zebra.CopyResource(a.store.QueryUUID(nil).GetFactory(), res)
+	if err != nil {
+		return nil, err
+	}
+
+	status := copied.GetStatus()
+	status.Lease = lease
+	status.UsedBy = usedBy
+	status.LeaseID = leaseID
+	copied.SetStatus(status)
+
+	return copied, nil
+}
+
+// pick chooses the free resources for each unsatisfied request in the lease
+// without modifying anything. If any request cannot be satisfied, error is
+// returned.
+func (a *Allocator) pick(l *Lease) (map[*ResourceReq][]zebra.Resource, error) {
+	picks := make(map[*ResourceReq][]zebra.Resource)
+	picked := make(map[string]struct{})
+
+	for _, req := range l.RequestList() {
+		if err := validateFilters(req.Filters); err != nil {
+			return nil, err
+		}
+
+		need := req.Count - len(req.Resources)
+		if need <= 0 {
+			continue
+		}
+
+		candidates := a.candidates(l, req, picked, true)
+		if len(candidates) < need {
+			return nil, ErrNoResources
+		}
+
+		for _, res := range candidates[:need] {
+			picked[res.GetID()] = struct{}{}
+		}
+
+		picks[req] = candidates[:need]
+	}
+
+	return picks, nil
+}
+
+// candidates returns all resources in the store which match the type, group
+// and filters of the request and which the lease owner can lease, skipping
+// the resources already picked. If free is set, only the resources in the
+// free pool are returned.
+func (a *Allocator) candidates(l *Lease, req *ResourceReq, picked map[string]struct{},
+	free bool,
+) []zebra.Resource {
+	resources := make([]zebra.Resource, 0)
+	resMap := a.lookup(req.Type, free)
+
+	for _, list := range resMap.Resources {
+		for _, res := range list.Resources {
+			if _, ok := picked[res.GetID()]; ok {
+				continue
+			}
+
+			if free && res.GetStatus().Lease != zebra.Free {
+				continue
+			}
+
+			labels := res.GetLabels()
+			if req.Group != "" && !labels.MatchEqual("system.group", req.Group) {
+				continue
+			}
+
+			if matchFilters(labels, req.Filters) && l.CanLease(res) {
+				resources = append(resources, res)
+			}
+		}
+	}
+
+	return resources
+}
+
+// lookup returns the resources of the type in the store, only those in the
+// free pool if free is set. Lease states are indexed by the store, so the free
+// pool is looked up by lease state rather than going through all resources of
+// the type.
+func (a *Allocator) lookup(resType string, free bool) *zebra.ResourceMap {
+	if free {
+		lease := zebra.Free
+		query := zebra.Query{Key: "Status.Lease", Op: zebra.MatchEqual, Values: []string{lease.String()}}
+
+		if resMap, err := a.store.QueryProperty(query); err == nil {
+			freeMap := zebra.NewResourceMap(resMap.GetFactory())
+			if list, ok := resMap.Resources[resType]; ok {
+				freeMap.Resources[resType] = list
+			}
+
+			return freeMap
+		}
+	}
+
+	return a.store.QueryType([]string{resType})
+}
+
+// Validate all filter queries of a resource request.
+func validateFilters(filters []zebra.Query) error {
+	for _, q := range filters {
+		if err := q.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Return if labels match all given filter queries.
+func matchFilters(labels zebra.Labels, filters []zebra.Query) bool {
+	for _, q := range filters {
+		val, ok := labels[q.Key]
+
+		if !q.Match(val, ok) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Release deactivates the lease and returns all resources assigned to it to
+// the free pool. Both the resources and the lease are stored. Resources which
+// have been deleted or are no longer leased by this lease are skipped. A
+// queued lease is removed from the queue. Queued leases are then allocated
+// from the freed resources. Leases which are neither active nor queued, because
+// they have been released or have expired, can not be released again. The
+// given lease is not changed, the released lease and the queued leases which
+// have been activated are returned as stored.
+func (a *Allocator) Release(l *Lease) (*Lease, []*Lease, error) {
+	if a.store == nil {
+		return nil, nil, ErrStoreMissing
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if !l.IsValid() && !l.IsQueued() {
+		return nil, nil, ErrLeaseEnded
+	}
+
+	var errs error
+
+	released, err := a.release(l)
+	if err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	// Freed resources may satisfy queued leases now
+	activated, err := a.schedule()
+	if err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	return released, activated, errs
+}
+
+// release implements Release. The freed resources and the lease are written
+// in one transaction, so either all of them are stored or none. This function
+// must never be called without holding the allocator lock.
+func (a *Allocator) release(l *Lease) (*Lease, error) {
+	next, err := a.copyLease(l)
+	if err != nil {
+		return nil, err
+	}
+
+	next.Deactivate()
+	next.Dequeue()
+
+	txn := a.store.Begin()
+
+	for _, req := range next.RequestList() {
+		for _, assigned := range req.Resources {
+			for _, list := range a.store.QueryUUID([]string{assigned.GetID()}).Resources {
+				for _, res := range list.Resources {
+					status := res.GetStatus()
+					if status.Lease != zebra.Leased || status.LeaseID != next.ID {
+						continue
+					}
+
+					freed, err := a.withLease(res, zebra.Free, "", "")
+					if err == nil {
+						err = txn.Create(freed)
+					}
+
+					if err != nil {
+						txn.Rollback()
+
+						return nil, err
+					}
+				}
+			}
+		}
+	}
+
+	if err := txn.Create(next); err != nil {
+		txn.Rollback()
+
+		return nil, err
+	}
+
+	if err := txn.Commit(); err != nil {
+		return nil, err
+	}
+
+	// Usage is recorded once the release is stored, on a best effort basis,
+	// it must not fail the release
+	if a.usage != nil {
+		_ = a.usage.Record(l.Intervals(time.Now())...)
+	}
+
+	return next, nil
+}
+
+// Extend the lease by the given duration and store it. The given lease is not
+// changed, the extended lease as stored is returned.
+func (a *Allocator) Extend(l *Lease, dur time.Duration) (*Lease, error) {
+	if a.store == nil {
+		return nil, ErrStoreMissing
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	next, err := a.copyLease(l)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := next.Extend(dur); err != nil {
+		return nil, err
+	}
+
+	if err := a.store.Create(next); err != nil {
+		return nil, err
+	}
+
+	return next, nil
+}
+
+// Reap releases all stored leases which are active but have expired. Queued
+// leases are then allocated from the freed resources. The released leases and
+// the queued leases which have been activated are returned as stored.
+func (a *Allocator) Reap() ([]*Lease, []*Lease, error) {
+	if a.store == nil {
+		return nil, nil, ErrStoreMissing
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	var errs error
+
+	released := make([]*Lease, 0)
+
+	for _, list := range a.store.QueryType([]string{"Lease"}).Resources {
+		for _, res := range list.Resources {
+			l, ok := res.(*Lease)
+			if !ok || l.GetStatus().State != zebra.Active || !l.IsExpired() {
+				continue
+			}
+
+			next, err := a.release(l)
+			if err != nil {
+				errs = multierror.Append(errs, err)
+
+				continue
+			}
+
+			released = append(released, next)
+		}
+	}
+
+	// Freed resources may satisfy queued leases now
+	activated, err := a.schedule()
+	if err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	return released, activated, errs
+}
@@ -0,0 +1,499 @@
+package lease_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/lease"
+	"github.com/project-safari/zebra/network"
+	"github.com/project-safari/zebra/store"
+	"github.com/project-safari/zebra/usage"
+	"github.com/stretchr/testify/assert"
+)
+
+func getVLAN(group string, color string) *network.VLANPool {
+	return &network.VLANPool{
+		BaseResource: *zebra.NewBaseResource("VLANPool",
+			zebra.Labels{"system.group": group, "color": color}),
+		RangeStart: 0,
+		RangeEnd:   10,
+	}
+}
+
+func getOwner() auth.User {
+	return auth.User{
+		NamedResource: zebra.NamedResource{
+			BaseResource: *zebra.NewBaseResource("User", nil),
+			Name:         "tester",
+		},
+		Email:        "tester@zebra.project-safari.io",
+		Key:          nil,
+		PasswordHash: "",
+		Role:         nil,
+	}
+}
+
+func getStore(assert *assert.Assertions, root string) *store.ResourceStore {
+	rs := store.NewResourceStore(root, store.DefaultFactory())
+	assert.Nil(rs.Initialize())
+
+	assert.Nil(rs.Create(getVLAN("eng", "red")))
+	assert.Nil(rs.Create(getVLAN("eng", "red")))
+	assert.Nil(rs.Create(getVLAN("eng", "blue")))
+	assert.Nil(rs.Create(getVLAN("leadership", "red")))
+
+	return rs
+}
+
+func countLeased(rs zebra.Store, owner string) int {
+	count := 0
+
+	for _, res := range rs.QueryType([]string{"VLANPool"}).Resources["VLANPool"].Resources {
+		status := res.GetStatus()
+		if status.Lease == zebra.Leased && status.UsedBy == owner {
+			count++
+		}
+	}
+
+	return count
+}
+
+// storedLease returns the lease with the id as stored.
+func storedLease(assert *assert.Assertions, rs zebra.Store, id string) *lease.Lease {
+	for _, list := range rs.QueryUUID([]string{id}).Resources {
+		for _, res := range list.Resources {
+			l, ok := res.(*lease.Lease)
+			assert.True(ok)
+
+			return l
+		}
+	}
+
+	return nil
+}
+
+func TestAllocate(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testallocate"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	rs := getStore(assert, root)
+	alloc := lease.NewAllocator(rs)
+	owner := getOwner()
+
+	l := lease.NewLease(owner, time.Hour, []*lease.ResourceReq{
+		{
+			Type:  "VLANPool",
+			Group: "eng",
+			Name:  "red vlans",
+			Count: 2,
+			Filters: []zebra.Query{
+				{Key: "color", Op: zebra.MatchEqual, Values: []string{"red"}},
+			},
+		},
+	})
+
+	active, err := alloc.Allocate(l)
+	assert.Nil(err)
+	assert.True(active.IsValid())
+	assert.True(active.IsSatisfied())
+	assert.Equal(2, countLeased(rs, owner.Email))
+
+	for _, res := range active.Request[0].Resources {
+		assert.Equal("red", res.GetLabels()["color"])
+		assert.Equal("eng", res.GetLabels()["system.group"])
+	}
+
+	// The given lease is not changed, the active lease is stored
+	assert.False(l.IsValid())
+	assert.Empty(l.Request[0].Resources)
+	assert.True(storedLease(assert, rs, l.ID).IsValid())
+
+	// Active lease cannot be allocated again
+	_, err = alloc.Allocate(active)
+	assert.Equal(lease.ErrLeaseActive, err)
+}
+
+// Stored resources are read while leases are allocated and released, they
+// must not be changed in place.
+func TestAllocateConcurrentReads(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testallocatereads"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	rs := getStore(assert, root)
+	alloc := lease.NewAllocator(rs)
+	owner := getOwner()
+	before := rs.QueryType([]string{"VLANPool"})
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		for i := 0; i < 100; i++ {
+			_, _ = json.Marshal(rs.QueryType([]string{"VLANPool"}))
+		}
+	}()
+
+	for i := 0; i < 10; i++ {
+		active, err := alloc.Allocate(lease.NewLease(owner, time.Hour, getReq("eng", 2)))
+		assert.Nil(err)
+
+		_, _, err = alloc.Release(active)
+		assert.Nil(err)
+	}
+
+	<-done
+
+	for _, res := range before.Resources["VLANPool"].Resources {
+		assert.Equal(zebra.Free, res.GetStatus().Lease)
+	}
+}
+
+// The leased resources and the lease are stored all or nothing.
+func TestAllocateConflict(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testallocateconflict"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	rs := getStore(assert, root)
+	alloc := lease.NewAllocator(rs)
+	owner := getOwner()
+
+	l := lease.NewLease(owner, time.Hour, getReq("eng", 2))
+	assert.Nil(rs.Create(l))
+
+	copied, err := zebra.CopyResource(store.DefaultFactory(), l)
+	assert.Nil(err)
+
+	stale, ok := copied.(*lease.Lease)
+	assert.True(ok)
+	assert.Nil(rs.Create(l))
+
+	_, err = alloc.Allocate(stale)
+	assert.Equal(zebra.ErrConflict, err)
+	assert.False(stale.IsValid())
+	assert.Empty(stale.Request[0].Resources)
+	assert.Equal(0, countLeased(rs, owner.Email))
+}
+
+func TestAllocateExhausted(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testallocateexhausted"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	rs := getStore(assert, root)
+	alloc := lease.NewAllocator(rs)
+	owner := getOwner()
+
+	// First request can be satisfied, the second one cannot. Nothing must
+	// be leased.
+	l := lease.NewLease(owner, time.Hour, []*lease.ResourceReq{
+		{Type: "VLANPool", Group: "eng", Name: "any", Count: 1},
+		{Type: "VLANPool", Group: "leadership", Name: "all", Count: 2},
+	})
+
+	_, err := alloc.Allocate(l)
+	assert.Equal(lease.ErrNoResources, err)
+	assert.False(l.IsValid())
+	assert.Equal(0, countLeased(rs, owner.Email))
+	assert.Empty(rs.QueryUUID([]string{l.ID}).Resources)
+
+	l = lease.NewLease(owner, time.Hour, []*lease.ResourceReq{
+		{Type: "VLANPool", Group: "eng", Name: "all", Count: 3},
+	})
+	_, err = alloc.Allocate(l)
+	assert.Nil(err)
+	assert.Equal(3, countLeased(rs, owner.Email))
+
+	// Leased resources are not free anymore
+	l = lease.NewLease(owner, time.Hour, []*lease.ResourceReq{
+		{Type: "VLANPool", Group: "eng", Name: "one more", Count: 1},
+	})
+	_, err = alloc.Allocate(l)
+	assert.Equal(lease.ErrNoResources, err)
+}
+
+func TestAllocateBadFilter(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testallocatebadfilter"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	rs := getStore(assert, root)
+	owner := getOwner()
+
+	l := lease.NewLease(owner, time.Hour, []*lease.ResourceReq{
+		{
+			Type:  "VLANPool",
+			Group: "eng",
+			Name:  "bad",
+			Count: 1,
+			Filters: []zebra.Query{
+				{Key: "color", Op: zebra.MatchEqual, Values: []string{"red", "blue"}},
+			},
+		},
+	})
+
+	_, err := lease.NewAllocator(rs).Allocate(l)
+	assert.Equal(zebra.ErrInvalidQuery, err)
+
+	_, err = lease.NewAllocator(nil).Allocate(l)
+	assert.Equal(lease.ErrStoreMissing, err)
+}
+
+func TestAllocateGroupScope(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testallocategroupscope"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	rs := getStore(assert, root)
+	alloc := lease.NewAllocator(rs)
+
+	// The owner can lease in eng but only read leadership
+	eng, err := auth.NewPriv("VLANPool/eng", false, true, true, false)
+	assert.Nil(err)
+
+	read, err := auth.NewPriv("VLANPool/leadership", false, true, false, false)
+	assert.Nil(err)
+
+	owner := getOwner()
+	owner.Role = &auth.Role{Name: "eng", Privileges: []*auth.Priv{eng, read}, Priority: 0}
+
+	l := lease.NewLease(owner, time.Hour, []*lease.ResourceReq{
+		{Type: "VLANPool", Group: "leadership", Name: "leadership", Count: 1},
+	})
+	assert.True(l.CanLease(getVLAN("eng", "red")))
+	assert.False(l.CanLease(getVLAN("leadership", "red")))
+
+	requested, _, err := alloc.Request(l)
+	assert.Equal(lease.ErrNoCapacity, err)
+	assert.Nil(requested)
+
+	_, err = alloc.Allocate(l)
+	assert.Equal(lease.ErrNoResources, err)
+
+	// Requests without a group only get the resources the owner can lease
+	l = lease.NewLease(owner, time.Hour, []*lease.ResourceReq{
+		{Type: "VLANPool", Group: "", Name: "red", Count: 2, Filters: []zebra.Query{
+			{Key: "color", Op: zebra.MatchEqual, Values: []string{"red"}},
+		}},
+	})
+	l, err = alloc.Allocate(l)
+	assert.Nil(err)
+
+	for _, res := range l.Request[0].Resources {
+		assert.Equal("eng", res.GetLabels()["system.group"])
+	}
+
+	// The role is kept with the lease
+	data, err := json.Marshal(l)
+	assert.Nil(err)
+
+	leaseType := lease.LeaseType(store.DefaultFactory())
+	stored, ok := leaseType.New().(*lease.Lease)
+	assert.True(ok)
+	assert.Nil(json.Unmarshal(data, stored))
+	assert.False(stored.CanLease(getVLAN("leadership", "red")))
+}
+
+func TestRelease(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testrelease"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	rs := getStore(assert, root)
+	alloc := lease.NewAllocator(rs)
+	owner := getOwner()
+
+	l := lease.NewLease(owner, time.Hour, []*lease.ResourceReq{
+		{Type: "VLANPool", Group: "eng", Name: "all", Count: 3},
+	})
+
+	l, err := alloc.Allocate(l)
+	assert.Nil(err)
+	assert.Equal(3, countLeased(rs, owner.Email))
+
+	released, _, err := alloc.Release(l)
+	assert.Nil(err)
+	assert.Equal(zebra.Inactive, released.Status.State)
+	assert.Equal(zebra.Inactive, storedLease(assert, rs, l.ID).Status.State)
+	assert.True(l.IsValid())
+	assert.Equal(0, countLeased(rs, owner.Email))
+
+	// Released resources can be leased again
+	again := lease.NewLease(owner, time.Hour, []*lease.ResourceReq{
+		{Type: "VLANPool", Group: "eng", Name: "all again", Count: 3},
+	})
+	again, err = alloc.Allocate(again)
+	assert.Nil(err)
+
+	// Releasing the old lease again does not free the resources of the new
+	// lease of the same owner
+	_, _, err = alloc.Release(released)
+	assert.Equal(lease.ErrLeaseEnded, err)
+	assert.Equal(3, countLeased(rs, owner.Email))
+
+	for _, r := range again.Request[0].Resources {
+		assert.Equal(again.ID, r.GetStatus().LeaseID)
+	}
+
+	_, _, err = lease.NewAllocator(nil).Release(again)
+	assert.Equal(lease.ErrStoreMissing, err)
+}
+
+func TestReap(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testreap"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	rs := getStore(assert, root)
+	alloc := lease.NewAllocator(rs)
+	owner := getOwner()
+
+	short := lease.NewLease(owner, time.Millisecond, []*lease.ResourceReq{
+		{Type: "VLANPool", Group: "eng", Name: "short", Count: 2},
+	})
+	long := lease.NewLease(owner, time.Hour, []*lease.ResourceReq{
+		{Type: "VLANPool", Group: "leadership", Name: "long", Count: 1},
+	})
+
+	_, err := alloc.Allocate(short)
+	assert.Nil(err)
+
+	_, err = alloc.Allocate(long)
+	assert.Nil(err)
+	assert.Equal(3, countLeased(rs, owner.Email))
+
+	time.Sleep(10 * time.Millisecond)
+
+	released, _, err := alloc.Reap()
+	assert.Nil(err)
+	assert.Len(released, 1)
+	assert.Equal(short.ID, released[0].ID)
+	assert.Equal(zebra.Inactive, released[0].Status.State)
+	assert.Equal(zebra.Inactive, storedLease(assert, rs, short.ID).Status.State)
+	assert.True(storedLease(assert, rs, long.ID).IsValid())
+	assert.Equal(1, countLeased(rs, owner.Email))
+
+	// Nothing left to reap
+	released, _, err = alloc.Reap()
+	assert.Nil(err)
+	assert.Empty(released)
+
+	_, _, err = lease.NewAllocator(nil).Reap()
+	assert.Equal(lease.ErrStoreMissing, err)
+}
+
+func TestReleaseUsage(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testreleaseusage"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	rs := getStore(assert, root)
+	alloc := lease.NewAllocator(rs)
+	log := usage.NewLog(filepath.Join(root, "usage", "usage.log"))
+	assert.Nil(log.Initialize())
+	alloc.RecordUsage(log)
+
+	owner := getOwner()
+	l := lease.NewLease(owner, time.Millisecond, []*lease.ResourceReq{
+		{Type: "VLANPool", Group: "eng", Name: "red", Count: 2},
+	})
+
+	assert.Empty(l.Intervals(time.Now()))
+
+	active, err := alloc.Allocate(l)
+	assert.Nil(err)
+	assert.Len(active.Intervals(time.Now()), 2)
+
+	time.Sleep(10 * time.Millisecond)
+
+	released, _, err := alloc.Reap()
+	assert.Nil(err)
+	assert.Len(released, 1)
+	assert.Empty(storedLease(assert, rs, l.ID).Intervals(time.Now()))
+
+	// The intervals end when the lease expired, not when it was reaped
+	intervals, err := log.Query(time.Time{}, time.Now())
+	assert.Nil(err)
+	assert.Len(intervals, 2)
+
+	for _, i := range intervals {
+		assert.Equal(owner.Email, i.User)
+		assert.Equal("eng", i.Group)
+		assert.Equal("VLANPool", i.Type)
+		assert.Equal(l.ID, i.Lease)
+		assert.Equal(time.Millisecond, i.End.Sub(i.Start))
+	}
+}
+
+// Usage is recorded only for releases which are stored.
+func TestReleaseUsageConflict(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testreleaseusageconflict"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	rs := getStore(assert, root)
+	alloc := lease.NewAllocator(rs)
+	log := usage.NewLog(filepath.Join(root, "usage", "usage.log"))
+	assert.Nil(log.Initialize())
+	alloc.RecordUsage(log)
+
+	active, err := alloc.Allocate(lease.NewLease(getOwner(), time.Hour, getReq("eng", 2)))
+	assert.Nil(err)
+
+	// The lease is changed after it has been read, releasing it fails
+	copied, err := zebra.CopyResource(store.DefaultFactory(), active)
+	assert.Nil(err)
+	assert.Nil(rs.Create(copied))
+
+	_, _, err = alloc.Release(active)
+	assert.NotNil(err)
+
+	intervals, err := log.Query(time.Time{}, time.Now())
+	assert.Nil(err)
+	assert.Empty(intervals)
+
+	_, _, err = alloc.Release(storedLease(assert, rs, active.ID))
+	assert.Nil(err)
+
+	intervals, err = log.Query(time.Time{}, time.Now())
+	assert.Nil(err)
+	assert.Len(intervals, 2)
+}
@@ -2,12 +2,14 @@ package lease
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"sync"
 	"time"
 
 	"github.com/project-safari/zebra"
 	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/usage"
 )
 
 type ResourceReq struct {
@@ -22,14 +24,30 @@ type ResourceReq struct {
 type Lease struct {
 	zebra.BaseResource
 	lock           sync.RWMutex
+	factory        zebra.ResourceFactory
 	Duration       time.Duration  `json:"duration"`
 	Request        []*ResourceReq `json:"request"`
 	ActivationTime time.Time      `json:"activationTime"`
+	QueuedTime     time.Time      `json:"queuedTime"`
+	Priority       int            `json:"priority,omitempty"`
+	Role           *auth.Role     `json:"role,omitempty"`
+}
+
+// LeaseType returns the lease type. The resources assigned to the requests
+// of a lease can be of any type, so they are unpacked using the given factory.
+func LeaseType(factory zebra.ResourceFactory) zebra.Type {
+	return zebra.Type{
+		Name:        "Lease",
+		Description: "resource lease",
+		Constructor: func() zebra.Resource { return &Lease{factory: factory} },
+	}
 }
 
 var (
 	ErrLeaseActivate = errors.New("tried to activate lease but request has not been satisfied entirely")
 	ErrLeaseValid    = errors.New("lease is not valid")
+	ErrLeaseExtend   = errors.New("lease cannot be extended beyond max duration")
+	ErrLeaseFactory  = errors.New("lease resource factory is nil")
 )
 
 func (r *ResourceReq) Assign(res zebra.Resource) error {
@@ -51,17 +69,38 @@ func NewLease(owner auth.User, dur time.Duration, req []*ResourceReq) *Lease {
 	// Set default values, don't set activation time yet
 	l := &Lease{
 		lock:           sync.RWMutex{},
+		factory:        nil,
 		BaseResource:   *zebra.NewBaseResource("Lease", map[string]string{"system.group": "leases"}),
 		Duration:       dur,
 		Request:        req,
 		ActivationTime: time.Time{},
+		QueuedTime:     time.Time{},
+		Priority:       0,
+		Role:           nil,
 	}
 	l.Status.UsedBy = owner.Email
 	l.Status.State = zebra.Inactive
 
+	// Queued leases of owners with a higher role priority are served first,
+	// the owner role at request time decides which resources can be leased
+	if owner.Role != nil {
+		l.Priority = owner.Role.Priority
+		l.Role = owner.Role.Copy()
+	}
+
 	return l
 }
 
+// CanLease returns true if the lease owner is allowed to lease the resource,
+// which requires the update privilege on the resource type and group. Leases
+// of owners without a role are not restricted.
+func (l *Lease) CanLease(res zebra.Resource) bool {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	return l.Role == nil || l.Role.Update(auth.KeyOf(res))
+}
+
 // Returns email of user associated with lease.
 func (l *Lease) Owner() string {
 	l.lock.RLock()
@@ -70,6 +109,38 @@ func (l *Lease) Owner() string {
 	return l.Status.UsedBy
 }
 
+// Return status of lease.
+func (l *Lease) GetStatus() zebra.Status {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	return l.Status
+}
+
+// Set status of lease.
+func (l *Lease) SetStatus(status zebra.Status) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.Status = status
+}
+
+// Return resource version of lease.
+func (l *Lease) GetResourceVersion() uint64 {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	return l.ResourceVersion
+}
+
+// Set resource version of lease.
+func (l *Lease) SetResourceVersion(version uint64) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.ResourceVersion = version
+}
+
 // Activate lease.
 func (l *Lease) Activate() error {
 	// Check that lease has been satisfied and activate only then
@@ -82,6 +153,7 @@ func (l *Lease) Activate() error {
 	defer l.lock.Unlock()
 
 	l.ActivationTime = time.Now()
+	l.QueuedTime = time.Time{}
 	l.Status.State = zebra.Active
 
 	return nil
@@ -95,6 +167,49 @@ func (l *Lease) Deactivate() {
 	l.Status.State = zebra.Inactive
 }
 
+// Queue an inactive lease to wait for free resources.
+func (l *Lease) Queue() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.QueuedTime = time.Now()
+}
+
+// Remove lease from the queue.
+func (l *Lease) Dequeue() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.QueuedTime = time.Time{}
+}
+
+// Return if lease is waiting in the queue for free resources.
+func (l *Lease) IsQueued() bool {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	return !l.QueuedTime.IsZero() && l.Status.State == zebra.Inactive
+}
+
+// Extend an active lease by the given duration. The total lease duration can
+// not exceed zebra.DefaultMaxDuration hours.
+func (l *Lease) Extend(dur time.Duration) error {
+	if !l.IsValid() || dur <= 0 {
+		return ErrLeaseValid
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if (l.Duration + dur).Hours() > zebra.DefaultMaxDuration {
+		return ErrLeaseExtend
+	}
+
+	l.Duration += dur
+
+	return nil
+}
+
 func (l *Lease) IsSatisfied() bool {
 	l.lock.RLock()
 	defer l.lock.RUnlock()
@@ -124,6 +239,40 @@ func (l *Lease) IsExpired() bool {
 	return time.Now().After(l.ActivationTime.Add(l.Duration)) || l.Status.State == zebra.Inactive
 }
 
+// Intervals returns the usage intervals of the resources assigned to the
+// lease, from the lease activation until end or the lease expiry, whichever
+// comes first. An inactive lease has no intervals.
+func (l *Lease) Intervals(end time.Time) []*usage.Interval {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	intervals := []*usage.Interval{}
+
+	if l.Status.State != zebra.Active || l.ActivationTime.IsZero() {
+		return intervals
+	}
+
+	if expiry := l.ActivationTime.Add(l.Duration); expiry.Before(end) {
+		end = expiry
+	}
+
+	for _, r := range l.Request {
+		for _, res := range r.Resources {
+			intervals = append(intervals, &usage.Interval{
+				Resource: res.GetID(),
+				Type:     res.GetType(),
+				Group:    res.GetLabels()["system.group"],
+				User:     l.Status.UsedBy,
+				Lease:    l.ID,
+				Start:    l.ActivationTime,
+				End:      end,
+			})
+		}
+	}
+
+	return intervals
+}
+
 func (l *Lease) RequestList() []*ResourceReq {
 	l.lock.RLock()
 	defer l.lock.RUnlock()
@@ -146,3 +295,61 @@ func (l *Lease) Validate(ctx context.Context) error {
 
 	return l.BaseResource.Validate(ctx)
 }
+
+// UnmarshalJSON unpacks the lease, the resources assigned to each request are
+// unpacked into their actual types using the lease resource factory.
+func (l *Lease) UnmarshalJSON(data []byte) error {
+	type leaseAlias Lease
+
+	value := &struct {
+		*leaseAlias
+		Request []*struct {
+			Type      string          `json:"type"`
+			Group     string          `json:"group"`
+			Name      string          `json:"name"`
+			Count     int             `json:"count"`
+			Filters   []zebra.Query   `json:"filters,omitempty"`
+			Resources json.RawMessage `json:"resources,omitempty"`
+		} `json:"request"`
+	}{leaseAlias: (*leaseAlias)(l)}
+
+	if err := json.Unmarshal(data, value); err != nil {
+		return err
+	}
+
+	if value.Request == nil {
+		l.Request = nil
+
+		return nil
+	}
+
+	l.Request = make([]*ResourceReq, 0, len(value.Request))
+
+	for _, r := range value.Request {
+		req := &ResourceReq{
+			Type:      r.Type,
+			Group:     r.Group,
+			Name:      r.Name,
+			Count:     r.Count,
+			Filters:   r.Filters,
+			Resources: nil,
+		}
+
+		if len(r.Resources) != 0 && string(r.Resources) != "null" {
+			if l.factory == nil {
+				return ErrLeaseFactory
+			}
+
+			resList := zebra.NewResourceList(l.factory)
+			if err := json.Unmarshal(r.Resources, resList); err != nil {
+				return err
+			}
+
+			req.Resources = resList.Resources
+		}
+
+		l.Request = append(l.Request, req)
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package lease //nolint:testpackage
 
 import (
 	"context"
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -50,6 +51,22 @@ func TestDeactivate(t *testing.T) {
 	assert.Equal(zebra.Inactive, l.Status.State)
 }
 
+func TestStatus(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	l := getEmptyLease()
+	assert.NotNil(l)
+
+	status := l.GetStatus()
+	assert.Equal(zebra.Inactive, status.State)
+	assert.Equal("shravya@cisco.com", status.UsedBy)
+
+	status.State = zebra.Active
+	l.SetStatus(status)
+	assert.Equal(zebra.Active, l.GetStatus().State)
+}
+
 func TestBadResources(t *testing.T) {
 	t.Parallel()
 	assert := assert.New(t)
@@ -178,3 +195,60 @@ func getUser() auth.User {
 		Role:         nil,
 	}
 }
+
+func TestExtend(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	l := NewLease(getUser(), time.Hour, make([]*ResourceReq, 0))
+
+	// Inactive lease cannot be extended
+	assert.Equal(ErrLeaseValid, l.Extend(time.Hour))
+
+	assert.Nil(l.Activate())
+	assert.Equal(ErrLeaseValid, l.Extend(0))
+	assert.Nil(l.Extend(2 * time.Hour))
+	assert.Equal(3*time.Hour, l.Duration)
+
+	assert.Equal(ErrLeaseExtend, l.Extend(2*time.Hour))
+	assert.Equal(3*time.Hour, l.Duration)
+}
+
+func TestLeaseJSON(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	factory := zebra.Factory()
+	factory.Add(network.VLANPoolType())
+	factory.Add(LeaseType(factory))
+
+	l := getLease()
+	l.Request[0].Filters = []zebra.Query{{Key: "color", Op: zebra.MatchEqual, Values: []string{"red"}}}
+	assert.Nil(l.Request[0].Assign(getRes()))
+
+	data, err := json.Marshal(l)
+	assert.Nil(err)
+
+	res := factory.New("Lease")
+	assert.Nil(json.Unmarshal(data, res))
+
+	loaded, ok := res.(*Lease)
+	assert.True(ok)
+	assert.Equal(l.ID, loaded.ID)
+	assert.Equal(l.Duration, loaded.Duration)
+	assert.Equal(l.Owner(), loaded.Owner())
+	assert.Len(loaded.Request, 2)
+	assert.Equal(l.Request[0].Filters, loaded.Request[0].Filters)
+	assert.Empty(loaded.Request[1].Resources)
+
+	vlan, ok := loaded.Request[0].Resources[0].(*network.VLANPool)
+	assert.True(ok)
+	assert.Equal(l.Request[0].Resources[0].GetID(), vlan.ID)
+
+	// Assigned resources can not be unpacked without a factory
+	assert.Equal(ErrLeaseFactory, json.Unmarshal(data, new(Lease)))
+
+	// Unknown resource types can not be unpacked
+	leaseType := LeaseType(zebra.Factory())
+	assert.NotNil(json.Unmarshal(data, leaseType.New()))
+}
@@ -0,0 +1,183 @@
+package lease
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+var ErrNoCapacity = errors.New("not enough resources in inventory to ever satisfy lease request")
+
+// Request allocates resources for the lease. If there are not enough free
+// resources right now, the lease is stored in the queue and allocated as soon
+// as other leases free their resources. The given lease is not changed, the
+// lease as stored is returned, it is valid if it is active and queued
+// otherwise, along with the other queued leases which have been activated.
+// Requests which can never be satisfied, because there are not enough matching
+// resources in the inventory, are rejected.
+func (a *Allocator) Request(l *Lease) (*Lease, []*Lease, error) {
+	if a.store == nil {
+		return nil, nil, ErrStoreMissing
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if l.IsValid() {
+		return nil, nil, ErrLeaseActive
+	}
+
+	if err := a.capacity(l); err != nil {
+		return nil, nil, err
+	}
+
+	next, err := a.copyLease(l)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	next.Queue()
+
+	if err := a.store.Create(next); err != nil {
+		return nil, nil, err
+	}
+
+	// Queued leases that came first are served first, this lease may or may
+	// not be activated
+	activated, err := a.schedule()
+	others := make([]*Lease, 0, len(activated))
+
+	for _, act := range activated {
+		if act.ID == next.ID {
+			next = act
+		} else {
+			others = append(others, act)
+		}
+	}
+
+	return next, others, err
+}
+
+// Queue returns all queued leases in the order in which they are served.
+func (a *Allocator) Queue() []*Lease {
+	if a.store == nil {
+		return []*Lease{}
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return a.queued()
+}
+
+// capacity checks that the inventory has enough resources the lease owner can
+// lease to satisfy all the lease requests, whether they are free or not.
+func (a *Allocator) capacity(l *Lease) error {
+	picked := make(map[string]struct{})
+
+	for _, req := range l.RequestList() {
+		if err := validateFilters(req.Filters); err != nil {
+			return err
+		}
+
+		candidates := a.candidates(l, req, picked, false)
+		if len(candidates) < req.Count {
+			return ErrNoCapacity
+		}
+
+		for _, res := range candidates[:req.Count] {
+			picked[res.GetID()] = struct{}{}
+		}
+	}
+
+	return nil
+}
+
+// schedule allocates free resources to the queued leases and returns the
+// leases it activated. Leases are served in FIFO order per requested group,
+// leases of owners with a higher role priority go first. A lease that cannot
+// be satisfied blocks all the leases queued after it for the same groups, so
+// that small requests can not starve the larger ones. This function must never
+// be called without holding the allocator lock.
+func (a *Allocator) schedule() ([]*Lease, error) {
+	var errs error
+
+	activated := make([]*Lease, 0)
+	blocked := make(map[string]struct{})
+
+	for _, l := range a.queued() {
+		groups := l.groups()
+
+		if isBlocked(blocked, groups) {
+			continue
+		}
+
+		active, err := a.allocate(l)
+		if err == nil {
+			activated = append(activated, active)
+
+			continue
+		}
+
+		if !errors.Is(err, ErrNoResources) {
+			errs = multierror.Append(errs, err)
+		}
+
+		for _, g := range groups {
+			blocked[g] = struct{}{}
+		}
+	}
+
+	return activated, errs
+}
+
+// queued returns all stored queued leases sorted by priority and then by the
+// time they were queued.
+func (a *Allocator) queued() []*Lease {
+	leases := make([]*Lease, 0)
+
+	for _, list := range a.store.QueryType([]string{"Lease"}).Resources {
+		for _, res := range list.Resources {
+			if l, ok := res.(*Lease); ok && l.IsQueued() {
+				leases = append(leases, l)
+			}
+		}
+	}
+
+	sort.SliceStable(leases, func(i, j int) bool {
+		if leases[i].Priority != leases[j].Priority {
+			return leases[i].Priority > leases[j].Priority
+		}
+
+		if !leases[i].QueuedTime.Equal(leases[j].QueuedTime) {
+			return leases[i].QueuedTime.Before(leases[j].QueuedTime)
+		}
+
+		return leases[i].ID < leases[j].ID
+	})
+
+	return leases
+}
+
+// groups returns the system.group of each lease request.
+func (l *Lease) groups() []string {
+	groups := make([]string, 0)
+
+	for _, req := range l.RequestList() {
+		groups = append(groups, req.Group)
+	}
+
+	return groups
+}
+
+// Return if any of the groups is blocked.
+func isBlocked(blocked map[string]struct{}, groups []string) bool {
+	for _, g := range groups {
+		if _, ok := blocked[g]; ok {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,225 @@
+package lease_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/lease"
+	"github.com/project-safari/zebra/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func getReq(group string, count int) []*lease.ResourceReq {
+	return []*lease.ResourceReq{{Type: "VLANPool", Group: group, Name: "vlans", Count: count}}
+}
+
+// queueIDs returns the ids of the queued leases in the order they are served.
+func queueIDs(alloc *lease.Allocator) []string {
+	ids := []string{}
+
+	for _, l := range alloc.Queue() {
+		ids = append(ids, l.ID)
+	}
+
+	return ids
+}
+
+func TestRequest(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testrequest"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	rs := getStore(assert, root)
+	alloc := lease.NewAllocator(rs)
+	owner := getOwner()
+
+	// More than the inventory has
+	requested, _, err := alloc.Request(lease.NewLease(owner, time.Hour, getReq("eng", 4)))
+	assert.Equal(lease.ErrNoCapacity, err)
+	assert.Nil(requested)
+	assert.Empty(alloc.Queue())
+
+	first, _, err := alloc.Request(lease.NewLease(owner, time.Hour, getReq("eng", 2)))
+	assert.Nil(err)
+	assert.True(first.IsValid())
+	assert.False(first.IsQueued())
+
+	_, _, err = alloc.Request(first)
+	assert.Equal(lease.ErrLeaseActive, err)
+
+	// Only one eng resource is left
+	second, _, err := alloc.Request(lease.NewLease(owner, time.Hour, getReq("eng", 2)))
+	assert.Nil(err)
+	assert.False(second.IsValid())
+	assert.True(second.IsQueued())
+
+	// Would fit, but must wait for the second lease in the same group
+	third, _, err := alloc.Request(lease.NewLease(owner, time.Hour, getReq("eng", 1)))
+	assert.Nil(err)
+	assert.False(third.IsValid())
+
+	// Other groups are not blocked
+	other, _, err := alloc.Request(lease.NewLease(owner, time.Hour, getReq("leadership", 1)))
+	assert.Nil(err)
+	assert.True(other.IsValid())
+
+	assert.Equal([]string{second.ID, third.ID}, queueIDs(alloc))
+
+	// Freed resources feed the queue in order
+	_, activated, err := alloc.Release(first)
+	assert.Nil(err)
+	assert.Len(activated, 2)
+	assert.Equal(second.ID, activated[0].ID)
+	assert.Equal(third.ID, activated[1].ID)
+	assert.True(storedLease(assert, rs, second.ID).IsValid())
+	assert.True(storedLease(assert, rs, third.ID).IsValid())
+	assert.Empty(alloc.Queue())
+	assert.Equal(4, countLeased(rs, owner.Email))
+
+	_, _, err = lease.NewAllocator(nil).Request(first)
+	assert.Equal(lease.ErrStoreMissing, err)
+	assert.Empty(lease.NewAllocator(nil).Queue())
+}
+
+// The lease returned is the lease as stored, whether the store backend hands
+// out the stored resources or copies of them.
+func TestRequestBackends(t *testing.T) {
+	t.Parallel()
+
+	for _, backend := range []string{store.FileBackend, store.DBBackend} {
+		backend := backend
+
+		t.Run(backend, func(t *testing.T) {
+			t.Parallel()
+			assert := assert.New(t)
+
+			root := "testrequest" + backend
+
+			t.Cleanup(func() { os.RemoveAll(root) })
+
+			s, err := store.NewBackend(backend, root, store.DefaultFactory())
+			assert.Nil(err)
+			assert.Nil(s.Initialize())
+
+			for _, group := range []string{"eng", "eng", "leadership"} {
+				assert.Nil(s.Create(getVLAN(group, "red")))
+			}
+
+			alloc := lease.NewAllocator(s)
+			owner := getOwner()
+			stored := func(l *lease.Lease) zebra.Status {
+				return s.QueryUUID([]string{l.ID}).Resources["Lease"].Resources[0].GetStatus()
+			}
+
+			first, _, err := alloc.Request(lease.NewLease(owner, time.Hour, getReq("eng", 2)))
+			assert.Nil(err)
+			assert.Equal(zebra.Active, first.GetStatus().State)
+			assert.Equal(zebra.Active, stored(first).State)
+
+			second, _, err := alloc.Request(lease.NewLease(owner, time.Hour, getReq("eng", 1)))
+			assert.Nil(err)
+			assert.True(second.IsQueued())
+			assert.Equal(zebra.Inactive, stored(second).State)
+
+			released, _, err := alloc.Release(first)
+			assert.Nil(err)
+			assert.Equal(zebra.Inactive, released.GetStatus().State)
+			assert.Equal(zebra.Inactive, stored(first).State)
+			assert.Equal(zebra.Active, stored(second).State)
+			assert.Equal(1, countLeased(s, owner.Email))
+		})
+	}
+}
+
+func TestRequestPriority(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testrequestpriority"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	rs := getStore(assert, root)
+	alloc := lease.NewAllocator(rs)
+	owner := getOwner()
+
+	boss := getOwner()
+	boss.Email = "boss@zebra.project-safari.io"
+	priv, err := auth.NewPriv("VLANPool/.*", false, true, true, false)
+	assert.Nil(err)
+
+	boss.Role = &auth.Role{Name: "boss", Privileges: []*auth.Priv{priv}, Priority: 10}
+
+	first, _, err := alloc.Request(lease.NewLease(owner, time.Hour, getReq("eng", 3)))
+	assert.Nil(err)
+	assert.True(first.IsValid())
+
+	waiting, _, err := alloc.Request(lease.NewLease(owner, time.Hour, getReq("eng", 3)))
+	assert.Nil(err)
+	assert.False(waiting.IsValid())
+
+	urgent, _, err := alloc.Request(lease.NewLease(boss, time.Hour, getReq("eng", 3)))
+	assert.Nil(err)
+	assert.Equal(10, urgent.Priority)
+	assert.False(urgent.IsValid())
+
+	assert.Equal([]string{urgent.ID, waiting.ID}, queueIDs(alloc))
+
+	_, activated, err := alloc.Release(first)
+	assert.Nil(err)
+	assert.Len(activated, 1)
+	assert.Equal(urgent.ID, activated[0].ID)
+	assert.True(storedLease(assert, rs, urgent.ID).IsValid())
+	assert.True(storedLease(assert, rs, waiting.ID).IsQueued())
+
+	// Releasing a queued lease removes it from the queue
+	released, _, err := alloc.Release(waiting)
+	assert.Nil(err)
+	assert.False(released.IsQueued())
+	assert.Empty(alloc.Queue())
+}
+
+func TestQueueRestart(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testqueuerestart"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	rs := getStore(assert, root)
+	owner := getOwner()
+
+	first, _, err := lease.NewAllocator(rs).Request(lease.NewLease(owner, time.Millisecond*50, getReq("eng", 3)))
+	assert.Nil(err)
+	assert.True(first.IsValid())
+
+	waiting, _, err := lease.NewAllocator(rs).Request(lease.NewLease(owner, time.Hour, getReq("eng", 1)))
+	assert.Nil(err)
+	assert.False(waiting.IsValid())
+
+	// Restart the store, the queue is kept
+	rs = store.NewResourceStore(root, store.DefaultFactory())
+	assert.Nil(rs.Initialize())
+
+	alloc := lease.NewAllocator(rs)
+	assert.Equal([]string{waiting.ID}, queueIDs(alloc))
+
+	// Expired lease feeds the queue
+	time.Sleep(time.Millisecond * 100)
+
+	released, activated, err := alloc.Reap()
+	assert.Nil(err)
+	assert.Len(released, 1)
+	assert.Len(activated, 1)
+	assert.Equal(waiting.ID, activated[0].ID)
+	assert.Empty(alloc.Queue())
+	assert.Equal(zebra.Active, storedLease(assert, rs, waiting.ID).GetStatus().State)
+	assert.Equal(1, countLeased(rs, owner.Email))
+}
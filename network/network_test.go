@@ -45,10 +45,11 @@ func TestSwitch(t *testing.T) {
 	switch1.Credentials = zebra.Credentials{
 		NamedResource: zebra.NamedResource{
 			BaseResource: zebra.BaseResource{
-				ID:     "blahblah",
-				Type:   "Credentials",
-				Labels: nil,
-				Status: zebra.DefaultStatus(),
+				ID:              "blahblah",
+				Type:            "Credentials",
+				Labels:          nil,
+				Status:          zebra.DefaultStatus(),
+				ResourceVersion: 0,
 			},
 			Name: "blah",
 		},
@@ -0,0 +1,231 @@
+package propertystore
+
+import (
+	"net"
+	"strings"
+
+	"github.com/project-safari/zebra"
+)
+
+// Index declares an index of a property of the resources of a type, or of
+// the resources of all types if the type is empty. Property names are case
+// insensitive and nested properties are separated by dots, e.g. "Status.Lease".
+type Index struct {
+	Type     string
+	Property string
+}
+
+// ValueFunc returns the value of the resource property as a string, false if
+// the resource does not have the property.
+type ValueFunc func(res zebra.Resource, property string) (string, bool)
+
+// entry is an indexed value of a resource.
+type entry struct {
+	index Index
+	value string
+}
+
+type PropertyStore struct {
+	factory zebra.ResourceFactory
+	value   ValueFunc
+	indexes map[Index]map[string]map[string]zebra.Resource
+	entries map[string][]entry
+}
+
+// Return new property store pointer given the declared indexes, the function
+// returning property values and resource map.
+func NewPropertyStore(indexes []Index, value ValueFunc, resources *zebra.ResourceMap) *PropertyStore {
+	ps := &PropertyStore{
+		factory: resources.GetFactory(),
+		value:   value,
+		indexes: make(map[Index]map[string]map[string]zebra.Resource),
+		entries: make(map[string][]entry),
+	}
+
+	for _, idx := range indexes {
+		ps.indexes[normalize(idx)] = make(map[string]map[string]zebra.Resource)
+	}
+
+	for _, l := range resources.Resources {
+		for _, res := range l.Resources {
+			_ = ps.Create(res)
+		}
+	}
+
+	return ps
+}
+
+func (ps *PropertyStore) Initialize() error {
+	return nil
+}
+
+func (ps *PropertyStore) Wipe() error {
+	ps.indexes = nil
+	ps.entries = nil
+
+	return nil
+}
+
+func (ps *PropertyStore) Clear() error {
+	for idx := range ps.indexes {
+		ps.indexes[idx] = make(map[string]map[string]zebra.Resource)
+	}
+
+	ps.entries = make(map[string][]entry)
+
+	return nil
+}
+
+// Return all indexed resources in a ResourceMap where keys are property = value.
+func (ps *PropertyStore) Load() (*zebra.ResourceMap, error) {
+	retMap := zebra.NewResourceMap(ps.factory)
+
+	for idx, values := range ps.indexes {
+		for val, resources := range values {
+			for _, res := range resources {
+				retMap.Add(res, idx.Property+" = "+val)
+			}
+		}
+	}
+
+	return retMap, nil
+}
+
+// Create a resource. If a resource with this ID already exists, update.
+func (ps *PropertyStore) Create(res zebra.Resource) error {
+	// The values indexed before are removed, even if the resource changed since
+	if err := ps.Delete(res); err != nil {
+		return err
+	}
+
+	id := res.GetID()
+
+	for idx, values := range ps.indexes {
+		if idx.Type != "" && idx.Type != res.GetType() {
+			continue
+		}
+
+		val, ok := ps.value(res, idx.Property)
+		if !ok {
+			continue
+		}
+
+		if values[val] == nil {
+			values[val] = make(map[string]zebra.Resource)
+		}
+
+		values[val][id] = res
+		ps.entries[id] = append(ps.entries[id], entry{index: idx, value: val})
+	}
+
+	return nil
+}
+
+// Delete a resource.
+func (ps *PropertyStore) Delete(res zebra.Resource) error {
+	id := res.GetID()
+
+	for _, e := range ps.entries[id] {
+		values := ps.indexes[e.index]
+
+		delete(values[e.value], id)
+
+		if len(values[e.value]) == 0 {
+			delete(values, e.value)
+		}
+	}
+
+	delete(ps.entries, id)
+
+	return nil
+}
+
+// Query returns the resources whose property matches the query, among the
+// resources of the types the property is indexed for. The indexed types are
+// returned too, nil if the property is indexed for all types. Returns false
+// if the property is not indexed, or if the query also matches resources
+// without the property, the resources must then be matched one by one.
+func (ps *PropertyStore) Query(query zebra.Query) (*zebra.ResourceMap, []string, bool) {
+	results := zebra.NewResourceMap(ps.factory)
+	property := strings.ToLower(query.Key)
+
+	if query.Match("", false) {
+		return results, nil, false
+	}
+
+	if values, ok := ps.indexes[Index{Type: "", Property: property}]; ok {
+		ps.match(results, values, query)
+
+		return results, nil, true
+	}
+
+	types := []string{}
+
+	for idx, values := range ps.indexes {
+		if idx.Property == property {
+			types = append(types, idx.Type)
+			ps.match(results, values, query)
+		}
+	}
+
+	return results, types, len(types) != 0
+}
+
+// Add the indexed resources whose value matches the query to results.
+// Equality is looked up, unless values are IPs, which match other forms of
+// the IP or CIDRs.
+func (ps *PropertyStore) match(results *zebra.ResourceMap, values map[string]map[string]zebra.Resource,
+	query zebra.Query,
+) {
+	add := func(resources map[string]zebra.Resource) {
+		for _, res := range resources {
+			results.Add(res, res.GetType())
+		}
+	}
+
+	if (query.Op == zebra.MatchEqual || query.Op == zebra.MatchIn) && !hasIP(query.Values) {
+		for _, val := range uniq(query.Values) {
+			add(values[val])
+		}
+
+		return
+	}
+
+	for val, resources := range values {
+		if query.Match(val, true) {
+			add(resources)
+		}
+	}
+}
+
+func normalize(idx Index) Index {
+	return Index{Type: idx.Type, Property: strings.ToLower(idx.Property)}
+}
+
+func hasIP(values []string) bool {
+	for _, val := range values {
+		if net.ParseIP(val) != nil {
+			return true
+		}
+
+		if _, _, err := net.ParseCIDR(val); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func uniq(values []string) []string {
+	seen := make(map[string]struct{}, len(values))
+	ret := make([]string, 0, len(values))
+
+	for _, val := range values {
+		if _, ok := seen[val]; !ok {
+			seen[val] = struct{}{}
+			ret = append(ret, val)
+		}
+	}
+
+	return ret
+}
@@ -0,0 +1,148 @@
+package propertystore_test
+
+import (
+	"net"
+	"sort"
+	"testing"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/compute"
+	"github.com/project-safari/zebra/network"
+	"github.com/project-safari/zebra/propertystore"
+	"github.com/project-safari/zebra/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func indexes() []propertystore.Index {
+	return []propertystore.Index{
+		{Type: "", Property: "status.lease"},
+		{Type: "Server", Property: "Model"},
+		{Type: "Switch", Property: "ManagementIP"},
+	}
+}
+
+func getServer(model string) *compute.Server {
+	return compute.NewServer([]string{"serial", model, "server"}, net.ParseIP("10.0.0.1"), nil)
+}
+
+func getSwitch(ip string) *network.Switch {
+	return &network.Switch{
+		BaseResource: *zebra.NewBaseResource("Switch", nil),
+		Credentials:  zebra.Credentials{},
+		ManagementIP: net.ParseIP(ip),
+		SerialNumber: "serial",
+		Model:        "model",
+		NumPorts:     1,
+	}
+}
+
+func ids(resMap *zebra.ResourceMap) []string {
+	ret := []string{}
+
+	for _, l := range resMap.Resources {
+		for _, res := range l.Resources {
+			ret = append(ret, res.GetID())
+		}
+	}
+
+	sort.Strings(ret)
+
+	return ret
+}
+
+func sorted(values ...string) []string {
+	sort.Strings(values)
+
+	return values
+}
+
+func TestNewPropertyStore(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	server := getServer("m1")
+	resMap := zebra.NewResourceMap(nil)
+	resMap.Add(server, "Server")
+
+	ps := propertystore.NewPropertyStore(indexes(), store.PropertyValue, resMap)
+	assert.NotNil(ps)
+	assert.Nil(ps.Initialize())
+
+	results, types, ok := ps.Query(zebra.Query{Key: "Model", Op: zebra.MatchEqual, Values: []string{"m1"}})
+	assert.True(ok)
+	assert.Equal([]string{"Server"}, types)
+	assert.Equal([]string{server.ID}, ids(results))
+
+	loaded, err := ps.Load()
+	assert.Nil(err)
+	assert.Len(loaded.Resources, 2)
+
+	assert.Nil(ps.Clear())
+
+	results, _, ok = ps.Query(zebra.Query{Key: "Model", Op: zebra.MatchEqual, Values: []string{"m1"}})
+	assert.True(ok)
+	assert.Empty(results.Resources)
+	assert.Nil(ps.Wipe())
+}
+
+func TestQuery(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	ps := propertystore.NewPropertyStore(indexes(), store.PropertyValue, zebra.NewResourceMap(nil))
+
+	s1, s2, s3 := getServer("m1"), getServer("m2"), getServer("m1")
+	sw1, sw2 := getSwitch("10.1.0.1"), getSwitch("10.2.0.1")
+
+	for _, res := range []zebra.Resource{s1, s2, s3, sw1, sw2} {
+		assert.Nil(ps.Create(res))
+	}
+
+	// Indexed for all types
+	results, types, ok := ps.Query(zebra.Query{Key: "Status.Lease", Op: zebra.MatchEqual, Values: []string{"free"}})
+	assert.True(ok)
+	assert.Nil(types)
+	assert.Len(ids(results), 5)
+
+	// Indexed for some types
+	results, types, ok = ps.Query(zebra.Query{Key: "model", Op: zebra.MatchIn, Values: []string{"m1", "m1"}})
+	assert.True(ok)
+	assert.Equal([]string{"Server"}, types)
+	assert.Equal(sorted(s1.ID, s3.ID), ids(results))
+
+	results, _, ok = ps.Query(zebra.Query{Key: "Model", Op: zebra.MatchPrefix, Values: []string{"m"}})
+	assert.True(ok)
+	assert.Len(ids(results), 3)
+
+	results, _, ok = ps.Query(zebra.Query{Key: "ManagementIP", Op: zebra.MatchEqual, Values: []string{"10.1.0.0/16"}})
+	assert.True(ok)
+	assert.Equal([]string{sw1.ID}, ids(results))
+
+	// Not indexed, or matching resources without the property
+	_, _, ok = ps.Query(zebra.Query{Key: "SerialNumber", Op: zebra.MatchEqual, Values: []string{"serial"}})
+	assert.False(ok)
+
+	_, _, ok = ps.Query(zebra.Query{Key: "Model", Op: zebra.MatchNotEqual, Values: []string{"m1"}})
+	assert.False(ok)
+
+	// Updates replace the indexed values, even if the resource was changed in
+	// place
+	s1.Model = "m3"
+	s1.Status.Lease = zebra.Leased
+	assert.Nil(ps.Create(s1))
+
+	results, _, _ = ps.Query(zebra.Query{Key: "Model", Op: zebra.MatchEqual, Values: []string{"m1"}})
+	assert.Equal([]string{s3.ID}, ids(results))
+
+	results, _, _ = ps.Query(zebra.Query{Key: "Status.Lease", Op: zebra.MatchEqual, Values: []string{"leased"}})
+	assert.Equal([]string{s1.ID}, ids(results))
+
+	assert.Nil(ps.Delete(s1))
+	assert.Nil(ps.Delete(s1))
+
+	results, _, _ = ps.Query(zebra.Query{Key: "Model", Op: zebra.MatchExists, Values: nil})
+	assert.Equal(sorted(s2.ID, s3.ID), ids(results))
+
+	results, _, _ = ps.Query(zebra.Query{Key: "Status.Lease", Op: zebra.MatchEqual, Values: []string{"leased"}})
+	assert.Empty(results.Resources)
+}
@@ -0,0 +1,420 @@
+// Package query implements the zebra resource query language. A query is a
+// boolean expression of comparisons on resource labels and properties, e.g.
+//
+//	type in (Server,ESX) and label.color == red and
+//	    (status.lease == free or model =~ "^modelA")
+//
+// Comparisons are written as "key op value". Keys prefixed with "label." refer
+// to resource labels, all other keys refer to (nested) resource properties.
+// Supported operators are ==, !=, in, notin, exists, prefix, =~ (regex), <
+// and >. Expressions are combined with and, or and not, and grouped with
+// parentheses. Values containing spaces or special characters must be quoted.
+package query
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/store"
+)
+
+const LabelPrefix = store.LabelPrefix
+
+var ErrSyntax = errors.New("query syntax error")
+
+// Expr is a parsed query expression.
+type Expr interface {
+	Match(res zebra.Resource) bool
+	String() string
+}
+
+// Term compares a single resource label or property.
+type Term struct {
+	Label bool
+	zebra.Query
+}
+
+type (
+	andExpr struct{ left, right Expr }
+	orExpr  struct{ left, right Expr }
+	notExpr struct{ expr Expr }
+)
+
+func (t *Term) Match(res zebra.Resource) bool {
+	if t.Label {
+		val, ok := res.GetLabels()[t.Key]
+
+		return t.Query.Match(val, ok)
+	}
+
+	return store.MatchProperty(t.Query, res)
+}
+
+func (t *Term) String() string {
+	key := t.Key
+	if t.Label {
+		key = LabelPrefix + key
+	}
+
+	op, _ := t.Op.MarshalText()
+
+	values := make([]string, 0, len(t.Values))
+	for _, v := range t.Values {
+		values = append(values, strconv.Quote(v))
+	}
+
+	switch t.Op {
+	case zebra.MatchExists:
+		return key + " exists"
+	case zebra.MatchIn, zebra.MatchNotIn:
+		return fmt.Sprintf("%s %s (%s)", key, op, strings.Join(values, ","))
+	default:
+		return fmt.Sprintf("%s %s %s", key, op, strings.Join(values, ","))
+	}
+}
+
+func (e *andExpr) Match(res zebra.Resource) bool {
+	return e.left.Match(res) && e.right.Match(res)
+}
+
+func (e *andExpr) String() string {
+	return fmt.Sprintf("(%s and %s)", e.left, e.right)
+}
+
+func (e *orExpr) Match(res zebra.Resource) bool {
+	return e.left.Match(res) || e.right.Match(res)
+}
+
+func (e *orExpr) String() string {
+	return fmt.Sprintf("(%s or %s)", e.left, e.right)
+}
+
+func (e *notExpr) Match(res zebra.Resource) bool {
+	return !e.expr.Match(res)
+}
+
+func (e *notExpr) String() string {
+	return fmt.Sprintf("not %s", e.expr)
+}
+
+// Filter returns the resources in the resource map that match the expression.
+func Filter(expr Expr, resMap *zebra.ResourceMap) *zebra.ResourceMap {
+	retMap := zebra.NewResourceMap(resMap.GetFactory())
+
+	for t, l := range resMap.Resources {
+		for _, res := range l.Resources {
+			if expr.Match(res) {
+				retMap.Add(res, t)
+			}
+		}
+	}
+
+	return retMap
+}
+
+// Parse parses the query string into an expression.
+func Parse(q string) (Expr, error) {
+	tokens, err := lex(q)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, pos: 0}
+
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf(tok, "unexpected %q", tok.text)
+	}
+
+	return expr, nil
+}
+
+type tokenKind uint8
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// lex splits the query string into tokens.
+func lex(q string) ([]token, error) {
+	tokens := []token{}
+	runes := []rune(q)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")", pos: i})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{kind: tokComma, text: ",", pos: i})
+			i++
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				if runes[end] == '\\' {
+					end++
+				}
+				end++
+			}
+
+			if end >= len(runes) {
+				return nil, fmt.Errorf("%w: unterminated string at %d", ErrSyntax, i)
+			}
+
+			text, err := strconv.Unquote(string(runes[i : end+1]))
+			if err != nil {
+				return nil, fmt.Errorf("%w: bad string at %d", ErrSyntax, i)
+			}
+
+			tokens = append(tokens, token{kind: tokString, text: text, pos: i})
+			i = end + 1
+		case strings.ContainsRune("=!<>", r):
+			op := string(r)
+			if i+1 < len(runes) && strings.ContainsRune("=~", runes[i+1]) {
+				op += string(runes[i+1])
+			}
+
+			if op != "==" && op != "!=" && op != "=~" && op != "<" && op != ">" {
+				return nil, fmt.Errorf("%w: unknown operator %q at %d", ErrSyntax, op, i)
+			}
+
+			tokens = append(tokens, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		default:
+			end := i
+			for end < len(runes) && isWordRune(runes[end]) {
+				end++
+			}
+
+			tokens = append(tokens, token{kind: tokWord, text: string(runes[i:end]), pos: i})
+			i = end
+		}
+	}
+
+	return append(tokens, token{kind: tokEOF, text: "end of query", pos: len(runes)}), nil
+}
+
+func isWordRune(r rune) bool {
+	return !unicode.IsSpace(r) && !strings.ContainsRune(`(),"=!<>`, r)
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+
+	return tok
+}
+
+// keyword returns true and consumes the next token if it is the keyword.
+func (p *parser) keyword(word string) bool {
+	if tok := p.peek(); tok.kind == tokWord && strings.EqualFold(tok.text, word) {
+		p.pos++
+
+		return true
+	}
+
+	return false
+}
+
+func (p *parser) errorf(tok token, format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s at %d", ErrSyntax, fmt.Sprintf(format, args...), tok.pos)
+}
+
+// or := and { "or" and }.
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &orExpr{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+// and := unary { "and" unary }.
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("and") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &andExpr{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+// unary := "not" unary | "(" or ")" | term.
+func (p *parser) parseUnary() (Expr, error) {
+	if p.keyword("not") {
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		return &notExpr{expr: expr}, nil
+	}
+
+	if p.peek().kind != tokLParen {
+		return p.parseTerm()
+	}
+
+	p.next()
+
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.next(); tok.kind != tokRParen {
+		return nil, p.errorf(tok, "expected \")\", found %q", tok.text)
+	}
+
+	return expr, nil
+}
+
+// term := key ( "exists" | op value | ( "in" | "notin" ) list ).
+func (p *parser) parseTerm() (Expr, error) {
+	tok := p.next()
+	if tok.kind != tokWord || isKeyword(tok.text) {
+		return nil, p.errorf(tok, "expected key, found %q", tok.text)
+	}
+
+	term := &Term{Label: false, Query: zebra.Query{Key: tok.text, Op: zebra.MatchEqual, Values: nil}}
+
+	if strings.HasPrefix(strings.ToLower(term.Key), LabelPrefix) {
+		term.Label = true
+		term.Key = term.Key[len(LabelPrefix):]
+	}
+
+	opTok := p.next()
+	if err := term.Op.UnmarshalText([]byte(strings.ToLower(opTok.text))); err != nil ||
+		(opTok.kind != tokOp && opTok.kind != tokWord) {
+		return nil, p.errorf(opTok, "expected operator, found %q", opTok.text)
+	}
+
+	var err error
+
+	switch term.Op {
+	case zebra.MatchExists:
+	case zebra.MatchIn, zebra.MatchNotIn:
+		term.Values, err = p.parseList()
+	default:
+		var val string
+
+		val, err = p.parseValue()
+		term.Values = []string{val}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := term.Validate(); err != nil {
+		return nil, p.errorf(tok, "invalid comparison %q", term.String())
+	}
+
+	return term, nil
+}
+
+// list := "(" value { "," value } ")" | value.
+func (p *parser) parseList() ([]string, error) {
+	if p.peek().kind != tokLParen {
+		val, err := p.parseValue()
+
+		return []string{val}, err
+	}
+
+	p.next()
+
+	values := []string{}
+
+	for {
+		val, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, val)
+
+		switch tok := p.next(); tok.kind {
+		case tokComma:
+			continue
+		case tokRParen:
+			return values, nil
+		default:
+			return nil, p.errorf(tok, "expected \",\" or \")\", found %q", tok.text)
+		}
+	}
+}
+
+func (p *parser) parseValue() (string, error) {
+	tok := p.next()
+	if tok.kind != tokWord && tok.kind != tokString {
+		return "", p.errorf(tok, "expected value, found %q", tok.text)
+	}
+
+	return tok.text, nil
+}
+
+func isKeyword(word string) bool {
+	switch strings.ToLower(word) {
+	case "and", "or", "not", "in", "notin", "exists", "prefix":
+		return true
+	default:
+		return false
+	}
+}
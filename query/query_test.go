@@ -0,0 +1,127 @@
+package query_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/compute"
+	"github.com/project-safari/zebra/network"
+	"github.com/project-safari/zebra/query"
+	"github.com/stretchr/testify/assert"
+)
+
+func getResources() (*compute.Server, *compute.Server, *network.VLANPool) {
+	s1 := compute.NewServer([]string{"sn1", "modelA-1", "s1"}, net.ParseIP("10.1.0.1"),
+		zebra.Labels{"color": "red", "system.group": "eng"})
+	s2 := compute.NewServer([]string{"sn2", "modelB", "s2"}, net.ParseIP("10.2.0.1"),
+		zebra.Labels{"color": "blue", "system.group": "eng"})
+	vlan := &network.VLANPool{
+		BaseResource: *zebra.NewBaseResource("VLANPool", zebra.Labels{"color": "red"}),
+		RangeStart:   10,
+		RangeEnd:     20,
+	}
+
+	s2.Status.Lease = zebra.Free
+
+	return s1, s2, vlan
+}
+
+func match(assert *assert.Assertions, q string, resources ...zebra.Resource) []string {
+	expr, err := query.Parse(q)
+	assert.Nil(err, q)
+
+	if expr == nil {
+		return nil
+	}
+
+	// The string form of an expression parses to the same expression
+	again, err := query.Parse(expr.String())
+	assert.Nil(err, expr.String())
+	assert.Equal(expr, again)
+
+	ids := []string{}
+
+	for _, res := range resources {
+		if expr.Match(res) {
+			ids = append(ids, res.GetID())
+		}
+	}
+
+	return ids
+}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	s1, s2, vlan := getResources()
+	all := []zebra.Resource{s1, s2, vlan}
+
+	assert.Equal([]string{s1.ID}, match(assert, `label.color == red and type == Server`, all...))
+	assert.Equal([]string{s1.ID, vlan.ID}, match(assert, `label.color==red`, all...))
+	assert.Equal([]string{s2.ID}, match(assert, `label.color != red`, all...))
+	assert.Equal([]string{s1.ID, s2.ID}, match(assert, `type in (Server,ESX)`, all...))
+	assert.Equal([]string{vlan.ID}, match(assert, `type notin (Server)`, all...))
+	assert.Equal([]string{s1.ID, s2.ID}, match(assert, `label.system.group exists`, all...))
+	assert.Equal([]string{vlan.ID}, match(assert, `not label.system.group exists`, all...))
+	assert.Equal([]string{s1.ID}, match(assert, `model prefix modelA`, all...))
+	assert.Equal([]string{s1.ID, s2.ID}, match(assert, `model =~ "^model[AB]"`, all...))
+	assert.Equal([]string{s2.ID}, match(assert, `boardIP > 10.1.255.255`, all...))
+	assert.Equal([]string{s1.ID}, match(assert, `boardIP in 10.1.0.0/16`, all...))
+	assert.Equal([]string{vlan.ID}, match(assert, `rangeStart < 11 AND rangeEnd > 19`, all...))
+	assert.Equal([]string{s2.ID}, match(assert, `credentials.name == "s2"`, all...))
+
+	q := `type in (Server,ESX) and label.color == red and (status.lease == free or model =~ "^modelA")`
+	assert.Equal([]string{s1.ID}, match(assert, q, all...))
+
+	q = `type in (Server,ESX) and not (label.color == red or status.lease == leased)`
+	assert.Equal([]string{s2.ID}, match(assert, q, all...))
+
+	// and binds stronger than or
+	q = `label.color == blue or type == VLANPool and rangeStart > 100`
+	assert.Equal([]string{s2.ID}, match(assert, q, all...))
+
+	resMap := zebra.NewResourceMap(nil)
+	for _, res := range all {
+		resMap.Add(res, res.GetType())
+	}
+
+	expr, err := query.Parse(`label.color == red`)
+	assert.Nil(err)
+
+	filtered := query.Filter(expr, resMap)
+	assert.Len(filtered.Resources, 2)
+	assert.Len(filtered.Resources["Server"].Resources, 1)
+	assert.Len(filtered.Resources["VLANPool"].Resources, 1)
+}
+
+func TestParseErrors(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	bad := []string{
+		``,
+		`color`,
+		`color = red`,
+		`color <= red`,
+		`color == `,
+		`color == red and`,
+		`(color == red`,
+		`color == red)`,
+		`color in (red, blue`,
+		`color in (red blue)`,
+		`color == "red`,
+		`color =~ "("`,
+		`and == red`,
+		`color exists red`,
+		`color like red`,
+		`== red`,
+	}
+
+	for _, q := range bad {
+		_, err := query.Parse(q)
+		assert.True(errors.Is(err, query.ErrSyntax), q)
+	}
+}
@@ -172,6 +172,26 @@ func CopyResourceMap(dest *ResourceMap, src *ResourceMap) {
 	}
 }
 
+// CopyResource returns a deep copy of the resource, a new resource of its type
+// is made with the factory and the resource json is unmarshaled into it.
+func CopyResource(factory ResourceFactory, res Resource) (Resource, error) {
+	copied := factory.New(res.GetType())
+	if copied == nil {
+		return nil, ErrTypeEmpty
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, copied); err != nil {
+		return nil, err
+	}
+
+	return copied, nil
+}
+
 func (r *ResourceMap) GetFactory() ResourceFactory {
 	return r.factory
 }
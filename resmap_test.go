@@ -1,6 +1,7 @@
 package zebra_test
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/project-safari/zebra"
@@ -58,10 +59,11 @@ func TestListMarshalUnmarshal(t *testing.T) {
 
 	vlan := &network.VLANPool{
 		BaseResource: zebra.BaseResource{
-			ID:     "0100001",
-			Type:   "invalid",
-			Labels: nil,
-			Status: zebra.DefaultStatus(),
+			ID:              "0100001",
+			Type:            "invalid",
+			Labels:          nil,
+			Status:          zebra.DefaultStatus(),
+			ResourceVersion: 0,
 		},
 		RangeStart: 0,
 		RangeEnd:   10,
@@ -136,6 +138,40 @@ func TestCopyResourceMap(t *testing.T) {
 	assert.Equal(1, len(resB.Resources["IPAddressPool"].Resources))
 }
 
+func TestCopyResource(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	f := zebra.Factory().Add(network.VLANPoolType())
+	vlan := &network.VLANPool{
+		BaseResource: *zebra.NewBaseResource("VLANPool", zebra.Labels{"system.group": "eng"}),
+		RangeStart:   1,
+		RangeEnd:     10,
+	}
+
+	res, err := zebra.CopyResource(f, vlan)
+	assert.Nil(err)
+	assert.NotSame(vlan, res)
+
+	expected, err := json.Marshal(vlan)
+	assert.Nil(err)
+
+	actual, err := json.Marshal(res)
+	assert.Nil(err)
+	assert.JSONEq(string(expected), string(actual))
+
+	// The copy does not share anything with the resource
+	status := res.GetStatus()
+	status.Lease = zebra.Leased
+	res.SetStatus(status)
+	res.GetLabels()["system.group"] = "ops"
+	assert.Equal(zebra.Free, vlan.Status.Lease)
+	assert.Equal("eng", vlan.Labels["system.group"])
+
+	_, err = zebra.CopyResource(zebra.Factory(), vlan)
+	assert.Equal(zebra.ErrTypeEmpty, err)
+}
+
 func TestGetFactory(t *testing.T) {
 	t.Parallel()
 	assert := assert.New(t)
@@ -204,10 +240,11 @@ func TestMapMarshalUnMarshal(t *testing.T) {
 
 	vlan := &network.VLANPool{
 		BaseResource: zebra.BaseResource{
-			ID:     "0100001",
-			Type:   "VLANPool",
-			Labels: nil,
-			Status: zebra.DefaultStatus(),
+			ID:              "0100001",
+			Type:            "VLANPool",
+			Labels:          nil,
+			Status:          zebra.DefaultStatus(),
+			ResourceVersion: 0,
 		},
 		RangeStart: 0,
 		RangeEnd:   10,
@@ -14,6 +14,10 @@ type Resource interface {
 	GetID() string
 	GetType() string
 	GetLabels() Labels
+	GetStatus() Status
+	SetStatus(status Status)
+	GetResourceVersion() uint64
+	SetResourceVersion(version uint64)
 }
 
 var (
@@ -30,13 +34,17 @@ var (
 	ErrLabel       = errors.New("missing mandatory system label")
 )
 
+// ErrConflict is returned for a write that carries a stale resource version.
+var ErrConflict = errors.New("resource version conflict")
+
 // BaseResource must be embedded in all resource structs, ensuring each resource is
 // assigned an ID string.
 type BaseResource struct {
-	ID     string `json:"id"`
-	Type   string `json:"type"`
-	Labels Labels `json:"labels,omitempty"`
-	Status Status `json:"status,omitempty"`
+	ID              string `json:"id"`
+	Type            string `json:"type"`
+	Labels          Labels `json:"labels,omitempty"`
+	Status          Status `json:"status,omitempty"`
+	ResourceVersion uint64 `json:"resourceVersion,omitempty"`
 }
 
 // Validate returns an error if the given BaseResource object has incorrect values.
@@ -78,6 +86,27 @@ func (r *BaseResource) GetLabels() Labels {
 	return dest
 }
 
+// Return status of BaseResource r.
+func (r *BaseResource) GetStatus() Status {
+	return r.Status
+}
+
+// Set status of BaseResource r.
+func (r *BaseResource) SetStatus(status Status) {
+	r.Status = status
+}
+
+// Return resource version of BaseResource r, it is bumped by the store on
+// every write and is 0 for resources that have not been stored yet.
+func (r *BaseResource) GetResourceVersion() uint64 {
+	return r.ResourceVersion
+}
+
+// Set resource version of BaseResource r.
+func (r *BaseResource) SetResourceVersion(version uint64) {
+	r.ResourceVersion = version
+}
+
 // Special label validation to ensure all resources have group label.
 func (r *BaseResource) LabelsValidate() error {
 	if _, ok := r.Labels["system.group"]; !ok {
@@ -17,10 +17,11 @@ func TestBaseResource(t *testing.T) {
 
 	ctx := context.Background()
 	res := &zebra.BaseResource{
-		ID:     "",
-		Type:   "",
-		Labels: zebra.Labels{"key": "value"},
-		Status: zebra.DefaultStatus(),
+		ID:              "",
+		Type:            "",
+		Labels:          zebra.Labels{"key": "value"},
+		Status:          zebra.DefaultStatus(),
+		ResourceVersion: 0,
 	}
 	assert.NotNil(res.Validate(ctx))
 
@@ -36,6 +37,19 @@ func TestBaseResource(t *testing.T) {
 	assert.Equal(res.ID, res.GetID())
 	assert.Equal(res.Type, res.GetType())
 	assert.True(res.GetLabels().HasKey("key"))
+
+	assert.Equal(uint64(0), res.GetResourceVersion())
+	res.SetResourceVersion(3)
+	assert.Equal(uint64(3), res.GetResourceVersion())
+
+	status := res.GetStatus()
+	assert.Equal(zebra.Free, status.Lease)
+
+	status.Lease = zebra.Leased
+	status.UsedBy = "user@zebra.project-safari.io"
+	res.SetStatus(status)
+	assert.Equal(zebra.Leased, res.GetStatus().Lease)
+	assert.Equal(status.UsedBy, res.GetStatus().UsedBy)
 }
 
 // TestBaseResource tests the *NamedResource Validate function with a pass case
@@ -47,10 +61,11 @@ func TestNamedResource(t *testing.T) {
 	ctx := context.Background()
 	res := &zebra.NamedResource{
 		BaseResource: zebra.BaseResource{
-			ID:     "",
-			Type:   "",
-			Labels: zebra.Labels{"key": "value"},
-			Status: zebra.DefaultStatus(),
+			ID:              "",
+			Type:            "",
+			Labels:          zebra.Labels{"key": "value"},
+			Status:          zebra.DefaultStatus(),
+			ResourceVersion: 0,
 		},
 		Name: "",
 	}
@@ -79,10 +94,11 @@ func TestCredentials(t *testing.T) {
 	credentials := zebra.Credentials{
 		NamedResource: zebra.NamedResource{
 			BaseResource: zebra.BaseResource{
-				ID:     "",
-				Type:   "Credentials",
-				Labels: zebra.Labels{},
-				Status: zebra.DefaultStatus(),
+				ID:              "",
+				Type:            "Credentials",
+				Labels:          zebra.Labels{},
+				Status:          zebra.DefaultStatus(),
+				ResourceVersion: 0,
 			},
 			Name: "",
 		},
@@ -11,6 +11,7 @@ type Status struct {
 	Fault       Fault     `json:"fault"`
 	Lease       Lease     `json:"lease"`
 	UsedBy      string    `json:"usedBy"`
+	LeaseID     string    `json:"leaseID,omitempty"`
 	State       State     `json:"state"`
 	CreatedTime time.Time `json:"createdTime"`
 }
@@ -1,7 +1,13 @@
 package zebra
 
 import (
+	"bytes"
 	"errors"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 type Operator uint8
@@ -12,6 +18,11 @@ const (
 	MatchNotEqual
 	MatchIn
 	MatchNotIn
+	MatchExists
+	MatchPrefix
+	MatchRegex
+	MatchLess
+	MatchGreater
 )
 
 // Command struct for label queries.
@@ -25,8 +36,38 @@ var (
 	ErrNotFound        = errors.New("resource not found in store")
 	ErrInvalidResource = errors.New("create/delete on invalid resource")
 	ErrInvalidQuery    = errors.New("invalid query")
+	ErrInvalidPage     = errors.New("invalid page request")
+	ErrTxnDone         = errors.New("transaction is already committed or rolled back")
 )
 
+// PageRequest selects a page of query results. Results are sorted by the
+// SortBy property, or label if prefixed with "label.", and by id. A page
+// starts right after the result the Continue token of the previous page
+// points at, so paging is not affected by resources created or deleted in
+// between. A zero Limit returns all the results.
+type PageRequest struct {
+	Limit    int    `json:"limit,omitempty"`
+	Continue string `json:"continue,omitempty"`
+	SortBy   string `json:"sortBy,omitempty"`
+	Desc     bool   `json:"desc,omitempty"`
+}
+
+// Page is a page of query results, Continue is set if there are more.
+type Page struct {
+	Resources []Resource `json:"resources"`
+	Continue  string     `json:"continue,omitempty"`
+}
+
+// Txn is a store transaction. Creates and deletes are staged and applied in
+// the order they were staged when the transaction is committed, either all of
+// them or none. A transaction can be committed or rolled back only once.
+type Txn interface {
+	Create(res Resource) error
+	Delete(res Resource) error
+	Commit() error
+	Rollback()
+}
+
 // Store interface requires basic store functionalities.
 type Store interface {
 	Initialize() error
@@ -40,18 +81,151 @@ type Store interface {
 	QueryType(types []string) *ResourceMap
 	QueryLabel(query Query) (*ResourceMap, error)
 	QueryProperty(query Query) (*ResourceMap, error)
+	QueryPage(match func(Resource) bool, page PageRequest) (*Page, error)
+	Watch(since uint64) (<-chan Event, func(), error)
+	Begin() Txn
 }
 
 func (q *Query) Validate() error {
-	if (q.Op == MatchEqual || q.Op == MatchNotEqual) && len(q.Values) != 1 {
+	switch q.Op {
+	case MatchIn, MatchNotIn:
+		return nil
+	case MatchExists:
+		if len(q.Values) != 0 {
+			return ErrInvalidQuery
+		}
+
+		return nil
+	case MatchEqual, MatchNotEqual, MatchPrefix, MatchLess, MatchGreater:
+		if len(q.Values) != 1 {
+			return ErrInvalidQuery
+		}
+
+		return nil
+	case MatchRegex:
+		if len(q.Values) != 1 {
+			return ErrInvalidQuery
+		}
+
+		if _, err := compileRegex(q.Values[0]); err != nil {
+			return ErrInvalidQuery
+		}
+
+		return nil
+	default:
 		return ErrInvalidQuery
 	}
+}
 
-	if q.Op > MatchNotIn {
-		return ErrInvalidQuery
+// Match returns true if the value matches the query, found must be false if
+// the queried key has no value. Values are compared as numbers or as IPs if
+// both sides can be parsed as such, an IP also matches a CIDR query value.
+// Otherwise values are compared as strings. The query must be valid.
+func (q *Query) Match(val string, found bool) bool {
+	switch q.Op {
+	case MatchEqual, MatchIn:
+		return found && matchIn(val, q.Values)
+	case MatchNotEqual, MatchNotIn:
+		return !found || !matchIn(val, q.Values)
+	case MatchExists:
+		return found
+	case MatchPrefix:
+		return found && strings.HasPrefix(val, q.Values[0])
+	case MatchRegex:
+		re, err := compileRegex(q.Values[0])
+
+		return found && err == nil && re.MatchString(val)
+	case MatchLess:
+		return found && Compare(val, q.Values[0]) < 0
+	case MatchGreater:
+		return found && Compare(val, q.Values[0]) > 0
+	default:
+		return false
 	}
+}
 
-	return nil
+// regexCacheSize is the number of compiled query regexes kept, the cache is
+// emptied when it is full.
+const regexCacheSize = 256
+
+// regexCache keeps the compiled query regexes, so that queries matched against
+// every resource compile their regex once.
+var regexCache = struct { //nolint:gochecknoglobals
+	sync.Mutex
+	regexes map[string]*regexp.Regexp
+}{regexes: make(map[string]*regexp.Regexp, regexCacheSize)}
+
+// compileRegex returns the compiled regex, from the cache if it was compiled
+// before.
+func compileRegex(pattern string) (*regexp.Regexp, error) {
+	regexCache.Lock()
+	defer regexCache.Unlock()
+
+	if re, ok := regexCache.regexes[pattern]; ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(regexCache.regexes) == regexCacheSize {
+		regexCache.regexes = make(map[string]*regexp.Regexp, regexCacheSize)
+	}
+
+	regexCache.regexes[pattern] = re
+
+	return re, nil
+}
+
+// Return if val matches any of the values.
+func matchIn(val string, values []string) bool {
+	if IsIn(val, values) {
+		return true
+	}
+
+	ip := net.ParseIP(val)
+	if ip == nil {
+		return false
+	}
+
+	for _, v := range values {
+		if other := net.ParseIP(v); other != nil && ip.Equal(other) {
+			return true
+		}
+
+		if _, ipNet, err := net.ParseCIDR(v); err == nil && ipNet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Compare returns -1, 0 or 1 if a is less than, equal to or greater than b.
+// The values are compared as numbers, IPs or strings in this order.
+func Compare(a, b string) int {
+	x, errA := strconv.ParseFloat(a, 64)
+	y, errB := strconv.ParseFloat(b, 64)
+
+	if errA == nil && errB == nil {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		default:
+			return 0
+		}
+	}
+
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	if ipA != nil && ipB != nil {
+		return bytes.Compare(ipA.To16(), ipB.To16())
+	}
+
+	return strings.Compare(a, b)
 }
 
 func (o *Operator) MarshalText() ([]byte, error) {
@@ -60,6 +234,11 @@ func (o *Operator) MarshalText() ([]byte, error) {
 		MatchNotEqual: "!=",
 		MatchIn:       "in",
 		MatchNotIn:    "notin",
+		MatchExists:   "exists",
+		MatchPrefix:   "prefix",
+		MatchRegex:    "=~",
+		MatchLess:     "<",
+		MatchGreater:  ">",
 	}
 
 	opVal, ok := opMap[*o]
@@ -72,10 +251,15 @@ func (o *Operator) MarshalText() ([]byte, error) {
 
 func (o *Operator) UnmarshalText(data []byte) error {
 	opMap := map[string]Operator{
-		"==":    MatchEqual,
-		"!=":    MatchNotEqual,
-		"in":    MatchIn,
-		"notin": MatchNotIn,
+		"==":     MatchEqual,
+		"!=":     MatchNotEqual,
+		"in":     MatchIn,
+		"notin":  MatchNotIn,
+		"exists": MatchExists,
+		"prefix": MatchPrefix,
+		"=~":     MatchRegex,
+		"<":      MatchLess,
+		">":      MatchGreater,
 	}
 
 	op, ok := opMap[string(data)]
@@ -0,0 +1,35 @@
+package store
+
+import (
+	"errors"
+
+	"github.com/project-safari/zebra"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Store backends, selected by store.backend in the server config.
+const (
+	FileBackend = "file"
+	DBBackend   = "db"
+)
+
+var ErrBackend = errors.New("unknown store backend")
+
+// Backend is a store whose operation latencies can be recorded.
+type Backend interface {
+	zebra.Store
+	RecordLatency(h *prometheus.HistogramVec)
+}
+
+// NewBackend returns a store of the given backend in the storage root, the
+// ResourceStore if no backend is given.
+func NewBackend(backend string, root string, factory zebra.ResourceFactory) (Backend, error) {
+	switch backend {
+	case "", FileBackend:
+		return NewResourceStore(root, factory), nil
+	case DBBackend:
+		return NewDBStore(root, factory), nil
+	default:
+		return nil, ErrBackend
+	}
+}
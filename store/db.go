@@ -0,0 +1,665 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/filestore"
+	"github.com/project-safari/zebra/labelstore"
+	"github.com/prometheus/client_golang/prometheus"
+	bolt "go.etcd.io/bbolt"
+)
+
+// DBFile is the database file of the DBStore in the storage root.
+const DBFile = "zebra.db"
+
+// DBTimeout is how long opening the database waits for another process to
+// close it.
+const DBTimeout = 5 * time.Second
+
+// Buckets of the database. Resources are stored as JSON by id, the indexes
+// map keys made of the indexed values and the id, separated by indexSep, to
+// nothing. The label catalog maps keys made of the label key, value, type and
+// group to the number of resources with them.
+const (
+	resourcesBucket  = "resources"
+	typesBucket      = "types"
+	labelsBucket     = "labels"
+	propertiesBucket = "properties"
+	catalogBucket    = "catalog"
+	indexSep         = "\x00"
+)
+
+// catalogFields is the number of fields of a label catalog key.
+const catalogFields = 4
+
+// DBProperties are the properties indexed by the DBStore, those all resources
+// may have. Queries of other properties read all resources.
+var DBProperties = []string{ //nolint:gochecknoglobals
+	"Name", "Status.Lease", "Status.State", "Status.Fault", "Status.UsedBy",
+}
+
+// DBStore implements zebra.Store on an embedded bbolt database in the storage
+// root. Unlike ResourceStore, resources are not kept in memory, they are read
+// from the database through its indexes of types, labels and DBProperties.
+type DBStore struct {
+	lock        sync.RWMutex
+	StorageRoot string
+	Factory     zebra.ResourceFactory
+	db          *bolt.DB
+	events      *eventLog
+	latency     *prometheus.HistogramVec
+}
+
+func NewDBStore(root string, factory zebra.ResourceFactory) *DBStore {
+	return &DBStore{
+		lock:        sync.RWMutex{},
+		StorageRoot: root,
+		Factory:     factory,
+		db:          nil,
+		events:      newEventLog(factory),
+		latency:     nil,
+	}
+}
+
+// RecordLatency records the latencies of the database operations in the
+// histogram, which must have the store and op labels.
+func (ds *DBStore) RecordLatency(h *prometheus.HistogramVec) {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	ds.latency = h
+}
+
+// observe records the latency of the database operation which started at
+// start.
+func (ds *DBStore) observe(op string, start time.Time) {
+	if ds.latency != nil {
+		ds.latency.WithLabelValues(BoltDB, op).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Initialize opens the database, creating it if needed. Nothing is loaded in
+// memory. The label catalog is built from the resources of databases created
+// before it was kept.
+func (ds *DBStore) Initialize() error {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	if err := os.MkdirAll(ds.StorageRoot, os.ModePerm); err != nil {
+		return err
+	}
+
+	opts := &bolt.Options{Timeout: DBTimeout} //nolint:exhaustivestruct,exhaustruct
+
+	db, err := bolt.Open(path.Join(ds.StorageRoot, DBFile), filestore.RWRR, opts)
+	if err != nil {
+		return err
+	}
+
+	if err := db.Update(ds.createBuckets); err != nil {
+		db.Close()
+
+		return err
+	}
+
+	ds.db = db
+
+	return nil
+}
+
+// Wipe closes the database, the database file is kept.
+func (ds *DBStore) Wipe() error {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	if ds.db == nil {
+		return nil
+	}
+
+	err := ds.db.Close()
+	ds.db = nil
+
+	return err
+}
+
+// Clear deletes all resources.
+func (ds *DBStore) Clear() error {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	return ds.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range buckets() {
+			if err := tx.DeleteBucket([]byte(name)); err != nil {
+				return err
+			}
+		}
+
+		return ds.createBuckets(tx)
+	})
+}
+
+func buckets() []string {
+	return []string{resourcesBucket, typesBucket, labelsBucket, propertiesBucket, catalogBucket}
+}
+
+// createBuckets creates the missing buckets, and builds the label catalog if
+// it is missing.
+func (ds *DBStore) createBuckets(tx *bolt.Tx) error {
+	buildCatalog := tx.Bucket([]byte(catalogBucket)) == nil
+
+	for _, name := range buckets() {
+		if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+			return err
+		}
+	}
+
+	if !buildCatalog {
+		return nil
+	}
+
+	return tx.Bucket([]byte(resourcesBucket)).ForEach(func(k, v []byte) error {
+		res, err := ds.unpack(v)
+		if err != nil {
+			return err
+		}
+
+		return updateCatalog(tx, res, 1)
+	})
+}
+
+// Return ResourceMap with resource type as key and list of resources as val.
+func (ds *DBStore) Load() (*zebra.ResourceMap, error) {
+	ds.lock.RLock()
+	defer ds.lock.RUnlock()
+
+	return ds.view("load", func(tx *bolt.Tx, resMap *zebra.ResourceMap) error {
+		return tx.Bucket([]byte(resourcesBucket)).ForEach(func(k, v []byte) error {
+			return ds.add(resMap, v)
+		})
+	})
+}
+
+// Create stores the resource, or updates it if it is already stored.
+func (ds *DBStore) Create(res zebra.Resource) error {
+	if res == nil || res.Validate(context.Background()) != nil {
+		return zebra.ErrInvalidResource
+	}
+
+	return ds.commit([]txnOp{{del: false, res: res}})
+}
+
+// Delete deletes the resource, deleting a resource which is not stored is not
+// an error.
+func (ds *DBStore) Delete(res zebra.Resource) error {
+	if res == nil || res.Validate(context.Background()) != nil {
+		return zebra.ErrInvalidResource
+	}
+
+	return ds.commit([]txnOp{{del: true, res: res}})
+}
+
+// Begin starts a transaction, nothing is written until it is committed.
+func (ds *DBStore) Begin() zebra.Txn {
+	return newTxn(ds.commit)
+}
+
+// Return all resources in a ResourceMap, an empty one if they cannot be read.
+func (ds *DBStore) Query() *zebra.ResourceMap {
+	resMap, err := ds.Load()
+	if err != nil {
+		return zebra.NewResourceMap(ds.Factory)
+	}
+
+	return resMap
+}
+
+// Return resources with matching UUIDs.
+func (ds *DBStore) QueryUUID(uuids []string) *zebra.ResourceMap {
+	ds.lock.RLock()
+	defer ds.lock.RUnlock()
+
+	return ds.queryIDs(func(tx *bolt.Tx) ([]string, error) {
+		return uuids, nil
+	})
+}
+
+// Return resources with matching types.
+func (ds *DBStore) QueryType(types []string) *zebra.ResourceMap {
+	ds.lock.RLock()
+	defer ds.lock.RUnlock()
+
+	return ds.queryIDs(func(tx *bolt.Tx) ([]string, error) {
+		ids := []string{}
+		b := tx.Bucket([]byte(typesBucket))
+
+		for _, t := range types {
+			scan(b, t, func(_ string, id string) {
+				ids = append(ids, id)
+			})
+		}
+
+		return ids, nil
+	})
+}
+
+// Return resources with matching label. Resources without the label never
+// match.
+func (ds *DBStore) QueryLabel(query zebra.Query) (*zebra.ResourceMap, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+
+	ds.lock.RLock()
+	defer ds.lock.RUnlock()
+
+	return ds.queryIndex(labelsBucket, query), nil
+}
+
+// Return resources which match given property/value(s). The DBProperties are
+// looked up in their index, unless the query also matches the resources
+// without the property, other properties are matched on all resources.
+func (ds *DBStore) QueryProperty(query zebra.Query) (*zebra.ResourceMap, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+
+	if !isDBProperty(query.Key) || query.Match("", false) {
+		resMap, err := ds.Load()
+		if err != nil {
+			return nil, err
+		}
+
+		return FilterProperty(query, resMap)
+	}
+
+	ds.lock.RLock()
+	defer ds.lock.RUnlock()
+
+	return ds.queryIndex(propertiesBucket, zebra.Query{
+		Key:    strings.ToLower(query.Key),
+		Op:     query.Op,
+		Values: query.Values,
+	}), nil
+}
+
+// QueryPage returns a page of the resources matching the given function, all
+// resources match if it is nil. The page is computed from a single read of
+// the database.
+func (ds *DBStore) QueryPage(match func(zebra.Resource) bool, page zebra.PageRequest) (*zebra.Page, error) {
+	after, err := decodeCursor(&page)
+	if err != nil {
+		return nil, err
+	}
+
+	resMap, err := ds.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	return paginate(resMap, match, page, after), nil
+}
+
+// Watch returns a channel of the store events after the given revision, see
+// ResourceStore.Watch.
+func (ds *DBStore) Watch(since uint64) (<-chan zebra.Event, func(), error) {
+	return ds.events.watch(&ds.lock, since)
+}
+
+// Revision returns the revision of the last change to the store.
+func (ds *DBStore) Revision() uint64 {
+	ds.lock.RLock()
+	defer ds.lock.RUnlock()
+
+	return ds.events.revision
+}
+
+// LabelCatalog returns the number of resources with each label value, by
+// type and group, sorted by key, value, type and group. The counts are read
+// from the catalog kept in the database, not from the resources.
+func (ds *DBStore) LabelCatalog() []labelstore.LabelCount {
+	ds.lock.RLock()
+	defer ds.lock.RUnlock()
+
+	defer ds.observe("catalog", time.Now())
+
+	counts := []labelstore.LabelCount{}
+
+	err := ds.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(catalogBucket)).ForEach(func(k, v []byte) error {
+			fields := strings.Split(string(k), indexSep)
+			if len(fields) != catalogFields {
+				return nil
+			}
+
+			count, err := strconv.Atoi(string(v))
+			if err != nil {
+				return err
+			}
+
+			counts = append(counts, labelstore.LabelCount{
+				Key:   fields[0],
+				Value: fields[1],
+				Scope: labelstore.Scope{Type: fields[2], Group: fields[3]},
+				Count: count,
+			})
+
+			return nil
+		})
+	})
+	if err != nil {
+		return []labelstore.LabelCount{}
+	}
+
+	return counts
+}
+
+// commit applies the operations in a single database transaction, which is
+// durable once committed. If it fails, the old versions are restored.
+func (ds *DBStore) commit(ops []txnOp) error {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	defer ds.observe("commit", time.Now())
+
+	var (
+		events  []zebra.EventType
+		restore func()
+	)
+
+	err := ds.db.Update(func(tx *bolt.Tx) error {
+		var err error
+
+		events, restore, err = stageVersions(ops, func(id string) (uint64, bool) {
+			return storedVersion(tx, id)
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, op := range ops {
+			if err := ds.apply(tx, op); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		if restore != nil {
+			restore()
+		}
+
+		return err
+	}
+
+	for i, op := range ops {
+		ds.events.notify(events[i], op.res)
+	}
+
+	return nil
+}
+
+// apply replaces the stored resource and its index keys, or deletes them.
+func (ds *DBStore) apply(tx *bolt.Tx, op txnOp) error {
+	resources := tx.Bucket([]byte(resourcesBucket))
+	id := []byte(op.res.GetID())
+
+	if contents := resources.Get(id); contents != nil {
+		stored, err := ds.unpack(contents)
+		if err != nil {
+			return err
+		}
+
+		if err := updateIndexes(tx, stored, (*bolt.Bucket).Delete); err != nil {
+			return err
+		}
+
+		if err := updateCatalog(tx, stored, -1); err != nil {
+			return err
+		}
+
+		if err := resources.Delete(id); err != nil {
+			return err
+		}
+	}
+
+	if op.del {
+		return nil
+	}
+
+	contents, err := json.Marshal(op.res)
+	if err != nil {
+		return err
+	}
+
+	if err := resources.Put(id, contents); err != nil {
+		return err
+	}
+
+	if err := updateCatalog(tx, op.res, 1); err != nil {
+		return err
+	}
+
+	return updateIndexes(tx, op.res, func(b *bolt.Bucket, key []byte) error {
+		return b.Put(key, []byte{})
+	})
+}
+
+// updateCatalog adds delta to the catalog counts of the label values of the
+// resource, counts which drop to 0 are removed.
+func updateCatalog(tx *bolt.Tx, res zebra.Resource, delta int) error {
+	b := tx.Bucket([]byte(catalogBucket))
+	labels := res.GetLabels()
+
+	for label, val := range labels {
+		key := []byte(indexKey(label, val, res.GetType(), labels[labelstore.GroupLabel]))
+		count := delta
+
+		if stored := b.Get(key); stored != nil {
+			n, err := strconv.Atoi(string(stored))
+			if err != nil {
+				return err
+			}
+
+			count += n
+		}
+
+		if count <= 0 {
+			if err := b.Delete(key); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err := b.Put(key, []byte(strconv.Itoa(count))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// updateIndexes calls f with the index bucket and key of each indexed value
+// of the resource.
+func updateIndexes(tx *bolt.Tx, res zebra.Resource, f func(*bolt.Bucket, []byte) error) error {
+	id := res.GetID()
+	keys := map[string][]string{
+		typesBucket:      {indexKey(res.GetType(), id)},
+		labelsBucket:     {},
+		propertiesBucket: {},
+	}
+
+	for label, val := range res.GetLabels() {
+		keys[labelsBucket] = append(keys[labelsBucket], indexKey(label, val, id))
+	}
+
+	for _, prop := range DBProperties {
+		if val, ok := PropertyValue(res, prop); ok {
+			keys[propertiesBucket] = append(keys[propertiesBucket], indexKey(strings.ToLower(prop), val, id))
+		}
+	}
+
+	for name, bucketKeys := range keys {
+		b := tx.Bucket([]byte(name))
+
+		for _, key := range bucketKeys {
+			if err := f(b, []byte(key)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// view reads the resources added by f to a new resource map in a read only
+// database transaction.
+func (ds *DBStore) view(op string, f func(*bolt.Tx, *zebra.ResourceMap) error) (*zebra.ResourceMap, error) {
+	defer ds.observe(op, time.Now())
+
+	resMap := zebra.NewResourceMap(ds.Factory)
+
+	if err := ds.db.View(func(tx *bolt.Tx) error { return f(tx, resMap) }); err != nil {
+		return nil, err
+	}
+
+	return resMap, nil
+}
+
+// queryIDs returns the resources with the ids returned by f, an empty map if
+// they cannot be read.
+func (ds *DBStore) queryIDs(f func(*bolt.Tx) ([]string, error)) *zebra.ResourceMap {
+	resMap, err := ds.view("query", func(tx *bolt.Tx, resMap *zebra.ResourceMap) error {
+		ids, err := f(tx)
+		if err != nil {
+			return err
+		}
+
+		b := tx.Bucket([]byte(resourcesBucket))
+
+		for _, id := range ids {
+			if contents := b.Get([]byte(id)); contents != nil {
+				if err := ds.add(resMap, contents); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return zebra.NewResourceMap(ds.Factory)
+	}
+
+	return resMap
+}
+
+// queryIndex returns the resources whose value of the query key in the index
+// bucket matches the query.
+func (ds *DBStore) queryIndex(bucket string, query zebra.Query) *zebra.ResourceMap {
+	return ds.queryIDs(func(tx *bolt.Tx) ([]string, error) {
+		ids := []string{}
+
+		scan(tx.Bucket([]byte(bucket)), query.Key, func(rest string, id string) {
+			if query.Match(rest, true) {
+				ids = append(ids, id)
+			}
+		})
+
+		return ids, nil
+	})
+}
+
+// add unpacks the stored resource and adds it to the resource map.
+func (ds *DBStore) add(resMap *zebra.ResourceMap, contents []byte) error {
+	res, err := ds.unpack(contents)
+	if err != nil {
+		return err
+	}
+
+	resMap.Add(res, res.GetType())
+
+	return nil
+}
+
+// unpack returns the stored resource as its type.
+func (ds *DBStore) unpack(contents []byte) (zebra.Resource, error) {
+	object := struct {
+		Type string `json:"type"`
+	}{Type: ""}
+
+	if err := json.Unmarshal(contents, &object); err != nil {
+		return nil, err
+	}
+
+	res := ds.Factory.New(object.Type)
+	if res == nil {
+		return nil, filestore.ErrTypeUnpack
+	}
+
+	if err := json.Unmarshal(contents, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Return the resource version of the stored resource with the given id.
+func storedVersion(tx *bolt.Tx, id string) (uint64, bool) {
+	contents := tx.Bucket([]byte(resourcesBucket)).Get([]byte(id))
+	if contents == nil {
+		return 0, false
+	}
+
+	object := struct {
+		ResourceVersion uint64 `json:"resourceVersion"`
+	}{ResourceVersion: 0}
+
+	_ = json.Unmarshal(contents, &object)
+
+	return object.ResourceVersion, true
+}
+
+// scan calls f with each index key of the bucket which starts with the given
+// value, split into the rest of the key, without the id, and the id.
+func scan(b *bolt.Bucket, value string, f func(rest string, id string)) {
+	prefix := []byte(value + indexSep)
+	c := b.Cursor()
+
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		key := string(k[len(prefix):])
+		i := strings.LastIndex(key, indexSep)
+
+		if i < 0 {
+			f("", key)
+
+			continue
+		}
+
+		f(key[:i], key[i+len(indexSep):])
+	}
+}
+
+func indexKey(values ...string) string {
+	return strings.Join(values, indexSep)
+}
+
+func isDBProperty(key string) bool {
+	for _, prop := range DBProperties {
+		if strings.EqualFold(prop, key) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,298 @@
+package store_test
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/cmd/herd/pkg"
+	"github.com/project-safari/zebra/compute"
+	"github.com/project-safari/zebra/filestore"
+	"github.com/project-safari/zebra/labelstore"
+	"github.com/project-safari/zebra/store"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func resourceIDs(resMap *zebra.ResourceMap) []string {
+	ids := []string{}
+
+	for _, l := range resMap.Resources {
+		for _, res := range l.Resources {
+			ids = append(ids, res.GetID())
+		}
+	}
+
+	sort.Strings(ids)
+
+	return ids
+}
+
+// The DBStore answers queries like the ResourceStore does.
+func TestDBStoreQueries(t *testing.T) { //nolint:funlen
+	t.Parallel()
+	assert := assert.New(t)
+
+	rsRoot, dsRoot := "testdbstorers", "testdbstoreds"
+
+	t.Cleanup(func() {
+		os.RemoveAll(rsRoot)
+		os.RemoveAll(dsRoot)
+	})
+
+	rs := store.NewResourceStore(rsRoot, store.DefaultFactory())
+	assert.Nil(rs.Initialize())
+
+	ds := store.NewDBStore(dsRoot, store.DefaultFactory())
+	assert.Nil(ds.Initialize())
+
+	resources := append(pkg.GenerateServer(10), pkg.GenerateLab(5)...)
+	resources = append(resources, pkg.GenerateVlanPool(5)...)
+
+	for i, res := range resources {
+		if i%3 == 0 {
+			status := res.GetStatus()
+			status.Lease = zebra.Leased
+			res.SetStatus(status)
+		}
+
+		assert.Nil(rs.Create(res))
+		res.SetResourceVersion(0)
+		assert.Nil(ds.Create(res))
+	}
+
+	server, ok := resources[0].(*compute.Server)
+	assert.True(ok)
+
+	assert.Equal(resourceIDs(rs.Query()), resourceIDs(ds.Query()))
+	assert.Len(resourceIDs(ds.Query()), 20)
+	assert.Equal(resourceIDs(rs.QueryType([]string{"Server", "Lab"})),
+		resourceIDs(ds.QueryType([]string{"Server", "Lab"})))
+	assert.Equal(resourceIDs(rs.QueryUUID([]string{server.ID, "missing"})),
+		resourceIDs(ds.QueryUUID([]string{server.ID, "missing"})))
+
+	group := server.Labels["system.group"]
+
+	for _, query := range []zebra.Query{
+		{Key: "system.group", Op: zebra.MatchEqual, Values: []string{group}},
+		{Key: "system.group", Op: zebra.MatchNotIn, Values: []string{group}},
+		{Key: "missing", Op: zebra.MatchNotEqual, Values: []string{group}},
+	} {
+		expected, err := rs.QueryLabel(query)
+		assert.Nil(err)
+
+		actual, err := ds.QueryLabel(query)
+		assert.Nil(err)
+		assert.Equal(resourceIDs(expected), resourceIDs(actual))
+	}
+
+	for _, query := range []zebra.Query{
+		{Key: "status.lease", Op: zebra.MatchEqual, Values: []string{"leased"}},
+		{Key: "Status.Lease", Op: zebra.MatchNotEqual, Values: []string{"leased"}},
+		{Key: "Name", Op: zebra.MatchIn, Values: []string{server.Name}},
+		{Key: "Name", Op: zebra.MatchNotIn, Values: []string{server.Name}},
+		{Key: "SerialNumber", Op: zebra.MatchEqual, Values: []string{server.SerialNumber}},
+	} {
+		expected, err := rs.QueryProperty(query)
+		assert.Nil(err)
+
+		actual, err := ds.QueryProperty(query)
+		assert.Nil(err)
+		assert.Equal(resourceIDs(expected), resourceIDs(actual))
+	}
+
+	leased, err := ds.QueryProperty(zebra.Query{Key: "Status.Lease", Op: zebra.MatchEqual, Values: []string{"leased"}})
+	assert.Nil(err)
+	assert.Len(resourceIDs(leased), 7)
+
+	_, err = ds.QueryLabel(zebra.Query{Key: "system.group", Op: zebra.MatchEqual, Values: nil})
+	assert.Equal(zebra.ErrInvalidQuery, err)
+
+	// Pages are the same
+	page := zebra.PageRequest{Limit: 6, Continue: "", SortBy: "name", Desc: false}
+
+	for {
+		expected, err := rs.QueryPage(nil, page)
+		assert.Nil(err)
+
+		actual, err := ds.QueryPage(nil, page)
+		assert.Nil(err)
+		assert.Equal(len(expected.Resources), len(actual.Resources))
+		assert.Equal(expected.Continue, actual.Continue)
+
+		for i := range expected.Resources {
+			assert.Equal(expected.Resources[i].GetID(), actual.Resources[i].GetID())
+		}
+
+		if actual.Continue == "" {
+			break
+		}
+
+		page.Continue = actual.Continue
+	}
+}
+
+func TestDBStore(t *testing.T) { //nolint:funlen
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testdbstore"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	ds := store.NewDBStore(root, store.DefaultFactory())
+	assert.Nil(ds.Initialize())
+	assert.Equal(zebra.ErrInvalidResource, ds.Create(getVLAN()))
+
+	events, cancel, err := ds.Watch(0)
+	assert.Nil(err)
+
+	defer cancel()
+
+	vlan := getVLAN()
+	vlan.Labels = zebra.Labels{"system.group": "eng", "color": "red"}
+	assert.Nil(ds.Create(vlan))
+	assert.Equal(uint64(1), vlan.ResourceVersion)
+
+	// Updates replace the indexed labels
+	vlan.Labels = zebra.Labels{"system.group": "eng", "color": "blue"}
+	assert.Nil(ds.Create(vlan))
+	assert.Equal(uint64(2), vlan.ResourceVersion)
+
+	red, err := ds.QueryLabel(zebra.Query{Key: "color", Op: zebra.MatchEqual, Values: []string{"red"}})
+	assert.Nil(err)
+	assert.Empty(red.Resources)
+
+	blue, err := ds.QueryLabel(zebra.Query{Key: "color", Op: zebra.MatchEqual, Values: []string{"blue"}})
+	assert.Nil(err)
+	assert.Equal([]string{vlan.ID}, resourceIDs(blue))
+
+	// Stale versions conflict
+	stale := getVLAN()
+	stale.ID = vlan.ID
+	stale.Labels = vlan.Labels
+	stale.ResourceVersion = 1
+	assert.Equal(zebra.ErrConflict, ds.Create(stale))
+	assert.Equal(uint64(1), stale.ResourceVersion)
+	assert.Equal(zebra.ErrConflict, ds.Delete(stale))
+
+	// Transactions write all or nothing
+	lab := getLab()
+	lab.Labels = zebra.Labels{"system.group": "eng"}
+
+	txn := ds.Begin()
+	assert.Nil(txn.Create(lab))
+	assert.Nil(txn.Create(stale))
+	assert.Equal(zebra.ErrConflict, txn.Commit())
+	assert.Empty(ds.QueryUUID([]string{lab.ID}).Resources)
+
+	txn = ds.Begin()
+	assert.Nil(txn.Create(lab))
+	assert.Nil(txn.Delete(vlan))
+	assert.Nil(txn.Commit())
+
+	for _, eventType := range []zebra.EventType{
+		zebra.EventCreate, zebra.EventUpdate, zebra.EventCreate, zebra.EventDelete,
+	} {
+		assert.Equal(eventType, (<-events).Type)
+	}
+
+	assert.Equal(uint64(4), ds.Revision())
+	assert.Empty(ds.QueryType([]string{"VLANPool"}).Resources)
+
+	blue, err = ds.QueryLabel(zebra.Query{Key: "color", Op: zebra.MatchExists, Values: nil})
+	assert.Nil(err)
+	assert.Empty(blue.Resources)
+
+	// Resources are persisted
+	assert.Nil(ds.Wipe())
+
+	ds = store.NewDBStore(root, store.DefaultFactory())
+	assert.Nil(ds.Initialize())
+	assert.Equal([]string{lab.ID}, resourceIDs(ds.QueryType([]string{"Lab"})))
+
+	named, err := ds.QueryProperty(zebra.Query{Key: "name", Op: zebra.MatchEqual, Values: []string{lab.Name}})
+	assert.Nil(err)
+	assert.Equal([]string{lab.ID}, resourceIDs(named))
+
+	assert.Nil(ds.Clear())
+	assert.Empty(ds.Query().Resources)
+	assert.Empty(ds.QueryType([]string{"Lab"}).Resources)
+	assert.Nil(ds.Wipe())
+}
+
+func TestDBLabelCatalog(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testdblabelcatalog"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	ds := store.NewDBStore(root, store.DefaultFactory())
+	assert.Nil(ds.Initialize())
+	assert.Empty(ds.LabelCatalog())
+
+	vlan := getVLAN()
+	vlan.Labels = zebra.Labels{"system.group": "eng", "color": "red"}
+	lab := getLab()
+	lab.Labels = zebra.Labels{"system.group": "eng", "color": "red"}
+
+	assert.Nil(ds.Create(vlan))
+	assert.Nil(ds.Create(lab))
+
+	eng := labelstore.Scope{Type: "Lab", Group: "eng"}
+	vlans := labelstore.Scope{Type: "VLANPool", Group: "eng"}
+	expected := []labelstore.LabelCount{
+		{Key: "color", Value: "red", Scope: eng, Count: 1},
+		{Key: "color", Value: "red", Scope: vlans, Count: 1},
+		{Key: "system.group", Value: "eng", Scope: eng, Count: 1},
+		{Key: "system.group", Value: "eng", Scope: vlans, Count: 1},
+	}
+	assert.Equal(expected, ds.LabelCatalog())
+
+	// Updates move the counts, deletes remove them
+	vlan.Labels["color"] = "blue"
+	assert.Nil(ds.Create(vlan))
+	assert.Nil(ds.Delete(lab))
+
+	expected = []labelstore.LabelCount{
+		{Key: "color", Value: "blue", Scope: vlans, Count: 1},
+		{Key: "system.group", Value: "eng", Scope: vlans, Count: 1},
+	}
+	assert.Equal(expected, ds.LabelCatalog())
+
+	// The catalog is built for databases which do not have one
+	assert.Nil(ds.Wipe())
+
+	db, err := bolt.Open(filepath.Join(root, store.DBFile), filestore.RWRR, nil)
+	assert.Nil(err)
+	assert.Nil(db.Update(func(tx *bolt.Tx) error { return tx.DeleteBucket([]byte("catalog")) }))
+	assert.Nil(db.Close())
+
+	ds = store.NewDBStore(root, store.DefaultFactory())
+	assert.Nil(ds.Initialize())
+	assert.Equal(expected, ds.LabelCatalog())
+	assert.Nil(ds.Wipe())
+}
+
+func TestNewBackend(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	for backend, expected := range map[string]interface{}{
+		"":                &store.ResourceStore{},
+		store.FileBackend: &store.ResourceStore{},
+		store.DBBackend:   &store.DBStore{},
+	} {
+		s, err := store.NewBackend(backend, "testbackend", store.DefaultFactory())
+		assert.Nil(err)
+		assert.IsType(expected, s)
+	}
+
+	s, err := store.NewBackend("tape", "testbackend", store.DefaultFactory())
+	assert.Nil(s)
+	assert.Equal(store.ErrBackend, err)
+}
@@ -0,0 +1,210 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/project-safari/zebra"
+)
+
+// LabelPrefix marks a label key where a property or a label can be used.
+const LabelPrefix = "label."
+
+// DefaultSortBy is the property query results are sorted by by default.
+const DefaultSortBy = "id"
+
+// cursor is the position of the last result of a page, it is handed out as
+// an opaque continue token.
+type cursor struct {
+	SortBy string `json:"s"`
+	Desc   bool   `json:"d"`
+	Value  string `json:"v"`
+	ID     string `json:"i"`
+}
+
+type pageEntry struct {
+	value string
+	res   zebra.Resource
+}
+
+// QueryPage returns a page of the resources matching the given function, all
+// resources match if it is nil. The page is computed under the store lock
+// from a single snapshot of the store.
+func (rs *ResourceStore) QueryPage(match func(zebra.Resource) bool, page zebra.PageRequest) (*zebra.Page, error) {
+	after, err := decodeCursor(&page)
+	if err != nil {
+		return nil, err
+	}
+
+	rs.lock.RLock()
+	defer rs.lock.RUnlock()
+
+	start := time.Now()
+	resMap, err := rs.ts.Load()
+
+	rs.observe(TypeStore, "load", start)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return paginate(resMap, match, page, after), nil
+}
+
+// paginate returns the page of the resources matching the given function,
+// after the cursor if not nil.
+func paginate(resMap *zebra.ResourceMap, match func(zebra.Resource) bool, page zebra.PageRequest,
+	after *cursor,
+) *zebra.Page {
+	entries := make([]pageEntry, 0)
+
+	for _, l := range resMap.Resources {
+		for _, res := range l.Resources {
+			if match == nil || match(res) {
+				val, _ := FieldValue(res, page.SortBy)
+				entries = append(entries, pageEntry{value: val, res: res})
+			}
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return comparePage(page.Desc, entries[i].value, entries[i].res.GetID(),
+			entries[j].value, entries[j].res.GetID()) < 0
+	})
+
+	// Skip the results up to and including the cursor
+	if after != nil {
+		start := sort.Search(len(entries), func(i int) bool {
+			return comparePage(page.Desc, entries[i].value, entries[i].res.GetID(), after.Value, after.ID) > 0
+		})
+		entries = entries[start:]
+	}
+
+	ret := &zebra.Page{Resources: make([]zebra.Resource, 0, len(entries)), Continue: ""}
+
+	if page.Limit != 0 && len(entries) > page.Limit {
+		entries = entries[:page.Limit]
+		last := entries[len(entries)-1]
+		ret.Continue = encodeCursor(&cursor{
+			SortBy: page.SortBy,
+			Desc:   page.Desc,
+			Value:  last.value,
+			ID:     last.res.GetID(),
+		})
+	}
+
+	for _, e := range entries {
+		ret.Resources = append(ret.Resources, e.res)
+	}
+
+	return ret
+}
+
+// FieldValue returns the value of the resource label if the key starts with
+// LabelPrefix, or the value of the resource property otherwise.
+func FieldValue(res zebra.Resource, key string) (string, bool) {
+	if strings.HasPrefix(strings.ToLower(key), LabelPrefix) {
+		val, ok := res.GetLabels()[key[len(LabelPrefix):]]
+
+		return val, ok
+	}
+
+	return PropertyValue(res, key)
+}
+
+// Compare two page entries by value and then by id.
+func comparePage(desc bool, aVal, aID, bVal, bID string) int {
+	c := compareValues(aVal, bVal)
+	if c == 0 {
+		c = strings.Compare(aID, bID)
+	}
+
+	if desc {
+		return -c
+	}
+
+	return c
+}
+
+// Kinds of page values, in the order they are sorted in.
+const (
+	numberValue = iota
+	ipValue
+	stringValue
+)
+
+// compareValues orders page values by kind first, numbers before IPs before
+// strings, and then by value within the kind. Unlike zebra.Compare this is a
+// total order, so that sorting and searching the pages agree even when the
+// values are of mixed kinds.
+func compareValues(a, b string) int {
+	kindA, kindB := valueKind(a), valueKind(b)
+
+	switch {
+	case kindA < kindB:
+		return -1
+	case kindA > kindB:
+		return 1
+	case kindA == stringValue:
+		return strings.Compare(a, b)
+	}
+
+	return zebra.Compare(a, b)
+}
+
+// valueKind returns the kind of the page value.
+func valueKind(val string) int {
+	if f, err := strconv.ParseFloat(val, 64); err == nil && !math.IsNaN(f) {
+		return numberValue
+	}
+
+	if net.ParseIP(val) != nil {
+		return ipValue
+	}
+
+	return stringValue
+}
+
+func encodeCursor(c *cursor) string {
+	b, _ := json.Marshal(c)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Decode the continue token, it must be for the same sort order as the page.
+// The page is checked and its sort order defaulted first.
+func decodeCursor(page *zebra.PageRequest) (*cursor, error) {
+	if page.Limit < 0 {
+		return nil, zebra.ErrInvalidPage
+	}
+
+	if page.SortBy == "" {
+		page.SortBy = DefaultSortBy
+	}
+
+	if page.Continue == "" {
+		return nil, nil //nolint:nilnil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(page.Continue)
+	if err != nil {
+		return nil, zebra.ErrInvalidPage
+	}
+
+	c := new(cursor)
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, zebra.ErrInvalidPage
+	}
+
+	if !strings.EqualFold(c.SortBy, page.SortBy) || c.Desc != page.Desc {
+		return nil, zebra.ErrInvalidPage
+	}
+
+	return c, nil
+}
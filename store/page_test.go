@@ -0,0 +1,151 @@
+package store_test
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/compute"
+	"github.com/project-safari/zebra/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func pageIDs(page *zebra.Page) []string {
+	ids := make([]string, 0, len(page.Resources))
+	for _, res := range page.Resources {
+		ids = append(ids, res.GetID())
+	}
+
+	return ids
+}
+
+func TestQueryPage(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testquerypage"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	rs := store.NewResourceStore(root, store.DefaultFactory())
+	assert.Nil(rs.Initialize())
+
+	servers := make([]*compute.Server, 0, 5)
+
+	for i := 0; i < 5; i++ {
+		s := compute.NewServer([]string{fmt.Sprint("sn", i), "model", fmt.Sprint("s", i)},
+			net.ParseIP(fmt.Sprintf("10.0.0.%d", 10-i)), zebra.Labels{"system.group": "eng", "rank": fmt.Sprint(i)})
+		servers = append(servers, s)
+		assert.Nil(rs.Create(s))
+	}
+
+	// Sort by property, IPs are compared as IPs
+	page, err := rs.QueryPage(nil, zebra.PageRequest{Limit: 2, SortBy: "boardIP"})
+	assert.Nil(err)
+	assert.Equal([]string{servers[4].ID, servers[3].ID}, pageIDs(page))
+	assert.NotEmpty(page.Continue)
+
+	// Resources created or deleted in between do not shift the next page
+	assert.Nil(rs.Delete(servers[4]))
+
+	extra := compute.NewServer([]string{"sn9", "model", "s9"}, net.ParseIP("10.0.0.1"), zebra.Labels{"system.group": "eng"})
+	assert.Nil(rs.Create(extra))
+
+	page, err = rs.QueryPage(nil, zebra.PageRequest{Limit: 2, Continue: page.Continue, SortBy: "boardIP"})
+	assert.Nil(err)
+	assert.Equal([]string{servers[2].ID, servers[1].ID}, pageIDs(page))
+
+	page, err = rs.QueryPage(nil, zebra.PageRequest{Limit: 2, Continue: page.Continue, SortBy: "boardIP"})
+	assert.Nil(err)
+	assert.Equal([]string{servers[0].ID}, pageIDs(page))
+	assert.Empty(page.Continue)
+
+	// Sort by label, descending, with a match function
+	match := func(res zebra.Resource) bool { return res.GetID() != extra.ID }
+	page, err = rs.QueryPage(match, zebra.PageRequest{SortBy: "label.rank", Desc: true})
+	assert.Nil(err)
+	assert.Equal([]string{servers[3].ID, servers[2].ID, servers[1].ID, servers[0].ID}, pageIDs(page))
+	assert.Empty(page.Continue)
+
+	// Default sort is by id
+	page, err = rs.QueryPage(nil, zebra.PageRequest{Limit: 1})
+	assert.Nil(err)
+	assert.Len(page.Resources, 1)
+
+	// The continue token must be for the same sort order
+	_, err = rs.QueryPage(nil, zebra.PageRequest{Continue: page.Continue, SortBy: "boardIP"})
+	assert.Equal(zebra.ErrInvalidPage, err)
+
+	_, err = rs.QueryPage(nil, zebra.PageRequest{Continue: page.Continue, Desc: true})
+	assert.Equal(zebra.ErrInvalidPage, err)
+
+	_, err = rs.QueryPage(nil, zebra.PageRequest{Continue: "not a token"})
+	assert.Equal(zebra.ErrInvalidPage, err)
+
+	_, err = rs.QueryPage(nil, zebra.PageRequest{Limit: -1})
+	assert.Equal(zebra.ErrInvalidPage, err)
+}
+
+// Values of mixed kinds are sorted by kind first, numbers before IPs before
+// strings, so that pages neither skip nor repeat resources.
+func TestQueryPageMixed(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testquerypagemixed"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	rs := store.NewResourceStore(root, store.DefaultFactory())
+	assert.Nil(rs.Initialize())
+
+	ids := map[string]string{}
+
+	for _, rank := range []string{"1a", "10.0.0.1", "10", "2", "NaN", "9.0.0.1", "b"} {
+		s := compute.NewServer([]string{"sn", "model", rank}, net.ParseIP("10.0.0.1"),
+			zebra.Labels{"system.group": "eng", "rank": rank})
+		assert.Nil(rs.Create(s))
+
+		ids[s.ID] = rank
+	}
+
+	ranks := []string{}
+	page := &zebra.Page{Resources: nil, Continue: ""}
+
+	for {
+		var err error
+
+		page, err = rs.QueryPage(nil, zebra.PageRequest{Limit: 1, Continue: page.Continue, SortBy: "label.rank"})
+		assert.Nil(err)
+
+		for _, id := range pageIDs(page) {
+			ranks = append(ranks, ids[id])
+		}
+
+		if page.Continue == "" {
+			break
+		}
+	}
+
+	assert.Equal([]string{"2", "10", "9.0.0.1", "10.0.0.1", "1a", "NaN", "b"}, ranks)
+}
+
+func TestFieldValue(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	s := compute.NewServer([]string{"sn", "modelA", "s"}, net.ParseIP("10.0.0.1"), zebra.Labels{"color": "red"})
+
+	val, ok := store.FieldValue(s, "label.color")
+	assert.True(ok)
+	assert.Equal("red", val)
+
+	_, ok = store.FieldValue(s, "label.owner")
+	assert.False(ok)
+
+	val, ok = store.FieldValue(s, "model")
+	assert.True(ok)
+	assert.Equal("modelA", val)
+}
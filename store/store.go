@@ -2,25 +2,56 @@ package store
 
 import (
 	"context"
+	"encoding"
+	"fmt"
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/project-safari/zebra"
 	"github.com/project-safari/zebra/filestore"
 	"github.com/project-safari/zebra/idstore"
 	"github.com/project-safari/zebra/labelstore"
+	"github.com/project-safari/zebra/propertystore"
 	"github.com/project-safari/zebra/typestore"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
+// Names of the stores whose operation latencies are recorded.
+const (
+	FileStore     = "FileStore"
+	IDStore       = "IDStore"
+	LabelStore    = "LabelStore"
+	TypeStore     = "TypeStore"
+	PropertyStore = "PropertyStore"
+	BoltDB        = "BoltDB"
+)
+
+// DefaultIndexes returns the property indexes of the ResourceStore, on the
+// properties resources are looked up by the most.
+func DefaultIndexes() []propertystore.Index {
+	return []propertystore.Index{
+		{Type: "", Property: "Status.Lease"},
+		{Type: "Server", Property: "SerialNumber"},
+		{Type: "Server", Property: "Model"},
+		{Type: "Switch", Property: "SerialNumber"},
+		{Type: "Switch", Property: "ManagementIP"},
+	}
+}
+
 type ResourceStore struct {
 	lock        sync.RWMutex
 	StorageRoot string
 	Factory     zebra.ResourceFactory
+	Indexes     []propertystore.Index
 	fs          *filestore.FileStore
 	ids         *idstore.IDStore
 	ls          *labelstore.LabelStore
 	ts          *typestore.TypeStore
+	ps          *propertystore.PropertyStore
+	events      *eventLog
+	latency     *prometheus.HistogramVec
 }
 
 func NewResourceStore(root string, factory zebra.ResourceFactory) *ResourceStore {
@@ -28,13 +59,40 @@ func NewResourceStore(root string, factory zebra.ResourceFactory) *ResourceStore
 		lock:        sync.RWMutex{},
 		StorageRoot: root,
 		Factory:     factory,
+		Indexes:     DefaultIndexes(),
 		fs:          nil,
 		ids:         nil,
 		ls:          nil,
 		ts:          nil,
+		ps:          nil,
+		events:      newEventLog(factory),
+		latency:     nil,
+	}
+}
+
+// RecordLatency records the latencies of the operations of the underlying
+// stores in the histogram, which must have the store and op labels.
+func (rs *ResourceStore) RecordLatency(h *prometheus.HistogramVec) {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+
+	rs.latency = h
+}
+
+// observe records the latency of the store operation which started at start.
+func (rs *ResourceStore) observe(store string, op string, start time.Time) {
+	if rs.latency != nil {
+		rs.latency.WithLabelValues(store, op).Observe(time.Since(start).Seconds())
 	}
 }
 
+// timed runs the store operation f and records its latency.
+func (rs *ResourceStore) timed(store string, op string, f func() error) error {
+	defer rs.observe(store, op, time.Now())
+
+	return f()
+}
+
 func (rs *ResourceStore) Initialize() error {
 	rs.lock.Lock()
 	defer rs.lock.Unlock()
@@ -44,7 +102,11 @@ func (rs *ResourceStore) Initialize() error {
 		return err
 	}
 
+	start := time.Now()
 	resources, err := rs.fs.Load()
+
+	rs.observe(FileStore, "load", start)
+
 	if err != nil {
 		return err
 	}
@@ -52,6 +114,7 @@ func (rs *ResourceStore) Initialize() error {
 	rs.ids = idstore.NewIDStore(resources)
 	rs.ls = labelstore.NewLabelStore(resources)
 	rs.ts = typestore.NewTypeStore(resources)
+	rs.ps = propertystore.NewPropertyStore(rs.Indexes, PropertyValue, resources)
 
 	return nil
 }
@@ -64,6 +127,7 @@ func (rs *ResourceStore) Wipe() error {
 	rs.ids = nil
 	rs.ls = nil
 	rs.ts = nil
+	rs.ps = nil
 
 	return nil
 }
@@ -88,7 +152,35 @@ func (rs *ResourceStore) Clear() error {
 		return err
 	}
 
-	return nil
+	return rs.ps.Clear()
+}
+
+// Return the resource version of the stored resource with the given id.
+func (rs *ResourceStore) currentVersion(id string) (uint64, bool) {
+	for _, l := range rs.ids.Query([]string{id}).Resources {
+		if len(l.Resources) != 0 {
+			return l.Resources[0].GetResourceVersion(), true
+		}
+	}
+
+	return 0, false
+}
+
+// Return whether a write creates or updates the resource, and the version the
+// resource gets. A write without a version overwrites the stored resource, a
+// write with a version other than the stored one fails with ErrConflict.
+// The current version is given, ok is false if the resource is not stored.
+func nextVersion(res zebra.Resource, current uint64, ok bool) (zebra.EventType, uint64, error) {
+	version := res.GetResourceVersion()
+
+	switch {
+	case version != 0 && (!ok || version != current):
+		return zebra.EventCreate, 0, zebra.ErrConflict
+	case ok:
+		return zebra.EventUpdate, current + 1, nil
+	default:
+		return zebra.EventCreate, 1, nil
+	}
 }
 
 // Return ResourceMap with resource type as key and list of resources as val.
@@ -96,69 +188,28 @@ func (rs *ResourceStore) Load() (*zebra.ResourceMap, error) {
 	rs.lock.RLock()
 	defer rs.lock.RUnlock()
 
+	defer rs.observe(TypeStore, "load", time.Now())
+
 	return rs.ts.Load()
 }
 
+// Create stores the resource, or updates it if it is already stored.
 func (rs *ResourceStore) Create(res zebra.Resource) error {
 	if res == nil || res.Validate(context.Background()) != nil {
 		return zebra.ErrInvalidResource
 	}
 
-	rs.lock.Lock()
-	defer rs.lock.Unlock()
-
-	err := rs.fs.Create(res)
-	if err != nil {
-		return err
-	}
-
-	err = rs.ids.Create(res)
-	if err != nil {
-		return err
-	}
-
-	err = rs.ls.Create(res)
-	if err != nil {
-		return err
-	}
-
-	err = rs.ts.Create(res)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return rs.commit([]txnOp{{del: false, res: res}})
 }
 
+// Delete deletes the resource, deleting a resource which is not stored is not
+// an error.
 func (rs *ResourceStore) Delete(res zebra.Resource) error {
 	if res == nil || res.Validate(context.Background()) != nil {
 		return zebra.ErrInvalidResource
 	}
 
-	rs.lock.Lock()
-	defer rs.lock.Unlock()
-
-	err := rs.fs.Delete(res)
-	if err != nil {
-		return err
-	}
-
-	err = rs.ids.Delete(res)
-	if err != nil {
-		return err
-	}
-
-	err = rs.ls.Delete(res)
-	if err != nil {
-		return err
-	}
-
-	err = rs.ts.Delete(res)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return rs.commit([]txnOp{{del: true, res: res}})
 }
 
 // Return all resources in a ResourceMap.
@@ -166,7 +217,11 @@ func (rs *ResourceStore) Query() *zebra.ResourceMap {
 	rs.lock.RLock()
 	defer rs.lock.RUnlock()
 
+	start := time.Now()
 	resMap, err := rs.ts.Load()
+
+	rs.observe(TypeStore, "load", start)
+
 	if err != nil {
 		return nil
 	}
@@ -183,7 +238,11 @@ func (rs *ResourceStore) QueryUUID(uuids []string) *zebra.ResourceMap {
 	rs.lock.RLock()
 	defer rs.lock.RUnlock()
 
+	start := time.Now()
 	resMap := rs.ids.Query(uuids)
+
+	rs.observe(IDStore, "query", start)
+
 	retMap := zebra.NewResourceMap(resMap.GetFactory())
 
 	zebra.CopyResourceMap(retMap, resMap)
@@ -196,7 +255,11 @@ func (rs *ResourceStore) QueryType(types []string) *zebra.ResourceMap {
 	rs.lock.RLock()
 	defer rs.lock.RUnlock()
 
+	start := time.Now()
 	resMap := rs.ts.Query(types)
+
+	rs.observe(TypeStore, "query", start)
+
 	retMap := zebra.NewResourceMap(resMap.GetFactory())
 
 	zebra.CopyResourceMap(retMap, resMap)
@@ -213,7 +276,11 @@ func (rs *ResourceStore) QueryLabel(query zebra.Query) (*zebra.ResourceMap, erro
 	rs.lock.RLock()
 	defer rs.lock.RUnlock()
 
+	start := time.Now()
 	resMap := rs.ls.Query(query)
+
+	rs.observe(LabelStore, "query", start)
+
 	retMap := zebra.NewResourceMap(resMap.GetFactory())
 
 	zebra.CopyResourceMap(retMap, resMap)
@@ -221,8 +288,20 @@ func (rs *ResourceStore) QueryLabel(query zebra.Query) (*zebra.ResourceMap, erro
 	return retMap, nil
 }
 
-// Return resources which match given property/value(s).
-// Naive search implementation, >= O(n) for n resources.
+// LabelCatalog returns the number of resources with each label value, by
+// type and group.
+func (rs *ResourceStore) LabelCatalog() []labelstore.LabelCount {
+	rs.lock.RLock()
+	defer rs.lock.RUnlock()
+
+	defer rs.observe(LabelStore, "catalog", time.Now())
+
+	return rs.ls.Catalog()
+}
+
+// Return resources which match given property/value(s). Indexed properties
+// are looked up in the PropertyStore, the resources of the types the property
+// is not indexed for are matched one by one.
 func (rs *ResourceStore) QueryProperty(query zebra.Query) (*zebra.ResourceMap, error) {
 	if err := query.Validate(); err != nil {
 		return nil, err
@@ -231,29 +310,31 @@ func (rs *ResourceStore) QueryProperty(query zebra.Query) (*zebra.ResourceMap, e
 	rs.lock.RLock()
 	defer rs.lock.RUnlock()
 
-	if query.Op == zebra.MatchEqual || query.Op == zebra.MatchIn {
-		return rs.propertyMatch(query, true)
-	}
+	start := time.Now()
+	retMap, indexed, ok := rs.ps.Query(query)
 
-	return rs.propertyMatch(query, false)
-}
+	rs.observe(PropertyStore, "query", start)
+
+	if ok && indexed == nil {
+		return retMap, nil
+	}
 
-func (rs *ResourceStore) propertyMatch(query zebra.Query, inVals bool) (*zebra.ResourceMap, error) {
+	start = time.Now()
 	resMap, err := rs.ts.Load()
+
+	rs.observe(TypeStore, "load", start)
+
 	if err != nil {
 		return nil, err
 	}
 
-	retMap := zebra.NewResourceMap(rs.Factory)
-
 	for t, l := range resMap.Resources {
-		for _, res := range l.Resources {
-			val := FieldByName(reflect.ValueOf(res).Elem(), query.Key).String()
-			inList := zebra.IsIn(val, query.Values)
+		if ok && zebra.IsIn(t, indexed) {
+			continue
+		}
 
-			if inVals && inList {
-				retMap.Add(res, t)
-			} else if !inVals && !inList {
+		for _, res := range l.Resources {
+			if MatchProperty(query, res) {
 				retMap.Add(res, t)
 			}
 		}
@@ -305,18 +386,11 @@ func FilterLabel(query zebra.Query, resMap *zebra.ResourceMap) (*zebra.ResourceM
 
 	retMap := zebra.NewResourceMap(resMap.GetFactory())
 
-	inVals := false
-
-	if query.Op == zebra.MatchEqual || query.Op == zebra.MatchIn {
-		inVals = true
-	}
-
 	for t, l := range resMap.Resources {
 		for _, res := range l.Resources {
-			labels := res.GetLabels()
-			matchIn := labels.MatchIn(query.Key, query.Values...)
+			val, ok := res.GetLabels()[query.Key]
 
-			if (inVals && matchIn) || (!inVals && !matchIn) {
+			if query.Match(val, ok) {
 				retMap.Add(res, t)
 			}
 		}
@@ -325,7 +399,8 @@ func FilterLabel(query zebra.Query, resMap *zebra.ResourceMap) (*zebra.ResourceM
 	return retMap, nil
 }
 
-// Filter given map by property name (case insensitive) and val.
+// Filter given map by property name (case insensitive) and val. Nested
+// properties are separated by dots, e.g. "Status.Lease".
 func FilterProperty(query zebra.Query, resMap *zebra.ResourceMap) (*zebra.ResourceMap, error) {
 	if err := query.Validate(); err != nil {
 		return resMap, err
@@ -333,18 +408,9 @@ func FilterProperty(query zebra.Query, resMap *zebra.ResourceMap) (*zebra.Resour
 
 	retMap := zebra.NewResourceMap(resMap.GetFactory())
 
-	inVals := false
-
-	if query.Op == zebra.MatchEqual || query.Op == zebra.MatchIn {
-		inVals = true
-	}
-
 	for t, l := range resMap.Resources {
 		for _, res := range l.Resources {
-			val := FieldByName(reflect.ValueOf(res).Elem(), query.Key).String()
-			matchIn := zebra.IsIn(val, query.Values)
-
-			if (inVals && matchIn) || (!inVals && !matchIn) {
+			if MatchProperty(query, res) {
 				retMap.Add(res, t)
 			}
 		}
@@ -362,3 +428,59 @@ func FieldByName(v reflect.Value, field string) reflect.Value {
 			return strings.ToLower(found) == field
 		})
 }
+
+// PropertyValue returns the value of the resource property as a string.
+// Property names are case insensitive and nested properties are separated by
+// dots, e.g. "Credentials.Name". Values which can marshal themselves to text,
+// like IPs and status fields, are returned in their text form. Returns false
+// if the resource does not have the property.
+func PropertyValue(res zebra.Resource, key string) (string, bool) {
+	v := reflect.ValueOf(res)
+
+	for _, field := range strings.Split(key, ".") {
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return "", false
+			}
+
+			v = v.Elem()
+		}
+
+		if v.Kind() != reflect.Struct {
+			return "", false
+		}
+
+		if v = FieldByName(v, field); !v.IsValid() || !v.CanInterface() {
+			return "", false
+		}
+	}
+
+	if v.CanAddr() {
+		if m, ok := v.Addr().Interface().(encoding.TextMarshaler); ok {
+			return marshalText(m)
+		}
+	}
+
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		return marshalText(m)
+	}
+
+	return fmt.Sprint(v.Interface()), true
+}
+
+// MatchProperty returns true if the resource property matches the query, see
+// PropertyValue for the property names.
+func MatchProperty(query zebra.Query, res zebra.Resource) bool {
+	val, ok := PropertyValue(res, query.Key)
+
+	return query.Match(val, ok)
+}
+
+func marshalText(m encoding.TextMarshaler) (string, bool) {
+	b, err := m.MarshalText()
+	if err != nil {
+		return "", false
+	}
+
+	return string(b), true
+}
@@ -2,14 +2,21 @@ package store_test
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
 	"github.com/project-safari/zebra/cmd/herd/pkg"
+	"github.com/project-safari/zebra/compute"
 	"github.com/project-safari/zebra/dc"
+	"github.com/project-safari/zebra/lease"
 	"github.com/project-safari/zebra/network"
 	"github.com/project-safari/zebra/store"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -504,7 +511,299 @@ func TestQueryProperty(t *testing.T) {
 	assert.Nil(err)
 	assert.Equal(0, len(resMap.Resources))
 
-	resMap, err = rs.QueryProperty(zebra.Query{Op: 0x7, Key: "", Values: []string{""}})
+	resMap, err = rs.QueryProperty(zebra.Query{Op: 0x10, Key: "", Values: []string{""}})
 	assert.Nil(resMap)
 	assert.NotNil(err)
 }
+
+func TestLeaseRestart(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "teststorelease"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	rs := store.NewResourceStore(root, store.DefaultFactory())
+	assert.Nil(rs.Initialize())
+
+	vlan := getVLAN()
+	vlan.Labels = zebra.Labels{"system.group": "eng"}
+	assert.Nil(rs.Create(vlan))
+
+	owner := auth.NewUser("tester", "tester@zebra.project-safari.io", "Riddikulus!1", nil, nil)
+	priv, err := auth.NewPriv("VLANPool/eng", false, true, true, false)
+	assert.Nil(err)
+
+	owner.Role.Privileges = append(owner.Role.Privileges, priv)
+	l := lease.NewLease(*owner, time.Hour, []*lease.ResourceReq{
+		{Type: "VLANPool", Group: "eng", Name: "vlan", Count: 1},
+	})
+	_, err = lease.NewAllocator(rs).Allocate(l)
+	assert.Nil(err)
+
+	// Restart the store, lease must be loaded with its resources
+	rs = store.NewResourceStore(root, store.DefaultFactory())
+	assert.Nil(rs.Initialize())
+
+	leases := rs.QueryType([]string{"Lease"}).Resources["Lease"]
+	assert.NotNil(leases)
+	assert.Len(leases.Resources, 1)
+
+	loaded, ok := leases.Resources[0].(*lease.Lease)
+	assert.True(ok)
+	assert.Equal(l.ID, loaded.ID)
+	assert.True(loaded.IsValid())
+	assert.Equal(owner.Email, loaded.Owner())
+	assert.True(loaded.IsSatisfied())
+	assert.True(loaded.CanLease(vlan))
+
+	res, ok := loaded.Request[0].Resources[0].(*network.VLANPool)
+	assert.True(ok)
+	assert.Equal(vlan.ID, res.ID)
+	assert.Equal(zebra.Leased, res.Status.Lease)
+
+	// Released lease frees the stored resource
+	_, _, err = lease.NewAllocator(rs).Release(loaded)
+	assert.Nil(err)
+
+	stored := rs.QueryUUID([]string{vlan.ID}).Resources["VLANPool"].Resources[0]
+	assert.Equal(zebra.Free, stored.GetStatus().Lease)
+}
+
+func TestPropertyValue(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	server := compute.NewServer([]string{"serial", "modelA", "server1"}, net.ParseIP("10.1.2.3"), nil)
+	server.Status.Lease = zebra.Free
+
+	val, ok := store.PropertyValue(server, "model")
+	assert.True(ok)
+	assert.Equal("modelA", val)
+
+	val, ok = store.PropertyValue(server, "Status.Lease")
+	assert.True(ok)
+	assert.Equal("free", val)
+
+	val, ok = store.PropertyValue(server, "credentials.name")
+	assert.True(ok)
+	assert.Equal("server1", val)
+
+	val, ok = store.PropertyValue(server, "BoardIP")
+	assert.True(ok)
+	assert.Equal("10.1.2.3", val)
+
+	_, ok = store.PropertyValue(server, "Model.Name")
+	assert.False(ok)
+
+	_, ok = store.PropertyValue(server, "Status.Unknown")
+	assert.False(ok)
+
+	in := func(key string, values ...string) bool {
+		return store.MatchProperty(zebra.Query{Op: zebra.MatchIn, Key: key, Values: values}, server)
+	}
+
+	assert.True(in("Status.Lease", "leased", "free"))
+	assert.False(in("Status.Lease", "leased"))
+	assert.False(in("Unknown", ""))
+
+	// IPs are compared as IPs and match the subnets that contain them
+	assert.True(in("BoardIP", "::ffff:10.1.2.3"))
+	assert.True(in("BoardIP", "10.1.0.0/16"))
+	assert.False(in("BoardIP", "10.2.0.0/16", "10.1.2.4"))
+
+	greater := zebra.Query{Op: zebra.MatchGreater, Key: "BoardIP", Values: []string{"10.1.2.0"}}
+	assert.True(store.MatchProperty(greater, server))
+
+	exists := zebra.Query{Op: zebra.MatchExists, Key: "Model", Values: nil}
+	assert.True(store.MatchProperty(exists, server))
+
+	exists.Key = "Unknown"
+	assert.False(store.MatchProperty(exists, server))
+
+	other := compute.NewServer([]string{"serial2", "modelB", "server2"}, net.ParseIP("10.2.2.3"), nil)
+	resMap := zebra.NewResourceMap(nil)
+	resMap.Add(server, "Server")
+	resMap.Add(other, "Server")
+
+	query := zebra.Query{Op: zebra.MatchIn, Key: "BoardIP", Values: []string{"10.2.0.0/16"}}
+	filtered, err := store.FilterProperty(query, resMap)
+	assert.Nil(err)
+	assert.Len(filtered.Resources["Server"].Resources, 1)
+	assert.Equal(other.ID, filtered.Resources["Server"].Resources[0].GetID())
+
+	query = zebra.Query{Op: zebra.MatchNotEqual, Key: "Credentials.Name", Values: []string{"server2"}}
+	filtered, err = store.FilterProperty(query, resMap)
+	assert.Nil(err)
+	assert.Len(filtered.Resources["Server"].Resources, 1)
+	assert.Equal(server.ID, filtered.Resources["Server"].Resources[0].GetID())
+}
+
+func TestResourceVersion(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testresourceversion"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	rs := store.NewResourceStore(root, store.DefaultFactory())
+	assert.Nil(rs.Initialize())
+
+	vlan := getVLAN()
+	vlan.Labels = zebra.Labels{"system.group": "eng"}
+
+	// A new resource cannot carry a version
+	vlan.ResourceVersion = 1
+	assert.Equal(zebra.ErrConflict, rs.Create(vlan))
+
+	vlan.ResourceVersion = 0
+	assert.Nil(rs.Create(vlan))
+	assert.Equal(uint64(1), vlan.ResourceVersion)
+
+	// Two writers editing the same version, the second one conflicts
+	first := getVLAN()
+	first.BaseResource = vlan.BaseResource
+	first.Labels = zebra.Labels{"system.group": "eng", "owner": "first"}
+
+	second := getVLAN()
+	second.BaseResource = vlan.BaseResource
+	second.Labels = zebra.Labels{"system.group": "eng", "owner": "second"}
+
+	assert.Nil(rs.Create(first))
+	assert.Equal(uint64(2), first.ResourceVersion)
+	assert.Equal(zebra.ErrConflict, rs.Create(second))
+	assert.Equal(uint64(1), second.ResourceVersion)
+	assert.Equal(zebra.ErrConflict, rs.Delete(second))
+
+	// A write without a version overwrites
+	second.ResourceVersion = 0
+	assert.Nil(rs.Create(second))
+	assert.Equal(uint64(3), second.ResourceVersion)
+
+	stored := rs.QueryUUID([]string{vlan.ID}).Resources["VLANPool"].Resources[0]
+	assert.Equal("second", stored.GetLabels()["owner"])
+
+	// Versions are persisted
+	assert.Nil(rs.Initialize())
+
+	stored = rs.QueryUUID([]string{vlan.ID}).Resources["VLANPool"].Resources[0]
+	assert.Equal(uint64(3), stored.GetResourceVersion())
+	assert.Nil(rs.Delete(stored))
+}
+
+func TestRecordLatency(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testrecordlatency"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	latency := newLatency()
+
+	rs := store.NewResourceStore(root, store.DefaultFactory())
+	rs.RecordLatency(latency)
+	assert.Nil(rs.Initialize())
+	assert.Equal(uint64(1), observations(assert, latency, store.FileStore, "load"))
+
+	vlan := getVLAN()
+	vlan.Labels = zebra.Labels{"system.group": "eng"}
+	assert.Nil(rs.Create(vlan))
+	assert.Nil(rs.Delete(vlan))
+
+	// Files are written in a single batch per write
+	assert.Equal(uint64(2), observations(assert, latency, store.FileStore, "commit"))
+
+	for _, s := range []string{store.IDStore, store.LabelStore, store.TypeStore} {
+		assert.Equal(uint64(1), observations(assert, latency, s, "create"))
+		assert.Equal(uint64(1), observations(assert, latency, s, "delete"))
+	}
+
+	rs.QueryUUID([]string{vlan.ID})
+	rs.QueryType([]string{"VLANPool"})
+	_, err := rs.QueryLabel(zebra.Query{Op: zebra.MatchEqual, Key: "color", Values: []string{"red"}})
+	assert.Nil(err)
+
+	assert.Equal(uint64(1), observations(assert, latency, store.IDStore, "query"))
+	assert.Equal(uint64(1), observations(assert, latency, store.TypeStore, "query"))
+	assert.Equal(uint64(1), observations(assert, latency, store.LabelStore, "query"))
+}
+
+func TestQueryIndexedProperty(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "teststoreindexes"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	rs := store.NewResourceStore(root, store.DefaultFactory())
+	assert.Nil(rs.Initialize())
+
+	latency := newLatency()
+	rs.RecordLatency(latency)
+
+	servers := pkg.GenerateServer(2)
+	switches := pkg.GenerateSwitch(2)
+
+	for _, res := range append(servers, switches...) {
+		assert.Nil(rs.Create(res))
+	}
+
+	server, ok := servers[0].(*compute.Server)
+	assert.True(ok)
+
+	sw, ok := switches[0].(*network.Switch)
+	assert.True(ok)
+
+	// Models are indexed for servers only, switches are matched one by one
+	sw.Model = server.Model
+	assert.Nil(rs.Create(sw))
+
+	resMap, err := rs.QueryProperty(zebra.Query{Key: "model", Op: zebra.MatchEqual, Values: []string{server.Model}})
+	assert.Nil(err)
+	assert.Contains(resMap.Resources["Server"].Resources, server)
+	assert.Contains(resMap.Resources["Switch"].Resources, sw)
+
+	// Lease states are indexed for all types
+	status := server.GetStatus()
+	status.Lease = zebra.Leased
+	server.SetStatus(status)
+	assert.Nil(rs.Create(server))
+
+	resMap, err = rs.QueryProperty(zebra.Query{Key: "Status.Lease", Op: zebra.MatchEqual, Values: []string{"leased"}})
+	assert.Nil(err)
+	assert.Len(resMap.Resources, 1)
+	assert.Equal([]zebra.Resource{server}, resMap.Resources["Server"].Resources)
+	assert.Equal(uint64(2), observations(assert, latency, store.PropertyStore, "query"))
+
+	// The indexes are rebuilt on restart
+	rs = store.NewResourceStore(root, store.DefaultFactory())
+	assert.Nil(rs.Initialize())
+
+	resMap, err = rs.QueryProperty(zebra.Query{Key: "Status.Lease", Op: zebra.MatchEqual, Values: []string{"leased"}})
+	assert.Nil(err)
+	assert.Len(resMap.Resources["Server"].Resources, 1)
+	assert.Equal(server.ID, resMap.Resources["Server"].Resources[0].GetID())
+}
+
+func newLatency() *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{ //nolint:exhaustivestruct,exhaustruct
+		Name: "latency",
+		Help: "Latency of store operations.",
+	}, []string{"store", "op"})
+}
+
+// observations returns the number of latencies observed for the store
+// operation.
+func observations(assert *assert.Assertions, h *prometheus.HistogramVec, name string, op string) uint64 {
+	metric, ok := h.WithLabelValues(name, op).(prometheus.Metric)
+	assert.True(ok)
+
+	out := new(dto.Metric)
+	assert.Nil(metric.Write(out))
+
+	return out.GetHistogram().GetSampleCount()
+}
@@ -0,0 +1,260 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/filestore"
+	"github.com/project-safari/zebra/idstore"
+	"github.com/project-safari/zebra/labelstore"
+	"github.com/project-safari/zebra/propertystore"
+	"github.com/project-safari/zebra/typestore"
+)
+
+// txnOp is a staged create, or delete if del is set, of a resource.
+type txnOp struct {
+	del bool
+	res zebra.Resource
+}
+
+// Txn is a transaction of a store, see zebra.Txn. The staged operations are
+// applied by the commit function of the store.
+type Txn struct {
+	lock   sync.Mutex
+	commit func([]txnOp) error
+	ops    []txnOp
+	done   bool
+}
+
+func newTxn(commit func([]txnOp) error) *Txn {
+	return &Txn{
+		lock:   sync.Mutex{},
+		commit: commit,
+		ops:    []txnOp{},
+		done:   false,
+	}
+}
+
+// Begin starts a transaction, nothing is written until it is committed.
+func (rs *ResourceStore) Begin() zebra.Txn {
+	return newTxn(rs.commit)
+}
+
+// Create stages the creation, or the update, of the resource.
+func (t *Txn) Create(res zebra.Resource) error {
+	return t.stage(txnOp{del: false, res: res})
+}
+
+// Delete stages the deletion of the resource.
+func (t *Txn) Delete(res zebra.Resource) error {
+	return t.stage(txnOp{del: true, res: res})
+}
+
+func (t *Txn) stage(op txnOp) error {
+	if op.res == nil || op.res.Validate(context.Background()) != nil {
+		return zebra.ErrInvalidResource
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.done {
+		return zebra.ErrTxnDone
+	}
+
+	t.ops = append(t.ops, op)
+
+	return nil
+}
+
+// Commit applies the staged creates and deletes, either all of them or none.
+// If any resource version is stale, ErrConflict is returned and nothing is
+// written.
+func (t *Txn) Commit() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.done {
+		return zebra.ErrTxnDone
+	}
+
+	t.done = true
+
+	return t.commit(t.ops)
+}
+
+// Rollback drops the staged creates and deletes.
+func (t *Txn) Rollback() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.done = true
+	t.ops = nil
+}
+
+// stagedVersion is the version of a resource after a staged write, ok is
+// false if the resource is deleted.
+type stagedVersion struct {
+	version uint64
+	ok      bool
+}
+
+// commit applies the operations atomically. The versions are checked and set
+// first, then the files are written as a single batch and finally the indexes
+// are updated and the events sent. If the files cannot be written, the old
+// versions are restored. If the files are written but the journal of the
+// batch is left behind, the commit is complete and the journal error is
+// returned.
+func (rs *ResourceStore) commit(ops []txnOp) error {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+
+	events, restore, err := stageVersions(ops, rs.currentVersion)
+	if err != nil {
+		return err
+	}
+
+	err = rs.write(ops)
+	if err != nil && !errors.Is(err, filestore.ErrJournalRemove) {
+		restore()
+
+		return err
+	}
+
+	rs.index(ops)
+
+	for i, op := range ops {
+		rs.events.notify(events[i], op.res)
+	}
+
+	return err
+}
+
+// stageVersions checks the versions of the operations against the current
+// versions of the stored resources, taking earlier operations into account,
+// and sets the new versions. It returns the event of each operation and a
+// function restoring the old versions. If a version is stale, ErrConflict is
+// returned and the versions are left unchanged.
+func stageVersions(ops []txnOp, current func(id string) (uint64, bool)) ([]zebra.EventType, func(), error) {
+	events := make([]zebra.EventType, len(ops))
+	oldVersions := make([]uint64, len(ops))
+	staged := make(map[string]stagedVersion)
+
+	restoreN := func(n int) {
+		for i := n - 1; i >= 0; i-- {
+			ops[i].res.SetResourceVersion(oldVersions[i])
+		}
+	}
+
+	for i, op := range ops {
+		id := op.res.GetID()
+		oldVersions[i] = op.res.GetResourceVersion()
+
+		// Earlier writes in the transaction are taken into account
+		cur, ok := current(id)
+		if s, found := staged[id]; found {
+			cur, ok = s.version, s.ok
+		}
+
+		if op.del {
+			if version := op.res.GetResourceVersion(); version != 0 && ok && cur != version {
+				restoreN(i)
+
+				return nil, nil, zebra.ErrConflict
+			}
+
+			events[i] = zebra.EventDelete
+			staged[id] = stagedVersion{version: 0, ok: false}
+
+			continue
+		}
+
+		eventType, version, err := nextVersion(op.res, cur, ok)
+		if err != nil {
+			restoreN(i)
+
+			return nil, nil, err
+		}
+
+		events[i] = eventType
+		staged[id] = stagedVersion{version: version, ok: true}
+
+		op.res.SetResourceVersion(version)
+	}
+
+	return events, func() { restoreN(len(ops)) }, nil
+}
+
+// write writes the final state of each resource to the file store in a single
+// batch.
+func (rs *ResourceStore) write(ops []txnOp) error {
+	final := make(map[string]txnOp)
+	order := []string{}
+
+	for _, op := range ops {
+		id := op.res.GetID()
+		if _, ok := final[id]; !ok {
+			order = append(order, id)
+		}
+
+		final[id] = op
+	}
+
+	creates, deletes := []zebra.Resource{}, []zebra.Resource{}
+
+	for _, id := range order {
+		if op := final[id]; op.del {
+			deletes = append(deletes, op.res)
+		} else {
+			creates = append(creates, op.res)
+		}
+	}
+
+	return rs.timed(FileStore, "commit", func() error { return rs.fs.Apply(creates, deletes) })
+}
+
+// index applies the operations to the in memory indexes, in order. The file
+// store is the source of truth, if an index cannot be updated, all indexes
+// are rebuilt from it so that they never get out of sync with it.
+func (rs *ResourceStore) index(ops []txnOp) {
+	for _, op := range ops {
+		for _, idx := range []struct {
+			name   string
+			create func(zebra.Resource) error
+			delete func(zebra.Resource) error
+		}{
+			{IDStore, rs.ids.Create, rs.ids.Delete},
+			{LabelStore, rs.ls.Create, rs.ls.Delete},
+			{TypeStore, rs.ts.Create, rs.ts.Delete},
+			{PropertyStore, rs.ps.Create, rs.ps.Delete},
+		} {
+			apply, name := idx.create, "create"
+			if op.del {
+				apply, name = idx.delete, "delete"
+			}
+
+			if err := rs.timed(idx.name, name, func() error { return apply(op.res) }); err != nil {
+				_ = rs.reindex()
+
+				return
+			}
+		}
+	}
+}
+
+// reindex rebuilds the in memory indexes from the file store.
+func (rs *ResourceStore) reindex() error {
+	resources, err := rs.fs.Load()
+	if err != nil {
+		return err
+	}
+
+	rs.ids = idstore.NewIDStore(resources)
+	rs.ls = labelstore.NewLabelStore(resources)
+	rs.ts = typestore.NewTypeStore(resources)
+	rs.ps = propertystore.NewPropertyStore(rs.Indexes, PropertyValue, resources)
+
+	return nil
+}
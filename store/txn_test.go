@@ -0,0 +1,121 @@
+package store_test
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/network"
+	"github.com/project-safari/zebra/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func groupVLAN() *network.VLANPool {
+	vlan := getVLAN()
+	vlan.Labels = zebra.Labels{"system.group": "eng"}
+
+	return vlan
+}
+
+func countVLANs(rs *store.ResourceStore) int {
+	list, ok := rs.QueryType([]string{"VLANPool"}).Resources["VLANPool"]
+	if !ok {
+		return 0
+	}
+
+	return len(list.Resources)
+}
+
+func TestTxn(t *testing.T) { //nolint:funlen
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testtxn"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	rs := store.NewResourceStore(root, store.DefaultFactory())
+	assert.Nil(rs.Initialize())
+
+	events, cancel, err := rs.Watch(0)
+	assert.Nil(err)
+
+	defer cancel()
+
+	// Nothing is written until the transaction is committed
+	first, second := groupVLAN(), groupVLAN()
+	txn := rs.Begin()
+	assert.Nil(txn.Create(first))
+	assert.Nil(txn.Create(second))
+	assert.Equal(zebra.ErrInvalidResource, txn.Create(getVLAN()))
+	assert.Equal(0, countVLANs(rs))
+
+	assert.Nil(txn.Commit())
+	assert.Equal(2, countVLANs(rs))
+	assert.Equal(uint64(1), first.ResourceVersion)
+	assert.Equal(zebra.ErrTxnDone, txn.Commit())
+	assert.Equal(zebra.ErrTxnDone, txn.Create(groupVLAN()))
+
+	for _, id := range []string{first.ID, second.ID} {
+		e := <-events
+		assert.Equal(zebra.EventCreate, e.Type)
+		assert.Equal(id, e.Resource.GetID())
+	}
+
+	// Rolled back transactions write nothing
+	txn = rs.Begin()
+	assert.Nil(txn.Create(groupVLAN()))
+	txn.Rollback()
+	assert.Equal(zebra.ErrTxnDone, txn.Commit())
+	assert.Equal(2, countVLANs(rs))
+
+	// A stale version fails the whole transaction
+	added := groupVLAN()
+	stale := &network.VLANPool{BaseResource: first.BaseResource, RangeStart: 0, RangeEnd: 5}
+	stale.ResourceVersion = 7
+
+	txn = rs.Begin()
+	assert.Nil(txn.Create(added))
+	assert.Nil(txn.Delete(second))
+	assert.Nil(txn.Create(stale))
+	assert.Equal(zebra.ErrConflict, txn.Commit())
+	assert.Equal(2, countVLANs(rs))
+	assert.Equal(uint64(0), added.ResourceVersion)
+	assert.Equal(uint64(7), stale.ResourceVersion)
+	assert.Empty(rs.QueryUUID([]string{added.ID}).Resources)
+
+	// Writes of the same resource in a transaction build on each other
+	txn = rs.Begin()
+	assert.Nil(txn.Create(first))
+	assert.Nil(txn.Create(first))
+	assert.Nil(txn.Delete(second))
+	assert.Nil(txn.Create(added))
+	assert.Nil(txn.Delete(added))
+	assert.Nil(txn.Commit())
+	assert.Equal(uint64(3), first.ResourceVersion)
+	assert.Equal(1, countVLANs(rs))
+
+	for _, eventType := range []zebra.EventType{
+		zebra.EventUpdate, zebra.EventUpdate, zebra.EventDelete, zebra.EventCreate, zebra.EventDelete,
+	} {
+		assert.Equal(eventType, (<-events).Type)
+	}
+
+	// A failed write leaves the store and the versions as they were
+	broken := groupVLAN()
+	assert.Nil(os.RemoveAll(path.Join(root, "resources", broken.ID[:2])))
+
+	txn = rs.Begin()
+	assert.Nil(txn.Create(first))
+	assert.Nil(txn.Create(broken))
+	assert.NotNil(txn.Commit())
+	assert.Equal(uint64(3), first.ResourceVersion)
+	assert.Equal(1, countVLANs(rs))
+
+	// The indexes and the files agree
+	loaded := store.NewResourceStore(root, store.DefaultFactory())
+	assert.Nil(loaded.Initialize())
+	assert.Equal(1, countVLANs(loaded))
+	assert.Equal(uint64(3), loaded.QueryUUID([]string{first.ID}).Resources["VLANPool"].Resources[0].GetResourceVersion())
+}
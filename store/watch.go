@@ -0,0 +1,133 @@
+package store
+
+import (
+	"sync"
+
+	"github.com/project-safari/zebra"
+)
+
+// DefaultWatchHistory is the number of recent events kept so that watchers
+// can resume from an earlier revision.
+const DefaultWatchHistory = 1024
+
+// watchBuffer is the number of events a watcher can fall behind by before it
+// is dropped, a dropped watcher has its channel closed and must resume.
+const watchBuffer = 64
+
+// eventLog keeps the store revision, the recent events and the watchers. It
+// is protected by the resource store lock.
+type eventLog struct {
+	factory  zebra.ResourceFactory
+	revision uint64
+	history  []zebra.Event
+	watchers map[chan zebra.Event]struct{}
+}
+
+func newEventLog(factory zebra.ResourceFactory) *eventLog {
+	return &eventLog{
+		factory:  factory,
+		revision: 0,
+		history:  make([]zebra.Event, 0, DefaultWatchHistory),
+		watchers: make(map[chan zebra.Event]struct{}),
+	}
+}
+
+// notify records a change with the next revision and sends it to all the
+// watchers, watchers that are not keeping up are dropped. Events are sent
+// later on and resources may change since, so the event has a copy of the
+// resource as it is now.
+func (el *eventLog) notify(eventType zebra.EventType, res zebra.Resource) {
+	el.revision++
+
+	if snapshot, err := zebra.CopyResource(el.factory, res); err == nil {
+		res = snapshot
+	}
+
+	event := zebra.Event{Revision: el.revision, Type: eventType, Resource: res}
+
+	if len(el.history) == DefaultWatchHistory {
+		copy(el.history, el.history[1:])
+		el.history = el.history[:DefaultWatchHistory-1]
+	}
+
+	el.history = append(el.history, event)
+
+	for ch := range el.watchers {
+		select {
+		case ch <- event:
+		default:
+			delete(el.watchers, ch)
+			close(ch)
+		}
+	}
+}
+
+// since returns the events after the given revision, or ErrRevisionGone if
+// some of them are no longer in the history.
+func (el *eventLog) since(revision uint64) ([]zebra.Event, error) {
+	if revision > el.revision {
+		return nil, zebra.ErrRevisionGone
+	}
+
+	if revision == el.revision {
+		return nil, nil
+	}
+
+	if len(el.history) == 0 || el.history[0].Revision > revision+1 {
+		return nil, zebra.ErrRevisionGone
+	}
+
+	return el.history[revision+1-el.history[0].Revision:], nil
+}
+
+// Watch returns a channel of the store events after the given revision, or
+// only of new events if the revision is 0, and a function to stop watching.
+// The channel is closed if the watcher falls behind, it can then resume from
+// the last revision it has seen.
+func (rs *ResourceStore) Watch(since uint64) (<-chan zebra.Event, func(), error) {
+	return rs.events.watch(&rs.lock, since)
+}
+
+// watch adds a watcher of the events after the given revision, lock is the
+// lock of the store protecting the event log.
+func (el *eventLog) watch(lock sync.Locker, since uint64) (<-chan zebra.Event, func(), error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	var events []zebra.Event
+
+	if since != 0 {
+		var err error
+
+		if events, err = el.since(since); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	ch := make(chan zebra.Event, len(events)+watchBuffer)
+	for _, e := range events {
+		ch <- e
+	}
+
+	el.watchers[ch] = struct{}{}
+
+	cancel := func() {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if _, ok := el.watchers[ch]; ok {
+			delete(el.watchers, ch)
+			close(ch)
+		}
+	}
+
+	return ch, cancel, nil
+}
+
+// Revision returns the revision of the last change to the store.
+func (rs *ResourceStore) Revision() uint64 {
+	rs.lock.RLock()
+	defer rs.lock.RUnlock()
+
+	return rs.events.revision
+}
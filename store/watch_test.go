@@ -0,0 +1,112 @@
+package store_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/network"
+	"github.com/project-safari/zebra/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatch(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testwatch"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	rs := store.NewResourceStore(root, store.DefaultFactory())
+	assert.Nil(rs.Initialize())
+
+	events, cancel, err := rs.Watch(0)
+	assert.Nil(err)
+
+	vlan := getVLAN()
+	vlan.Labels = zebra.Labels{"system.group": "eng"}
+	assert.Nil(rs.Create(vlan))
+
+	vlan.RangeEnd = 5
+	assert.Nil(rs.Create(vlan))
+	assert.Nil(rs.Delete(vlan))
+
+	// Events have the resource as it was when it changed
+	vlan.RangeEnd = 7
+
+	for i, eventType := range []zebra.EventType{zebra.EventCreate, zebra.EventUpdate, zebra.EventDelete} {
+		e := <-events
+		assert.Equal(uint64(i+1), e.Revision)
+		assert.Equal(eventType, e.Type)
+		assert.Equal(vlan.ID, e.Resource.GetID())
+		assert.Equal([]uint64{1, 2, 2}[i], e.Resource.GetResourceVersion())
+
+		pool, ok := e.Resource.(*network.VLANPool)
+		assert.True(ok)
+		assert.NotEqual(uint16(7), pool.RangeEnd)
+	}
+
+	assert.Equal(uint64(3), rs.Revision())
+
+	cancel()
+	cancel()
+
+	_, ok := <-events
+	assert.False(ok)
+
+	// Resume after the first event
+	events, cancel, err = rs.Watch(1)
+	assert.Nil(err)
+
+	defer cancel()
+
+	assert.Equal(uint64(2), (<-events).Revision)
+	assert.Equal(uint64(3), (<-events).Revision)
+
+	// Revisions in the future are not available
+	_, _, err = rs.Watch(4)
+	assert.Equal(zebra.ErrRevisionGone, err)
+}
+
+func TestWatchHistory(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testwatchhistory"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	rs := store.NewResourceStore(root, store.DefaultFactory())
+	assert.Nil(rs.Initialize())
+
+	slow, _, err := rs.Watch(0)
+	assert.Nil(err)
+
+	vlan := getVLAN()
+	vlan.Labels = zebra.Labels{"system.group": "eng"}
+	for i := 0; i < store.DefaultWatchHistory+2; i++ {
+		vlan.RangeEnd = uint16(i)
+		assert.Nil(rs.Create(vlan))
+	}
+
+	// The watcher fell behind and was dropped
+	count := 0
+	for range slow {
+		count++
+	}
+
+	assert.Less(count, store.DefaultWatchHistory)
+
+	// The oldest revisions are no longer in the history
+	_, _, err = rs.Watch(1)
+	assert.Equal(zebra.ErrRevisionGone, err)
+
+	events, cancel, err := rs.Watch(2)
+	assert.Nil(err)
+
+	defer cancel()
+
+	assert.Equal(uint64(3), (<-events).Revision)
+	assert.Len(events, store.DefaultWatchHistory-1)
+}
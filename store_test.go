@@ -16,7 +16,7 @@ func TestValidateStore(t *testing.T) {
 	assert.NotNil(q)
 	assert.NotNil(q.Validate())
 
-	q.Op = 8
+	q.Op = 10
 	assert.NotNil(q.Validate())
 
 	q.Op = zebra.MatchEqual
@@ -67,3 +67,55 @@ func TestUnmarshalQuery(t *testing.T) {
 	assert.True(q.Values[0] == "value1" || q.Values[1] == "value1")
 	assert.True(q.Values[0] == "value2" || q.Values[1] == "value2")
 }
+
+// Regexes are compiled once, not for every match. AllocsPerRun cannot be used
+// in parallel tests.
+func TestMatchRegexCompiledOnce(t *testing.T) { //nolint:paralleltest
+	assert := assert.New(t)
+
+	q := &zebra.Query{Key: "key", Op: zebra.MatchRegex, Values: []string{"^model[0-9]+$"}}
+	assert.Nil(q.Validate())
+	assert.Zero(testing.AllocsPerRun(100, func() { q.Match("model42", true) }))
+	assert.False(q.Match("model", true))
+}
+
+func TestMatchQuery(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	match := func(op zebra.Operator, val string, found bool, values ...string) bool {
+		q := &zebra.Query{Key: "key", Op: op, Values: values}
+		assert.Nil(q.Validate())
+
+		return q.Match(val, found)
+	}
+
+	assert.True(match(zebra.MatchEqual, "a", true, "a"))
+	assert.False(match(zebra.MatchEqual, "a", false, "a"))
+	assert.True(match(zebra.MatchNotEqual, "a", false, "a"))
+	assert.True(match(zebra.MatchIn, "10.0.0.1", true, "10.0.0.0/24"))
+	assert.True(match(zebra.MatchIn, "10.0.0.1", true, "::ffff:10.0.0.1"))
+	assert.False(match(zebra.MatchNotIn, "b", true, "a", "b"))
+	assert.True(match(zebra.MatchExists, "", true))
+	assert.False(match(zebra.MatchExists, "", false))
+	assert.True(match(zebra.MatchPrefix, "modelA", true, "model"))
+	assert.True(match(zebra.MatchRegex, "modelA", true, "^m.*A$"))
+	assert.False(match(zebra.MatchRegex, "modelA", false, ".*"))
+	assert.True(match(zebra.MatchLess, "9", true, "10"))
+	assert.True(match(zebra.MatchGreater, "b", true, "a"))
+	assert.True(match(zebra.MatchGreater, "10.0.0.10", true, "10.0.0.9"))
+	assert.False(match(zebra.MatchGreater, "10", false, "1"))
+
+	assert.False((&zebra.Query{Key: "key", Op: 10, Values: nil}).Match("", true))
+	assert.NotNil((&zebra.Query{Key: "key", Op: zebra.MatchExists, Values: []string{"a"}}).Validate())
+	assert.NotNil((&zebra.Query{Key: "key", Op: zebra.MatchRegex, Values: []string{"("}}).Validate())
+
+	for _, op := range []string{"exists", "prefix", "=~", "<", ">"} {
+		var o zebra.Operator
+		assert.Nil(o.UnmarshalText([]byte(op)))
+
+		text, err := o.MarshalText()
+		assert.Nil(err)
+		assert.Equal(op, string(text))
+	}
+}
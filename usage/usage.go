@@ -0,0 +1,285 @@
+// Package usage records the intervals zebra resources were leased for and
+// aggregates them into utilization reports by user, group or resource type.
+package usage
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/jsonlog"
+)
+
+// Report groupings.
+const (
+	GroupByUser  = "user"
+	GroupByGroup = "group"
+	GroupByType  = "type"
+)
+
+// TopConsumers is the number of users listed as top consumers in a report.
+const TopConsumers = 5
+
+var (
+	ErrGroupBy = errors.New("usage report must be grouped by user, group or type")
+	ErrPeriod  = errors.New("usage report period must end after it starts")
+)
+
+// Interval is the time a resource was leased by a user, the group is the
+// system.group label of the resource.
+type Interval struct {
+	Resource string    `json:"resource"`
+	Type     string    `json:"type"`
+	Group    string    `json:"group"`
+	User     string    `json:"user"`
+	Lease    string    `json:"lease"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+}
+
+// Log is an append-only log of the finished lease intervals stored as json
+// lines in a file.
+type Log struct {
+	log *jsonlog.Log
+}
+
+// Consumer is the number of hours a user leased resources for.
+type Consumer struct {
+	User  string  `json:"user"`
+	Hours float64 `json:"hours"`
+}
+
+// Row is the usage of a single user, group or resource type. Utilization is
+// the percent of the hours the resources in the row could have been leased
+// for during the report period. Users have no resources of their own, so
+// their utilization is a percent of all the resources in the report.
+type Row struct {
+	Key         string  `json:"key"`
+	Hours       float64 `json:"hours"`
+	Utilization float64 `json:"utilization"`
+	Leases      int     `json:"leases"`
+	Resources   int     `json:"resources"`
+}
+
+// Report is the resource usage during a period of time.
+type Report struct {
+	From         time.Time  `json:"from"`
+	To           time.Time  `json:"to"`
+	GroupBy      string     `json:"groupBy"`
+	Hours        float64    `json:"hours"`
+	Utilization  float64    `json:"utilization"`
+	Resources    int        `json:"resources"`
+	Rows         []*Row     `json:"rows"`
+	TopConsumers []Consumer `json:"topConsumers"`
+}
+
+// NewLog returns a usage log stored in the given file.
+func NewLog(file string) *Log {
+	return &Log{log: jsonlog.NewLog(file)}
+}
+
+// Initialize creates the directory of the log file if it does not exist.
+func (u *Log) Initialize() error {
+	return u.log.Initialize()
+}
+
+// Record appends the intervals to the log.
+func (u *Log) Record(intervals ...*Interval) error {
+	values := make([]interface{}, 0, len(intervals))
+	for _, i := range intervals {
+		values = append(values, i)
+	}
+
+	return u.log.Append(values...)
+}
+
+// Query returns the intervals overlapping the period from, to in the order
+// they were recorded.
+func (u *Log) Query(from time.Time, to time.Time) ([]*Interval, error) {
+	intervals := []*Interval{}
+
+	err := u.log.Scan(func(line []byte) error {
+		i := new(Interval)
+		if err := json.Unmarshal(line, i); err != nil {
+			return err
+		}
+
+		if i.Overlaps(from, to) {
+			intervals = append(intervals, i)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return intervals, nil
+}
+
+// Overlaps returns true if the interval overlaps the period from, to.
+func (i *Interval) Overlaps(from time.Time, to time.Time) bool {
+	return i.End.After(from) && i.Start.Before(to)
+}
+
+// Hours returns the number of hours of the interval within the period from,
+// to.
+func (i *Interval) Hours(from time.Time, to time.Time) float64 {
+	start, end := i.Start, i.End
+
+	if start.Before(from) {
+		start = from
+	}
+
+	if end.After(to) {
+		end = to
+	}
+
+	if !end.After(start) {
+		return 0
+	}
+
+	return end.Sub(start).Hours()
+}
+
+// key returns the key of the report row the interval is counted in.
+func (i *Interval) key(groupBy string) string {
+	switch groupBy {
+	case GroupByUser:
+		return i.User
+	case GroupByGroup:
+		return i.Group
+	default:
+		return i.Type
+	}
+}
+
+// resourceKey returns the key of the report row the resource is counted in,
+// resources do not belong to users.
+func resourceKey(res zebra.Resource, groupBy string) string {
+	if groupBy == GroupByGroup {
+		return res.GetLabels()["system.group"]
+	}
+
+	return res.GetType()
+}
+
+// NewReport aggregates the intervals leased during the period from, to by
+// user, group or type. Resources are the resources that could have been
+// leased, which the utilization is computed from. Rows are sorted by hours,
+// most used first.
+func NewReport(from time.Time, to time.Time, groupBy string, intervals []*Interval,
+	resources []zebra.Resource,
+) (*Report, error) {
+	if groupBy != GroupByUser && groupBy != GroupByGroup && groupBy != GroupByType {
+		return nil, ErrGroupBy
+	}
+
+	if !to.After(from) {
+		return nil, ErrPeriod
+	}
+
+	report := &Report{
+		From:         from,
+		To:           to,
+		GroupBy:      groupBy,
+		Hours:        0,
+		Utilization:  0,
+		Resources:    len(resources),
+		Rows:         []*Row{},
+		TopConsumers: []Consumer{},
+	}
+
+	rows := map[string]*Row{}
+	row := func(key string) *Row {
+		if r, ok := rows[key]; ok {
+			return r
+		}
+
+		r := &Row{Key: key, Hours: 0, Utilization: 0, Leases: 0, Resources: 0}
+		rows[key] = r
+
+		return r
+	}
+
+	if groupBy != GroupByUser {
+		for _, res := range resources {
+			row(resourceKey(res, groupBy)).Resources++
+		}
+	}
+
+	leases := map[string]map[string]struct{}{}
+	users := map[string]float64{}
+
+	for _, i := range intervals {
+		hours := i.Hours(from, to)
+		if hours == 0 {
+			continue
+		}
+
+		key := i.key(groupBy)
+		r := row(key)
+		r.Hours += hours
+		report.Hours += hours
+		users[i.User] += hours
+
+		if leases[key] == nil {
+			leases[key] = map[string]struct{}{}
+		}
+
+		leases[key][i.Lease] = struct{}{}
+	}
+
+	period := to.Sub(from).Hours()
+
+	for key, r := range rows {
+		r.Leases = len(leases[key])
+
+		capacity := float64(r.Resources)
+		if groupBy == GroupByUser {
+			capacity = float64(len(resources))
+		}
+
+		r.Utilization = percent(r.Hours, capacity*period)
+		report.Rows = append(report.Rows, r)
+	}
+
+	report.Utilization = percent(report.Hours, float64(len(resources))*period)
+
+	sort.Slice(report.Rows, func(i, j int) bool {
+		if report.Rows[i].Hours != report.Rows[j].Hours {
+			return report.Rows[i].Hours > report.Rows[j].Hours
+		}
+
+		return report.Rows[i].Key < report.Rows[j].Key
+	})
+
+	for user, hours := range users {
+		report.TopConsumers = append(report.TopConsumers, Consumer{User: user, Hours: hours})
+	}
+
+	sort.Slice(report.TopConsumers, func(i, j int) bool {
+		if report.TopConsumers[i].Hours != report.TopConsumers[j].Hours {
+			return report.TopConsumers[i].Hours > report.TopConsumers[j].Hours
+		}
+
+		return report.TopConsumers[i].User < report.TopConsumers[j].User
+	})
+
+	if len(report.TopConsumers) > TopConsumers {
+		report.TopConsumers = report.TopConsumers[:TopConsumers]
+	}
+
+	return report, nil
+}
+
+// percent returns used as a percent of total, 0 if total is 0.
+func percent(used float64, total float64) float64 {
+	if total <= 0 {
+		return 0
+	}
+
+	return used / total * 100 //nolint:gomnd
+}
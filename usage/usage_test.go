@@ -0,0 +1,129 @@
+package usage_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/jsonlog"
+	"github.com/project-safari/zebra/usage"
+	"github.com/stretchr/testify/assert"
+)
+
+func getIntervals(start time.Time) []*usage.Interval {
+	return []*usage.Interval{
+		{
+			Resource: "0100000001", Type: "Server", Group: "eng", User: "thor@asgard.io", Lease: "0200000001",
+			Start: start, End: start.Add(2 * time.Hour),
+		},
+		{
+			Resource: "0100000002", Type: "Server", Group: "eng", User: "thor@asgard.io", Lease: "0200000001",
+			Start: start, End: start.Add(2 * time.Hour),
+		},
+		{
+			Resource: "0100000003", Type: "Switch", Group: "ops", User: "loki@asgard.io", Lease: "0200000002",
+			Start: start.Add(-time.Hour), End: start.Add(time.Hour),
+		},
+	}
+}
+
+func getResources() []zebra.Resource {
+	return []zebra.Resource{
+		zebra.NewBaseResource("Server", zebra.Labels{"system.group": "eng"}),
+		zebra.NewBaseResource("Server", zebra.Labels{"system.group": "eng"}),
+		zebra.NewBaseResource("Server", zebra.Labels{"system.group": "eng"}),
+		zebra.NewBaseResource("Server", zebra.Labels{"system.group": "eng"}),
+		zebra.NewBaseResource("Switch", zebra.Labels{"system.group": "ops"}),
+	}
+}
+
+func TestLog(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "testusagelog"
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	assert.Equal(jsonlog.ErrLogPath, usage.NewLog("").Initialize())
+
+	log := usage.NewLog(filepath.Join(root, "usage", "usage.log"))
+	assert.Nil(log.Initialize())
+
+	start := time.Now().Truncate(time.Second)
+
+	intervals, err := log.Query(start.Add(-time.Hour), start)
+	assert.Nil(err)
+	assert.Empty(intervals)
+
+	assert.Nil(log.Record())
+	assert.Nil(log.Record(getIntervals(start)...))
+
+	intervals, err = log.Query(start, start.Add(time.Hour))
+	assert.Nil(err)
+	assert.Len(intervals, 3)
+	assert.True(start.Equal(intervals[0].Start))
+
+	intervals, err = log.Query(start.Add(-2*time.Hour), start)
+	assert.Nil(err)
+	assert.Len(intervals, 1)
+	assert.Equal("loki@asgard.io", intervals[0].User)
+
+	intervals, err = log.Query(start.Add(2*time.Hour), start.Add(3*time.Hour))
+	assert.Nil(err)
+	assert.Empty(intervals)
+}
+
+func TestReport(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	start := time.Now()
+	from, to := start, start.Add(4*time.Hour)
+
+	_, err := usage.NewReport(from, to, "color", nil, nil)
+	assert.Equal(usage.ErrGroupBy, err)
+
+	_, err = usage.NewReport(to, from, usage.GroupByUser, nil, nil)
+	assert.Equal(usage.ErrPeriod, err)
+
+	report, err := usage.NewReport(from, to, usage.GroupByUser, getIntervals(start), getResources())
+	assert.Nil(err)
+	assert.InDelta(5.0, report.Hours, 0.001)
+	assert.InDelta(25.0, report.Utilization, 0.001)
+	assert.Equal(5, report.Resources)
+	assert.Len(report.Rows, 2)
+	assert.Equal("thor@asgard.io", report.Rows[0].Key)
+	assert.InDelta(4.0, report.Rows[0].Hours, 0.001)
+	assert.InDelta(20.0, report.Rows[0].Utilization, 0.001)
+	assert.Equal(1, report.Rows[0].Leases)
+	assert.Equal([]usage.Consumer{{User: "thor@asgard.io", Hours: 4}, {User: "loki@asgard.io", Hours: 1}},
+		report.TopConsumers)
+
+	// Only the hour of the switch lease within the period is counted
+	report, err = usage.NewReport(from, to, usage.GroupByType, getIntervals(start), getResources())
+	assert.Nil(err)
+	assert.Len(report.Rows, 2)
+	assert.Equal("Server", report.Rows[0].Key)
+	assert.Equal(4, report.Rows[0].Resources)
+	assert.InDelta(25.0, report.Rows[0].Utilization, 0.001)
+	assert.Equal("Switch", report.Rows[1].Key)
+	assert.InDelta(1.0, report.Rows[1].Hours, 0.001)
+	assert.InDelta(25.0, report.Rows[1].Utilization, 0.001)
+
+	// Groups without leases are reported too
+	resources := append(getResources(), zebra.NewBaseResource("Server", zebra.Labels{"system.group": "idle"}))
+	report, err = usage.NewReport(from, to, usage.GroupByGroup, getIntervals(start), resources)
+	assert.Nil(err)
+	assert.Len(report.Rows, 3)
+	assert.Equal("idle", report.Rows[2].Key)
+	assert.Zero(report.Rows[2].Hours)
+	assert.Equal(1, report.Rows[2].Resources)
+
+	// No resources, no utilization
+	report, err = usage.NewReport(from, to, usage.GroupByType, getIntervals(start), nil)
+	assert.Nil(err)
+	assert.Zero(report.Utilization)
+}